@@ -0,0 +1,113 @@
+package tftp_test
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	tftp "github.com/doodles526/go-tftp"
+	"github.com/doodles526/go-tftp/errors"
+	"github.com/doodles526/go-tftp/tftptest"
+)
+
+func TestAllowReadDenyWrite(t *testing.T) {
+	n := tftptest.NewNetwork(1)
+	h := newMemHandler(map[string][]byte{"config": file(700)})
+	var readFrom, writeFrom net.Addr
+	addr := serve(t, n, &tftp.Server{
+		Handler: h,
+		AllowRead: func(remote net.Addr, filename string) error {
+			readFrom = remote
+			return nil
+		},
+		AllowWrite: func(remote net.Addr, filename string) error {
+			writeFrom = remote
+			return errors.ErrorAccessViolation("uploads not allowed from " + remote.String())
+		},
+	})
+	c, err := (&tftp.Client{Addr: addr, Transport: n}).Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	var buf bytes.Buffer
+	if _, err := c.Get("config", &buf); err != nil || !bytes.Equal(buf.Bytes(), file(700)) {
+		t.Errorf("Get: %v", err)
+	}
+	_, err = c.Put("config", strings.NewReader("overwritten"))
+	if _, ok := err.(errors.ErrorAccessViolation); !ok {
+		t.Errorf("Put: %#v, want ErrorAccessViolation", err)
+	}
+	if b, _ := h.file("config"); !bytes.Equal(b, file(700)) {
+		t.Error("denied write changed the file")
+	}
+	if readFrom == nil || writeFrom == nil || readFrom.String() != writeFrom.String() {
+		t.Errorf("read allowed for %v, write denied for %v; want the same address", readFrom, writeFrom)
+	}
+}
+
+// countingHandler counts the files its memHandler opens.
+type countingHandler struct {
+	*memHandler
+	mu            sync.Mutex
+	reads, writes int
+}
+
+func (h *countingHandler) ReadFile(filename string) (io.ReadCloser, error) {
+	h.mu.Lock()
+	h.reads++
+	h.mu.Unlock()
+	return h.memHandler.ReadFile(filename)
+}
+
+func (h *countingHandler) WriteFile(filename string) (io.WriteCloser, error) {
+	h.mu.Lock()
+	h.writes++
+	h.mu.Unlock()
+	return h.memHandler.WriteFile(filename)
+}
+
+func TestAccessMode(t *testing.T) {
+	for _, c := range []struct {
+		mode        tftp.AccessMode
+		read, write bool
+	}{
+		{tftp.ReadWrite, true, true},
+		{tftp.ReadOnly, true, false},
+		{tftp.WriteOnly, false, true},
+	} {
+		n := tftptest.NewNetwork(1)
+		h := &countingHandler{memHandler: newMemHandler(map[string][]byte{"f": file(100)})}
+		addr := serve(t, n, &tftp.Server{Handler: h, Mode: c.mode})
+		client := &tftp.Client{Addr: addr, Transport: n}
+		for _, op := range []struct {
+			name    string
+			allowed bool
+			run     func() error
+			calls   func() int
+		}{
+			{"Get", c.read, func() error { _, err := client.Get("f", io.Discard); return err }, func() int { return h.reads }},
+			{"Put", c.write, func() error { _, err := client.Put("g", bytes.NewReader(file(100))); return err }, func() int { return h.writes }},
+		} {
+			err := op.run()
+			h.mu.Lock()
+			calls := op.calls()
+			h.mu.Unlock()
+			if op.allowed {
+				if err != nil || calls != 1 {
+					t.Errorf("mode %d: %s = %v with %d handler calls, want success", c.mode, op.name, err, calls)
+				}
+				continue
+			}
+			if _, ok := err.(errors.ErrorAccessViolation); !ok {
+				t.Errorf("mode %d: %s = %#v, want ErrorAccessViolation", c.mode, op.name, err)
+			}
+			if calls != 0 {
+				t.Errorf("mode %d: refused %s reached the handler", c.mode, op.name)
+			}
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package tftp
+
+import (
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/doodles526/go-tftp/errors"
+	"github.com/doodles526/go-tftp/packets"
+)
+
+type transferNotFoundError struct{}
+
+func (transferNotFoundError) Error() string { return "tftp: no such transfer" }
+
+// ErrTransferNotFound is returned by CancelTransfer for an ID that is not
+// that of an active transfer.
+var ErrTransferNotFound error = transferNotFoundError{}
+
+type transferCanceledError struct{}
+
+func (transferCanceledError) Error() string { return "tftp: transfer canceled" }
+
+// ErrTransferCanceled is the error of a transfer ended by CancelTransfer,
+// as passed to Server.OnTransferComplete.
+var ErrTransferCanceled error = transferCanceledError{}
+
+// activeTransfer is the entry of a running transfer in Server.transfers.
+type activeTransfer struct {
+	info     TransferInfo // fields fixed when the transfer starts
+	conn     net.PacketConn
+	bytes    atomic.Int64
+	canceled atomic.Bool
+}
+
+// ActiveTransfers returns the transfers in progress, oldest first. Of
+// their fields, ID, Remote, Op, Filename, Mode and Start are set, and
+// Bytes is the number of bytes transferred so far.
+func (s *Server) ActiveTransfers() []TransferInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	infos := make([]TransferInfo, 0, len(s.transfers))
+	for _, t := range s.transfers {
+		info := t.info
+		info.Bytes = t.bytes.Load()
+		infos = append(infos, info)
+	}
+	slices.SortFunc(infos, func(a, b TransferInfo) int {
+		if c := a.Start.Compare(b.Start); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+	return infos
+}
+
+// CancelTransfer ends the active transfer with the given ID, sending the
+// client an error and closing the transfer's socket. The transfer fails
+// with ErrTransferCanceled. CancelTransfer returns ErrTransferNotFound if
+// no such transfer is running, as when it has already ended.
+func (s *Server) CancelTransfer(id string) error {
+	s.mu.Lock()
+	t, ok := s.transfers[id]
+	s.mu.Unlock()
+	if !ok {
+		return ErrTransferNotFound
+	}
+	if t.canceled.Swap(true) {
+		return nil
+	}
+	if b, err := packets.ErrorToPacket(errors.ErrorNotDefined("transfer canceled")).Encode(); err == nil {
+		t.conn.WriteTo(b, t.info.Remote)
+	}
+	return t.conn.Close()
+}
+
+// register adds a transfer to those listed by ActiveTransfers.
+func (s *Server) register(conn net.PacketConn, remote net.Addr, req packets.Packet, start time.Time) *activeTransfer {
+	filename, mode, _ := requestFields(req)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastID++
+	t := &activeTransfer{
+		info: TransferInfo{
+			ID:       strconv.FormatUint(s.lastID, 10),
+			Remote:   remote,
+			Op:       req.Opcode(),
+			Filename: filename,
+			Mode:     mode,
+			Start:    start,
+		},
+		conn: conn,
+	}
+	if s.transfers == nil {
+		s.transfers = make(map[string]*activeTransfer)
+	}
+	s.transfers[t.info.ID] = t
+	return t
+}
+
+func (s *Server) unregister(t *activeTransfer) {
+	s.mu.Lock()
+	delete(s.transfers, t.info.ID)
+	s.mu.Unlock()
+}
@@ -0,0 +1,71 @@
+package tftp_test
+
+import (
+	"testing"
+
+	tftp "github.com/doodles526/go-tftp"
+	"github.com/doodles526/go-tftp/errors"
+	"github.com/doodles526/go-tftp/packets"
+	"github.com/doodles526/go-tftp/tftptest"
+)
+
+func TestActiveTransfers(t *testing.T) {
+	n := tftptest.NewNetwork(1)
+	done := make(completions, 2)
+	s := &tftp.Server{Handler: newMemHandler(map[string][]byte{"r": file(2000)}), OnTransferComplete: done.hook}
+	addr := serve(t, n, s)
+	if active := s.ActiveTransfers(); len(active) != 0 {
+		t.Fatalf("idle server lists %+v", active)
+	}
+
+	// A read waiting for the ACK of DATA 1, then a write halted after
+	// its first block.
+	conn, reply, _ := request(t, n, addr, &packets.ReadRequestPacket{Filename: "r", Mode: packets.ModeOctet})
+	if _, ok := reply.(*packets.DataPacket); !ok {
+		t.Fatalf("reply %+v, want DATA 1", reply)
+	}
+	c := &tftp.Client{Addr: addr, Transport: n}
+	resume := putHalted(t, c, "w", file(2000))
+
+	active := s.ActiveTransfers()
+	if len(active) != 2 {
+		t.Fatalf("listed %+v, want the read and the write", active)
+	}
+	r, w := active[0], active[1]
+	if r.Op != packets.OpRRQ || r.Filename != "r" || r.Mode != packets.ModeOctet || r.Remote.String() != conn.LocalAddr().String() || r.Bytes != 0 {
+		t.Errorf("read listed as %+v", r)
+	}
+	if w.Op != packets.OpWRQ || w.Filename != "w" || w.Bytes != 512 {
+		t.Errorf("write listed as %+v", w)
+	}
+	if r.ID == w.ID || r.Start.After(w.Start) {
+		t.Errorf("listed %+v, want distinct IDs, oldest first", active)
+	}
+
+	// Both peers are told, and the transfers end.
+	if err := s.CancelTransfer(r.ID); err != nil {
+		t.Fatal(err)
+	}
+	if e, ok := readReply(t, conn).(*packets.ErrorPacket); !ok || e.ErrorMessage != "transfer canceled" {
+		t.Errorf("canceled read sent %+v, want ERROR transfer canceled", e)
+	}
+	if info := done.next(t); info.ID != r.ID || info.Err != tftp.ErrTransferCanceled {
+		t.Errorf("canceled read completed as %+v", info)
+	}
+	if err := s.CancelTransfer(w.ID); err != nil {
+		t.Fatal(err)
+	}
+	err := resume()
+	if e, ok := err.(errors.ErrorNotDefined); !ok || string(e) != "transfer canceled" {
+		t.Errorf("canceled Put returned %#v, want ErrorNotDefined transfer canceled", err)
+	}
+	if info := done.next(t); info.ID != w.ID || info.Err != tftp.ErrTransferCanceled {
+		t.Errorf("canceled write completed as %+v", info)
+	}
+	if active := s.ActiveTransfers(); len(active) != 0 {
+		t.Errorf("after cancellation listed %+v", active)
+	}
+	if err := s.CancelTransfer(r.ID); err != tftp.ErrTransferNotFound {
+		t.Errorf("second cancellation: %v, want ErrTransferNotFound", err)
+	}
+}
@@ -0,0 +1,94 @@
+package tftp_test
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+
+	tftp "github.com/doodles526/go-tftp"
+	"github.com/doodles526/go-tftp/tftptest"
+)
+
+// addrTransport opens real sockets and records the addresses they are
+// bound to.
+type addrTransport struct {
+	mu    sync.Mutex
+	addrs []net.Addr
+}
+
+func (t *addrTransport) ListenPacket(network, address string) (net.PacketConn, error) {
+	c, err := net.ListenPacket(network, address)
+	if err == nil {
+		t.mu.Lock()
+		t.addrs = append(t.addrs, c.LocalAddr())
+		t.mu.Unlock()
+	}
+	return c, err
+}
+
+func TestTransferSocketAddress(t *testing.T) {
+	for _, c := range []struct {
+		name, listen, bind string
+	}{
+		// Replies must not come from a wildcard socket, whose source
+		// address the routing table would pick.
+		{"BindAddress", "0.0.0.0:0", "127.0.0.1"},
+		{"listener address", "127.0.0.1:0", ""},
+	} {
+		l, err := net.ListenPacket("udp4", c.listen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tr := &addrTransport{}
+		s := &tftp.Server{Handler: newMemHandler(map[string][]byte{"f": file(100)}), BindAddress: c.bind, Transport: tr}
+		go s.Serve(l)
+		port := l.LocalAddr().(*net.UDPAddr).Port
+		client := &tftp.Client{Addr: net.JoinHostPort("127.0.0.1", strconv.Itoa(port))}
+		var buf bytes.Buffer
+		if _, err := client.Get("f", &buf); err != nil {
+			t.Errorf("%s: Get: %v", c.name, err)
+		}
+		s.Close()
+		tr.mu.Lock()
+		if len(tr.addrs) != 1 {
+			t.Errorf("%s: %d transfer sockets, want 1", c.name, len(tr.addrs))
+		} else if ip := tr.addrs[0].(*net.UDPAddr).IP; !ip.Equal(net.IPv4(127, 0, 0, 1)) {
+			t.Errorf("%s: transfer socket bound to %v, want 127.0.0.1", c.name, tr.addrs[0])
+		}
+		tr.mu.Unlock()
+	}
+}
+
+func TestClientLocalAddr(t *testing.T) {
+	n := tftptest.NewNetwork(1)
+	done := make(completions, 4)
+	addr := serve(t, n, &tftp.Server{Handler: newMemHandler(map[string][]byte{"f": file(1500)}), OnTransferComplete: done.hook})
+	c := &tftp.Client{Addr: addr, Transport: n, LocalAddr: ":40000"}
+	// The port is kept after the server's reply from its new TID, and
+	// free again for the next transfer.
+	for range 2 {
+		if _, err := c.Get("f", io.Discard); err != nil {
+			t.Fatal(err)
+		}
+		if info := done.next(t); info.Remote.(*net.UDPAddr).Port != 40000 {
+			t.Errorf("transfer came from %v, want port 40000", info.Remote)
+		}
+	}
+	conn, err := c.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if port := conn.LocalAddr().(*net.UDPAddr).Port; port != 40000 {
+		t.Errorf("Conn bound to port %d, want 40000", port)
+	}
+	if _, err := conn.Get("f", io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if info := done.next(t); info.Remote.(*net.UDPAddr).Port != 40000 {
+		t.Errorf("Conn transfer came from %v, want port 40000", info.Remote)
+	}
+}
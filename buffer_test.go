@@ -0,0 +1,87 @@
+package tftp_test
+
+import (
+	"bytes"
+	stderrors "errors"
+	"io"
+	"net"
+	"sync"
+	"testing"
+
+	tftp "github.com/doodles526/go-tftp"
+	"github.com/doodles526/go-tftp/tftptest"
+)
+
+// bufferTransport opens sockets on a Network that accept buffer sizes as
+// a *net.UDPConn does, and records them.
+type bufferTransport struct {
+	n   *tftptest.Network
+	err error // returned by the setters
+
+	mu            sync.Mutex
+	reads, writes []int
+}
+
+func (t *bufferTransport) ListenPacket(network, address string) (net.PacketConn, error) {
+	c, err := t.n.ListenPacket(network, address)
+	if err != nil {
+		return nil, err
+	}
+	return &bufferConn{PacketConn: c, t: t}, nil
+}
+
+type bufferConn struct {
+	net.PacketConn
+	t *bufferTransport
+}
+
+func (c *bufferConn) SetReadBuffer(n int) error {
+	c.t.mu.Lock()
+	defer c.t.mu.Unlock()
+	c.t.reads = append(c.t.reads, n)
+	return c.t.err
+}
+
+func (c *bufferConn) SetWriteBuffer(n int) error {
+	c.t.mu.Lock()
+	defer c.t.mu.Unlock()
+	c.t.writes = append(c.t.writes, n)
+	return c.t.err
+}
+
+func TestSocketBuffers(t *testing.T) {
+	n := tftptest.NewNetwork(1)
+	st := &bufferTransport{n: n}
+	done := make(completions, 1)
+	addr := serve(t, n, &tftp.Server{
+		Handler:            newMemHandler(map[string][]byte{"f": file(100)}),
+		Transport:          st,
+		ReadBuffer:         4 << 20,
+		OnTransferComplete: done.hook,
+	})
+	ct := &bufferTransport{n: n}
+	c := &tftp.Client{Addr: addr, Transport: ct, ReadBuffer: 1 << 20, WriteBuffer: 256 << 10}
+	var buf bytes.Buffer
+	if _, err := c.Get("f", &buf); err != nil {
+		t.Fatal(err)
+	}
+	done.next(t)
+	ct.mu.Lock()
+	if len(ct.reads) != 1 || ct.reads[0] != 1<<20 || len(ct.writes) != 1 || ct.writes[0] != 256<<10 {
+		t.Errorf("client set read buffers %v and write buffers %v", ct.reads, ct.writes)
+	}
+	ct.mu.Unlock()
+	// The server's transfer socket; a zero WriteBuffer is left alone.
+	st.mu.Lock()
+	if len(st.reads) != 1 || st.reads[0] != 4<<20 || len(st.writes) != 0 {
+		t.Errorf("server set read buffers %v and write buffers %v", st.reads, st.writes)
+	}
+	st.mu.Unlock()
+
+	// A size the socket refuses fails the transfer.
+	errRefused := stderrors.New("buffer too large")
+	c.Transport = &bufferTransport{n: n, err: errRefused}
+	if _, err := c.Get("f", io.Discard); err != errRefused {
+		t.Errorf("Get with a refused buffer size: %v, want %v", err, errRefused)
+	}
+}
@@ -0,0 +1,55 @@
+package tftp_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	tftp "github.com/doodles526/go-tftp"
+	"github.com/doodles526/go-tftp/tftptest"
+	"github.com/doodles526/go-tftp/transfer"
+)
+
+func TestServerCache(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "f")
+	old := file(3000)
+	if err := os.WriteFile(path, old, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	n := tftptest.NewNetwork(1)
+	cache := transfer.NewBlockCache(100)
+	addr := serve(t, n, &tftp.Server{Handler: &tftp.FileServer{Root: dir}, Cache: cache})
+	c := &tftp.Client{Addr: addr, Transport: n}
+	get := func() []byte {
+		t.Helper()
+		var buf bytes.Buffer
+		if _, err := c.Get("f", &buf); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	if b := get(); !bytes.Equal(b, old) {
+		t.Fatal("first Get: wrong contents")
+	}
+	if cache.Len() != 6 {
+		t.Errorf("%d blocks cached, want 6", cache.Len())
+	}
+	if b := get(); !bytes.Equal(b, old) {
+		t.Error("Get from the cache: wrong contents")
+	}
+	// Same size, new contents and a new modification time.
+	updated := bytes.Repeat([]byte{'x'}, len(old))
+	if err := os.WriteFile(path, updated, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if b := get(); !bytes.Equal(b, updated) {
+		t.Error("Get after modification returned the cached contents")
+	}
+}
@@ -0,0 +1,302 @@
+// Package tftp implements a TFTP client and server (RFC 1350), with option
+// negotiation (RFC 2347, 2348, 2349) and windowed transfers (RFC 7440).
+package tftp
+
+import (
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/doodles526/go-tftp/packets"
+	"github.com/doodles526/go-tftp/transfer"
+)
+
+// DefaultPort is the well-known TFTP server port.
+const DefaultPort = "69"
+
+// Client transfers files to and from a TFTP server.
+//
+// A Client is safe for concurrent use: every Get and Put opens a socket
+// of its own and keeps its state in a session of its own, sharing nothing
+// with other transfers but the Client's settings and Metrics, which is
+// updated atomically. The fields must not be changed while transfers are
+// running, and OnProgress may be called from several goroutines at once.
+// Use Dial to make several transfers over one socket.
+type Client struct {
+	// Addr is the server address as "host:port", or "[host]:port" for an
+	// IPv6 address. The port defaults to DefaultPort.
+	Addr string
+	// LocalAddr, if set, is the local address the client's sockets are
+	// bound to, as "host:port", ":port" or "host:0", for firewalls that
+	// only let TFTP through from known ports. The server answers from a
+	// new port, but the client keeps its own for the whole transfer.
+	// With a fixed port, concurrent transfers fail to bind; use Dial to
+	// share one socket.
+	LocalAddr string
+	// ReadBuffer and WriteBuffer, if not zero, set the sizes in bytes of
+	// the operating system's receive and send buffers for the client's
+	// sockets. A larger receive buffer absorbs bursts of DATA in windowed
+	// transfers. The system may cap the sizes without an error, as Linux
+	// does at net.core.rmem_max and net.core.wmem_max. Sockets from a
+	// Transport that cannot set them are left as they are.
+	ReadBuffer  int
+	WriteBuffer int
+	// Mode is the transfer mode sent in requests; the default is octet.
+	// Data is transferred as is, without netascii translation.
+	Mode string
+	// BlockSize, if not zero, is requested with the blksize option.
+	BlockSize int
+	// WindowSize, if not zero, is requested with the windowsize option.
+	WindowSize int
+	// Checksum requests per-block CRC-32 checksums with the non-standard
+	// packets.OptionChecksum. Servers that do not support it ignore it.
+	Checksum bool
+	// Multicast requests multicast transfers (RFC 2090) for Get. If the
+	// server agrees, the client joins the multicast group it names, on
+	// MulticastInterface if set.
+	Multicast          bool
+	MulticastInterface *net.Interface
+	// Timeout is the retransmission timeout; zero means
+	// transfer.DefaultTimeout.
+	Timeout time.Duration
+	// RequestTimeout, if not zero, asks the server to retransmit after
+	// that long, with the timeout option rounded up to whole seconds and,
+	// for a fraction of a second, the utimeout option as well, which
+	// servers that support it prefer. The value the server acknowledges
+	// replaces Timeout for the transfer.
+	RequestTimeout time.Duration
+	// Retries is the number of retransmissions before a transfer fails;
+	// zero means transfer.DefaultRetries.
+	Retries int
+	// ConnectTimeout, if not zero, limits how long the client waits for
+	// the server to reply to a request, retransmissions included. A
+	// transfer that gets no reply in time fails with
+	// transfer.ErrConnectTimeout.
+	ConnectTimeout time.Duration
+	// Backoff, if set, lengthens the timeout after each retransmission.
+	Backoff transfer.Backoff
+	// Rollover selects whether block numbers wrap from 65535 to 0, the
+	// default and most common choice, or to 1, for files of more than
+	// 65535 blocks. Both ends of a transfer must agree.
+	Rollover transfer.RolloverMode
+	// NegotiateRollover requests the rollover option with the value of
+	// Rollover, so that servers supporting it agree explicitly. A server
+	// that acknowledges the option may choose the other value, which is
+	// then used.
+	NegotiateRollover bool
+	// LenientDecode accepts ACK and ERROR packets padded with NUL bytes,
+	// which some embedded servers send, and ERROR packets whose message
+	// lacks its terminating NUL.
+	LenientDecode bool
+	// Metrics, if set, is updated by every transfer.
+	Metrics *transfer.Metrics
+	// Tracer, if set, is told of every packet of every transfer, from
+	// the goroutines of concurrent transfers at once.
+	Tracer transfer.Tracer
+	// OnProgress, if set, is called by Get and Put after every block with
+	// the number of bytes transferred so far and the size of the file, or
+	// -1 if it is not known. Get asks the server for the size with the
+	// tsize option; Put sends it when r has a Size or Stat method. The
+	// callback runs on the transfer's goroutine and must return quickly.
+	OnProgress func(transferred, total int64)
+	// RateLimit, if not zero, caps the rate at which each transfer sends
+	// DATA, in bytes per second.
+	RateLimit int
+	// SendDelay, if not zero, is the least time between two DATA packets
+	// Put sends.
+	SendDelay time.Duration
+	// MinThroughput, if not zero, is the lowest average rate in bytes per
+	// second a transfer may run at; see transfer.Config.MinThroughput.
+	// It applies once the size of the file is known: for Get, from the
+	// server's answer to the tsize option, which is then requested; for
+	// Put, from a Size or Stat method of r. Transfers that fall behind
+	// fail with transfer.ErrTooSlow.
+	MinThroughput int
+	// Transport, if set, opens the client's sockets instead of the net
+	// package.
+	Transport Transport
+	// StrictRFC1350 sends requests without any options, for old servers
+	// that reject them despite RFC 2347. BlockSize, WindowSize, Checksum,
+	// RequestTimeout and Multicast are ignored, OnProgress gets no total
+	// for Get, and an OACK in reply is rejected.
+	StrictRFC1350 bool
+}
+
+// NewClient returns a Client for the server at addr.
+func NewClient(addr string) *Client {
+	return &Client{Addr: addr}
+}
+
+// Get downloads filename from the server and writes it to w, returning the
+// number of bytes written.
+func (c *Client) Get(filename string, w io.Writer) (int64, error) {
+	addr, err := c.resolve()
+	if err != nil {
+		return 0, err
+	}
+	conn, err := c.listen()
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	return c.get(c.newSession(conn, addr), filename, w)
+}
+
+// Put uploads the contents of r to the server as filename, returning the
+// number of bytes sent.
+func (c *Client) Put(filename string, r io.Reader) (int64, error) {
+	addr, err := c.resolve()
+	if err != nil {
+		return 0, err
+	}
+	conn, err := c.listen()
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	return c.put(c.newSession(conn, addr), filename, r)
+}
+
+// listen opens a socket on LocalAddr, or on an ephemeral port.
+func (c *Client) listen() (net.PacketConn, error) {
+	addr := c.LocalAddr
+	if addr == "" {
+		addr = ":0"
+	}
+	return listen(c.Transport, addr, c.ReadBuffer, c.WriteBuffer)
+}
+
+func (c *Client) resolve() (*net.UDPAddr, error) {
+	addr := c.Addr
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		// A bare host, possibly an IPv6 address with or without brackets.
+		addr = net.JoinHostPort(strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]"), DefaultPort)
+	}
+	return net.ResolveUDPAddr("udp", addr)
+}
+
+func (c *Client) newSession(conn net.PacketConn, addr net.Addr) *transfer.Session {
+	s := transfer.NewRequestSession(conn, addr, transfer.Config{
+		Timeout:        c.Timeout,
+		Retries:        c.Retries,
+		Backoff:        c.Backoff,
+		Rollover:       c.Rollover,
+		LenientDecode:  c.LenientDecode,
+		ConnectTimeout: c.ConnectTimeout,
+		SendDelay:      c.SendDelay,
+		MinThroughput:  c.MinThroughput,
+	})
+	s.Metrics = c.Metrics
+	s.Tracer = c.Tracer
+	if c.RateLimit > 0 {
+		s.Limiter = transfer.NewLimiter(c.RateLimit)
+	}
+	return s
+}
+
+func (c *Client) get(s *transfer.Session, filename string, w io.Writer) (int64, error) {
+	multicast := c.Multicast && !c.StrictRFC1350
+	opts := c.options()
+	if multicast {
+		opts = append(opts, packets.WithMulticast())
+	}
+	if (c.OnProgress != nil || c.MinThroughput > 0) && !c.StrictRFC1350 {
+		opts = append(opts, packets.WithTransferSize(0))
+	}
+	rrq, err := packets.NewReadRequest(filename, c.Mode, opts...)
+	if err != nil {
+		return 0, err
+	}
+	total := int64(-1)
+	if !c.StrictRFC1350 {
+		s.OnOptionAck = func(oack *packets.OptionAckPacket) error {
+			if err := s.Config.ApplyOptionAck(rrq.Options, oack.Options); err != nil {
+				return err
+			}
+			if size, err := strconv.ParseInt(oack.Options[packets.OptionTransferSize], 10, 64); err == nil {
+				total = size
+				s.ExpectSize(size)
+			}
+			return nil
+		}
+	}
+	c.reportProgress(s, &total)
+	if multicast {
+		return s.ReceiveMulticast(w, rrq, c.MulticastInterface)
+	}
+	return s.Receive(w, rrq)
+}
+
+func (c *Client) put(s *transfer.Session, filename string, r io.Reader) (int64, error) {
+	opts := c.options()
+	total := int64(-1)
+	if c.OnProgress != nil || c.MinThroughput > 0 {
+		if size, ok := sizeOf(r); ok {
+			total = size
+			s.ExpectSize(size)
+			if !c.StrictRFC1350 {
+				opts = append(opts, packets.WithTransferSize(size))
+			}
+		}
+	}
+	wrq, err := packets.NewWriteRequest(filename, c.Mode, opts...)
+	if err != nil {
+		return 0, err
+	}
+	if !c.StrictRFC1350 {
+		s.OnOptionAck = func(oack *packets.OptionAckPacket) error {
+			return s.Config.ApplyOptionAck(wrq.Options, oack.Options)
+		}
+	}
+	c.reportProgress(s, &total)
+	return s.Send(r, wrq)
+}
+
+// reportProgress passes the session's progress to OnProgress, along with
+// *total as it is when each block is reported.
+func (c *Client) reportProgress(s *transfer.Session, total *int64) {
+	if c.OnProgress == nil {
+		return
+	}
+	s.OnProgress = func(n int64) {
+		c.OnProgress(n, *total)
+	}
+}
+
+// options returns the options to request.
+func (c *Client) options() []packets.RequestOption {
+	if c.StrictRFC1350 {
+		return nil
+	}
+	var opts []packets.RequestOption
+	if c.BlockSize != 0 {
+		opts = append(opts, packets.WithBlockSize(c.BlockSize))
+	}
+	if c.WindowSize != 0 {
+		opts = append(opts, packets.WithWindowSize(c.WindowSize))
+	}
+	if c.RequestTimeout > 0 {
+		opts = append(opts, timeoutOptions(c.RequestTimeout)...)
+	}
+	if c.Checksum {
+		opts = append(opts, packets.WithChecksum())
+	}
+	if c.NegotiateRollover {
+		opts = append(opts, packets.WithRollover(int(c.Rollover)))
+	}
+	return opts
+}
+
+// timeoutOptions returns the timeout option for d, in whole seconds
+// rounded up, and the utimeout option too unless d is whole seconds. Both
+// are kept within the bounds the options allow.
+func timeoutOptions(d time.Duration) []packets.RequestOption {
+	seconds := int((d + time.Second - 1) / time.Second)
+	opts := []packets.RequestOption{packets.WithTimeout(min(max(seconds, transfer.MinTimeout), transfer.MaxTimeout))}
+	if d%time.Second != 0 && seconds <= transfer.MaxTimeout {
+		opts = append(opts, packets.WithUTimeout(max(int(d/time.Microsecond), transfer.MinUTimeout)))
+	}
+	return opts
+}
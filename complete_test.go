@@ -0,0 +1,117 @@
+package tftp_test
+
+import (
+	stderrors "errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	tftp "github.com/doodles526/go-tftp"
+	"github.com/doodles526/go-tftp/errors"
+	"github.com/doodles526/go-tftp/packets"
+	"github.com/doodles526/go-tftp/tftptest"
+)
+
+// completions collects the TransferInfo passed to OnTransferComplete.
+type completions chan tftp.TransferInfo
+
+func (c completions) hook(info tftp.TransferInfo) { c <- info }
+
+// next returns the next completion, failing if there is none within a
+// second.
+func (c completions) next(t *testing.T) tftp.TransferInfo {
+	t.Helper()
+	select {
+	case info := <-c:
+		return info
+	case <-time.After(time.Second):
+		t.Fatal("OnTransferComplete not called")
+	}
+	return tftp.TransferInfo{}
+}
+
+// none fails if there are any more completions.
+func (c completions) none(t *testing.T) {
+	t.Helper()
+	select {
+	case info := <-c:
+		t.Errorf("OnTransferComplete called again with %+v", info)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestOnTransferComplete(t *testing.T) {
+	n := tftptest.NewNetwork(1)
+	done := make(completions, 4)
+	addr := serve(t, n, &tftp.Server{
+		Handler:            newMemHandler(map[string][]byte{"f": file(1500)}),
+		OnTransferComplete: done.hook,
+	})
+	c := &tftp.Client{Addr: addr, Transport: n, BlockSize: 1024}
+	before := time.Now()
+	if _, err := c.Get("f", io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	info := done.next(t)
+	if info.Err != nil || info.Op != packets.OpRRQ || info.Filename != "f" || info.Bytes != 1500 || info.BlockSize != 1024 {
+		t.Errorf("completed read reported as %+v", info)
+	}
+	if info.Start.Before(before) || info.End.Before(info.Start) || info.ID == "" {
+		t.Errorf("read ran from %v to %v with ID %q", info.Start, info.End, info.ID)
+	}
+	done.none(t)
+
+	// The writer fails after the first block.
+	_, err := c.Put("w", io.MultiReader(&io.LimitedReader{R: zeros{}, N: 1024}, errorReader{io.ErrClosedPipe}))
+	if err == nil {
+		t.Fatal("Put succeeded")
+	}
+	info = done.next(t)
+	if info.Err == nil || info.Op != packets.OpWRQ || info.Bytes != 1024 {
+		t.Errorf("aborted write reported as %+v", info)
+	}
+	done.none(t)
+}
+
+type zeros struct{}
+
+func (zeros) Read(b []byte) (int, error) {
+	clear(b)
+	return len(b), nil
+}
+
+type errorReader struct{ err error }
+
+func (r errorReader) Read([]byte) (int, error) { return 0, r.err }
+
+// brokenTransport cannot open sockets.
+type brokenTransport struct{}
+
+var errNoSockets = stderrors.New("no sockets left")
+
+func (brokenTransport) ListenPacket(network, address string) (net.PacketConn, error) {
+	return nil, errNoSockets
+}
+
+func TestTransferSocketFailure(t *testing.T) {
+	n := tftptest.NewNetwork(1)
+	done := make(completions, 2)
+	addr := serve(t, n, &tftp.Server{
+		Handler:            newMemHandler(map[string][]byte{"f": file(100)}),
+		Transport:          brokenTransport{},
+		OnTransferComplete: done.hook,
+	})
+	start := time.Now()
+	_, err := (&tftp.Client{Addr: addr, Transport: n}).Get("f", io.Discard)
+	if _, ok := err.(errors.ErrorNotDefined); !ok {
+		t.Errorf("Get: %#v, want ErrorNotDefined", err)
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Errorf("refused after %v", d)
+	}
+	if info := done.next(t); info.Err != errNoSockets || info.Filename != "f" {
+		t.Errorf("failed request reported as %+v", info)
+	}
+	done.none(t)
+}
@@ -0,0 +1,66 @@
+package tftp_test
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+
+	tftp "github.com/doodles526/go-tftp"
+	"github.com/doodles526/go-tftp/tftptest"
+)
+
+// getAll runs a Get of each of files at once and checks the contents.
+func getAll(t *testing.T, get func(string, *bytes.Buffer) error, files map[string][]byte) {
+	t.Helper()
+	var wg sync.WaitGroup
+	for name, want := range files {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var buf bytes.Buffer
+			if err := get(name, &buf); err != nil {
+				t.Errorf("Get %s: %v", name, err)
+			} else if !bytes.Equal(buf.Bytes(), want) {
+				t.Errorf("Get %s: %d bytes differing from the %d served", name, buf.Len(), len(want))
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// tenFiles returns ten files of different sizes and contents.
+func tenFiles() map[string][]byte {
+	files := make(map[string][]byte)
+	for i := range 10 {
+		files[fmt.Sprint("f", i)] = bytes.Repeat([]byte{byte('a' + i)}, 1000+i*700)
+	}
+	return files
+}
+
+func TestConcurrentGets(t *testing.T) {
+	n := tftptest.NewNetwork(1)
+	files := tenFiles()
+	addr := serve(t, n, &tftp.Server{Handler: newMemHandler(files)})
+	c := &tftp.Client{Addr: addr, Transport: n}
+	getAll(t, func(name string, buf *bytes.Buffer) error {
+		_, err := c.Get(name, buf)
+		return err
+	}, files)
+}
+
+func TestConcurrentConnGets(t *testing.T) {
+	n := tftptest.NewNetwork(1)
+	files := tenFiles()
+	addr := serve(t, n, &tftp.Server{Handler: newMemHandler(files)})
+	c, err := (&tftp.Client{Addr: addr, Transport: n}).Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	// The Conn runs them one at a time.
+	getAll(t, func(name string, buf *bytes.Buffer) error {
+		_, err := c.Get(name, buf)
+		return err
+	}, files)
+}
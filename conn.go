@@ -0,0 +1,88 @@
+package tftp
+
+import (
+	"io"
+	"net"
+	"sync"
+)
+
+// Conn makes transfers to one server over a single UDP socket, avoiding a
+// new socket per transfer for clients that talk to the same server
+// repeatedly.
+//
+// Every request is sent to the server's well-known address, and the
+// transfer continues with the new TID the server replies from. Transfers
+// on a Conn are serialized: a Get or Put started while another is in
+// progress waits for it to finish.
+type Conn struct {
+	client Client
+	conn   net.PacketConn
+	addr   *net.UDPAddr
+
+	mu      sync.Mutex
+	lastTID net.Addr
+}
+
+// Dial returns a Conn to the server at addr with default settings.
+func Dial(addr string) (*Conn, error) {
+	return NewClient(addr).Dial()
+}
+
+// Dial opens a Conn to c's server. The Conn uses a copy of c's settings.
+func (c *Client) Dial() (*Conn, error) {
+	addr, err := c.resolve()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := c.listen()
+	if err != nil {
+		return nil, err
+	}
+	return &Conn{client: *c, conn: conn, addr: addr}, nil
+}
+
+// Get downloads filename and writes it to w, returning the number of bytes
+// written.
+func (c *Conn) Get(filename string, w io.Writer) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.client.newSession(c.conn, c.addr)
+	if c.lastTID != nil {
+		s.Ignore(c.lastTID)
+	}
+	n, err := c.client.get(s, filename, w)
+	c.rebind(s.RemoteAddr())
+	return n, err
+}
+
+// Put uploads the contents of r as filename, returning the number of bytes
+// sent.
+func (c *Conn) Put(filename string, r io.Reader) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.client.newSession(c.conn, c.addr)
+	if c.lastTID != nil {
+		s.Ignore(c.lastTID)
+	}
+	n, err := c.client.put(s, filename, r)
+	c.rebind(s.RemoteAddr())
+	return n, err
+}
+
+// rebind records the TID of the transfer that just ended, so that its late
+// packets are not taken for the reply to the next request.
+func (c *Conn) rebind(tid net.Addr) {
+	if tid.String() != c.addr.String() {
+		c.lastTID = tid
+	}
+}
+
+// LocalAddr returns the address of the Conn's socket.
+func (c *Conn) LocalAddr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+// Close closes the Conn's socket.
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,37 @@
+package tftp_test
+
+import (
+	"bytes"
+	"testing"
+
+	tftp "github.com/doodles526/go-tftp"
+	"github.com/doodles526/go-tftp/tftptest"
+)
+
+func TestConnSequentialGets(t *testing.T) {
+	n := tftptest.NewNetwork(1)
+	files := map[string][]byte{"a": file(1500), "b": file(700)}
+	done := make(chan tftp.TransferInfo, 2)
+	addr := serve(t, n, &tftp.Server{
+		Handler:            newMemHandler(files),
+		OnTransferComplete: func(info tftp.TransferInfo) { done <- info },
+	})
+	c, err := (&tftp.Client{Addr: addr, Transport: n}).Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	for _, name := range []string{"a", "b"} {
+		var buf bytes.Buffer
+		if _, err := c.Get(name, &buf); err != nil {
+			t.Fatalf("Get %s: %v", name, err)
+		}
+		if !bytes.Equal(buf.Bytes(), files[name]) {
+			t.Errorf("Get %s: wrong contents", name)
+		}
+		// Both transfers come from the Conn's one socket.
+		if info := <-done; info.Remote.String() != c.LocalAddr().String() {
+			t.Errorf("Get %s came from %v, want %v", name, info.Remote, c.LocalAddr())
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package tftp_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	tftp "github.com/doodles526/go-tftp"
+	"github.com/doodles526/go-tftp/tftptest"
+	"github.com/doodles526/go-tftp/transfer"
+)
+
+func TestConnectTimeout(t *testing.T) {
+	const connect = 150 * time.Millisecond
+	// Nothing listens on the network.
+	n := tftptest.NewNetwork(1)
+	for _, timeout := range []time.Duration{time.Second, 20 * time.Millisecond} {
+		c := &tftp.Client{Addr: "127.0.0.1:69", Transport: n, Timeout: timeout, Retries: 100, ConnectTimeout: connect}
+		for op, run := range map[string]func() error{
+			"Get": func() error { _, err := c.Get("f", io.Discard); return err },
+			"Put": func() error { _, err := c.Put("f", bytes.NewReader(file(100))); return err },
+		} {
+			start := time.Now()
+			err := run()
+			if d := time.Since(start); d < connect || d > connect+100*time.Millisecond {
+				t.Errorf("timeout %v: %s gave up after %v, want %v", timeout, op, d, connect)
+			}
+			if err != transfer.ErrConnectTimeout {
+				t.Errorf("timeout %v: %s: %v, want %v", timeout, op, err, transfer.ErrConnectTimeout)
+			}
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package tftp_test
+
+import (
+	"bytes"
+	"testing"
+
+	tftp "github.com/doodles526/go-tftp"
+	"github.com/doodles526/go-tftp/tftptest"
+)
+
+func TestEmptyFile(t *testing.T) {
+	n := tftptest.NewNetwork(1)
+	var tr traffic
+	tr.watch(n)
+	h := newMemHandler(map[string][]byte{"empty": {}})
+	done := make(completions, 2)
+	addr := serve(t, n, &tftp.Server{Handler: h, OnTransferComplete: done.hook})
+	c := &tftp.Client{Addr: addr, Transport: n}
+
+	var buf bytes.Buffer
+	got, err := c.Get("empty", &buf)
+	if err != nil || got != 0 || buf.Len() != 0 {
+		t.Errorf("Get = %d, %v with %d bytes written", got, err, buf.Len())
+	}
+	if info := done.next(t); info.Err != nil || info.Bytes != 0 {
+		t.Errorf("read reported as %+v", info)
+	}
+	// A single empty block ends the transfer.
+	if want := "[RRQ DATA 1 ACK 1]"; tr.String() != want {
+		t.Errorf("Get traffic %s, want %s", tr.String(), want)
+	}
+
+	tr.reset()
+	sent, err := c.Put("new", bytes.NewReader(nil))
+	if err != nil || sent != 0 {
+		t.Errorf("Put = %d, %v", sent, err)
+	}
+	if info := done.next(t); info.Err != nil || info.Bytes != 0 {
+		t.Errorf("write reported as %+v", info)
+	}
+	if b, ok := h.file("new"); !ok || len(b) != 0 {
+		t.Errorf("stored %q, %v; want an empty file", b, ok)
+	}
+	if want := "[WRQ ACK 0 DATA 1 ACK 1]"; tr.String() != want {
+		t.Errorf("Put traffic %s, want %s", tr.String(), want)
+	}
+}
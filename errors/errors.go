@@ -0,0 +1,81 @@
+// Package errors defines the TFTP error conditions as Go error types.
+//
+// Each type corresponds to one of the error codes carried by an ERROR
+// packet (RFC 1350 section 5, extended by RFC 2347). The string value of
+// an error is the message sent to, or received from, the peer; an empty
+// value falls back to the standard text for that code.
+package errors
+
+// ErrorNotDefined is error code 0, used for conditions that have no
+// dedicated code. The message should describe the problem.
+type ErrorNotDefined string
+
+func (e ErrorNotDefined) Error() string {
+	return message(string(e), "not defined")
+}
+
+// ErrorFileNotFound is error code 1.
+type ErrorFileNotFound string
+
+func (e ErrorFileNotFound) Error() string {
+	return message(string(e), "file not found")
+}
+
+// ErrorAccessViolation is error code 2.
+type ErrorAccessViolation string
+
+func (e ErrorAccessViolation) Error() string {
+	return message(string(e), "access violation")
+}
+
+// ErrorDiskFull is error code 3.
+type ErrorDiskFull string
+
+func (e ErrorDiskFull) Error() string {
+	return message(string(e), "disk full or allocation exceeded")
+}
+
+// ErrorIllegalOperation is error code 4. It is also returned for packets
+// that cannot be decoded.
+type ErrorIllegalOperation string
+
+func (e ErrorIllegalOperation) Error() string {
+	return message(string(e), "illegal TFTP operation")
+}
+
+// ErrorUnknownTransferID is error code 5, sent to a peer whose source
+// address does not match the transfer it is talking to.
+type ErrorUnknownTransferID string
+
+func (e ErrorUnknownTransferID) Error() string {
+	return message(string(e), "unknown transfer ID")
+}
+
+// ErrorFileExists is error code 6.
+type ErrorFileExists string
+
+func (e ErrorFileExists) Error() string {
+	return message(string(e), "file already exists")
+}
+
+// ErrorNoSuchUser is error code 7.
+type ErrorNoSuchUser string
+
+func (e ErrorNoSuchUser) Error() string {
+	return message(string(e), "no such user")
+}
+
+// ErrorOptionNegotiation is error code 8, defined by RFC 2347 for a
+// request or option acknowledgment whose options cannot be accepted.
+type ErrorOptionNegotiation string
+
+func (e ErrorOptionNegotiation) Error() string {
+	return message(string(e), "option negotiation failed")
+}
+
+func message(msg, def string) string {
+	if msg == "" {
+		return def
+	}
+	return msg
+}
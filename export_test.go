@@ -0,0 +1,5 @@
+package tftp
+
+var DiskFree = &diskFree
+
+var Link = &link
@@ -0,0 +1,360 @@
+package tftp
+
+import (
+	stderrors "errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/doodles526/go-tftp/errors"
+)
+
+// FileServer is a Handler serving the files in the directory Root.
+// Filenames are mapped to paths under Root with ResolvePath, so requests
+// for absolute paths or paths outside Root fail with
+// errors.ErrorAccessViolation. Symbolic links under Root are followed,
+// even out of it, unless RejectSymlinkEscapes is set.
+//
+// Written files are received into a temporary file, which is moved into
+// place when the transfer completes and removed if it fails, so that
+// readers never see a partial file. Temporary files are named like
+// ".name.123456.tmp", and requests for such names fail with
+// errors.ErrorAccessViolation. Existing files are not overwritten unless
+// AllowOverwrite is set: a write request for one fails with
+// errors.ErrorFileExists before any data is accepted. A write request
+// whose tsize option exceeds the free space on the file system, where
+// that can be determined, fails with errors.ErrorDiskFull.
+type FileServer struct {
+	// Root is the directory served.
+	Root string
+	// TempDir is the directory written files are received into. It must
+	// be on the same file system as Root. The default is the directory
+	// of the file being written.
+	TempDir string
+	// RejectSymlinkEscapes refuses, with errors.ErrorAccessViolation,
+	// files reached through a symbolic link that leads outside Root.
+	RejectSymlinkEscapes bool
+	// AllowOverwrite lets write requests replace existing regular files.
+	// The new contents are renamed over the old file once complete, so
+	// readers see either the old file or the new one.
+	AllowOverwrite bool
+	// CaseInsensitive makes ReadFile, when no file has the requested
+	// name, look for one whose name differs only in case, component by
+	// component, as PXE firmware and old boot loaders often ask for
+	// PXELINUX.0 when pxelinux.0 is on disk. Of several such names, the
+	// first in byte order is chosen and a warning is logged.
+	CaseInsensitive bool
+	// Logger receives the warnings of CaseInsensitive lookups; the
+	// default is slog.Default().
+	Logger *slog.Logger
+}
+
+// ResolvePath returns the path of the file requested under root. The
+// requested name uses "/" as the separator and must be relative; it is
+// cleaned, and the result must lie within root. Absolute names and names
+// leading out of root fail with errors.ErrorAccessViolation.
+//
+// ResolvePath works on names alone and does not access the file system,
+// so a symbolic link under root may still lead outside it.
+func ResolvePath(root, requested string) (string, error) {
+	name := filepath.FromSlash(requested)
+	if strings.HasPrefix(requested, "/") || filepath.IsAbs(name) || filepath.VolumeName(name) != "" {
+		return "", errors.ErrorAccessViolation("absolute path not allowed")
+	}
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+	p := filepath.Join(root, name)
+	if !within(root, p) {
+		return "", errors.ErrorAccessViolation("path outside root")
+	}
+	return p, nil
+}
+
+// within reports whether the clean, absolute path p is dir or lies under
+// it.
+func within(dir, p string) bool {
+	if p == dir {
+		return true
+	}
+	if !strings.HasSuffix(dir, string(filepath.Separator)) {
+		dir += string(filepath.Separator)
+	}
+	return strings.HasPrefix(p, dir)
+}
+
+// path returns the path of filename under fs.Root. Names of temporary
+// files are refused, so that partly written files cannot be read.
+func (fs *FileServer) path(filename string) (string, error) {
+	p, err := ResolvePath(fs.Root, filename)
+	if err == nil && isTempName(filepath.Base(p)) {
+		err = errors.ErrorAccessViolation("temporary file")
+	}
+	if err != nil || !fs.RejectSymlinkEscapes {
+		return p, err
+	}
+	root, err := filepath.Abs(fs.Root)
+	if err == nil {
+		root, err = filepath.EvalSymlinks(root)
+	}
+	if err != nil {
+		return "", fileError(err)
+	}
+	// A file about to be written does not exist yet; check its directory.
+	resolved, err := filepath.EvalSymlinks(p)
+	if os.IsNotExist(err) {
+		resolved, err = filepath.EvalSymlinks(filepath.Dir(p))
+	}
+	if err != nil {
+		return "", fileError(err)
+	}
+	if !within(root, resolved) {
+		return "", errors.ErrorAccessViolation("path outside root")
+	}
+	return p, nil
+}
+
+// ReadFile opens filename for reading. The file is returned as an
+// *os.File, so transfers report its size and can use a Server's Cache.
+func (fs *FileServer) ReadFile(filename string) (io.ReadCloser, error) {
+	f, err := fs.open(filename)
+	var notFound errors.ErrorFileNotFound
+	if fs.CaseInsensitive && stderrors.As(err, &notFound) {
+		if folded, ok := fs.fold(filename); ok {
+			f, err = fs.open(folded)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// open opens the regular file filename under fs.Root.
+func (fs *FileServer) open(filename string) (*os.File, error) {
+	name, err := fs.path(filename)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fileError(err)
+	}
+	if fi, err := f.Stat(); err != nil || !fi.Mode().IsRegular() {
+		f.Close()
+		return nil, errors.ErrorFileNotFound("")
+	}
+	return f, nil
+}
+
+// fold returns the name of the file under fs.Root matching filename
+// regardless of case, for CaseInsensitive, and false if there is none.
+// Components that exist as named are kept; the others are replaced by the
+// first entry of their directory that is equal to them under Unicode case
+// folding.
+func (fs *FileServer) fold(filename string) (string, bool) {
+	root, err := filepath.Abs(fs.Root)
+	if err != nil {
+		return "", false
+	}
+	p, err := ResolvePath(root, filename)
+	if err != nil {
+		return "", false
+	}
+	rel, err := filepath.Rel(root, p)
+	if err != nil || rel == "." {
+		return "", false
+	}
+	dir := root
+	var parts []string
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		if _, err := os.Lstat(filepath.Join(dir, part)); err != nil {
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				return "", false
+			}
+			var matches []string
+			for _, e := range entries {
+				if strings.EqualFold(e.Name(), part) {
+					matches = append(matches, e.Name())
+				}
+			}
+			if len(matches) == 0 {
+				return "", false
+			}
+			slices.Sort(matches)
+			if len(matches) > 1 {
+				fs.logger().Warn("ambiguous case-insensitive file name", "requested", filename, "matches", matches, "chosen", matches[0])
+			}
+			part = matches[0]
+		}
+		dir = filepath.Join(dir, part)
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, "/"), true
+}
+
+func (fs *FileServer) logger() *slog.Logger {
+	if fs.Logger != nil {
+		return fs.Logger
+	}
+	return slog.Default()
+}
+
+// WriteFile creates a temporary file for filename, which Close moves
+// into place. Unless fs.AllowOverwrite is set, it fails with
+// errors.ErrorFileExists if filename exists, and so does Close if it has
+// been created since; the existence check is only an early answer, and
+// Close's commit, which cannot replace a file, is what enforces it. The
+// returned writer implements WriteAborter.
+func (fs *FileServer) WriteFile(filename string) (io.WriteCloser, error) {
+	return fs.create(filename, -1)
+}
+
+// WriteFileSize is WriteFile for a file of size bytes. It fails with
+// errors.ErrorDiskFull if the file system has less space than that left.
+func (fs *FileServer) WriteFileSize(filename string, size int64) (io.WriteCloser, error) {
+	return fs.create(filename, size)
+}
+
+// create implements WriteFile and WriteFileSize; size is negative if it
+// is not known.
+func (fs *FileServer) create(filename string, size int64) (io.WriteCloser, error) {
+	name, err := fs.path(filename)
+	if err != nil {
+		return nil, err
+	}
+	if fi, err := os.Lstat(name); err == nil {
+		if !fs.AllowOverwrite {
+			return nil, errors.ErrorFileExists("")
+		}
+		if !fi.Mode().IsRegular() {
+			return nil, errors.ErrorAccessViolation("not a regular file")
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, fileError(err)
+	}
+	dir := fs.TempDir
+	if dir == "" {
+		dir = filepath.Dir(name)
+	}
+	if size >= 0 {
+		if free, err := diskFree(dir); err == nil && uint64(size) > free {
+			return nil, errors.ErrorDiskFull("")
+		}
+	}
+	f, err := os.CreateTemp(dir, "."+filepath.Base(name)+".*"+tempSuffix)
+	if err != nil {
+		return nil, fileError(err)
+	}
+	// CreateTemp makes the file private; written files are always given
+	// mode 0644, whatever the umask.
+	if err := f.Chmod(0o644); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, fileError(err)
+	}
+	return &fileWriter{File: f, name: name, overwrite: fs.AllowOverwrite}, nil
+}
+
+// fileWriter is a temporary file being written by a client.
+type fileWriter struct {
+	*os.File
+	name      string // the file it becomes
+	overwrite bool   // whether it may replace an existing file
+}
+
+// Close closes the temporary file and moves it to the final name. Unless
+// the writer may overwrite, it links the file instead of renaming it,
+// which unlike a rename fails if the name has been taken in the meantime.
+// On file systems without hard links, it claims the name by creating it
+// exclusively and then renames the file over it, so that readers may see
+// an empty file briefly.
+func (w *fileWriter) Close() error {
+	if err := w.File.Close(); err != nil {
+		os.Remove(w.File.Name())
+		return err
+	}
+	if w.overwrite {
+		if err := os.Rename(w.File.Name(), w.name); err != nil {
+			os.Remove(w.File.Name())
+			return fileError(err)
+		}
+		return nil
+	}
+	err := link(w.File.Name(), w.name)
+	if stderrors.Is(err, stderrors.ErrUnsupported) {
+		err = w.claim()
+	}
+	os.Remove(w.File.Name())
+	if err != nil {
+		return fileError(err)
+	}
+	return nil
+}
+
+// claim creates w.name, failing if it exists, and renames the temporary
+// file over it.
+func (w *fileWriter) claim() error {
+	f, err := os.OpenFile(w.name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	f.Close()
+	if err := os.Rename(w.File.Name(), w.name); err != nil {
+		os.Remove(w.name)
+		return err
+	}
+	return nil
+}
+
+// Abort closes and removes the temporary file.
+func (w *fileWriter) Abort() error {
+	w.File.Close()
+	return os.Remove(w.File.Name())
+}
+
+// link makes a hard link. It is a variable so that tests can replace it.
+var link = os.Link
+
+const tempSuffix = ".tmp"
+
+// isTempName reports whether base is the name of a temporary file of a
+// write in progress: a dot, a name, a dot, digits and tempSuffix.
+func isTempName(base string) bool {
+	rest, ok := strings.CutSuffix(base, tempSuffix)
+	if !ok || !strings.HasPrefix(rest, ".") {
+		return false
+	}
+	i := strings.LastIndexByte(rest, '.')
+	if i <= 1 || i == len(rest)-1 {
+		return false
+	}
+	for _, c := range rest[i+1:] {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// diskFree returns the space available to unprivileged users on the file
+// system holding dir. It is a variable so that tests can replace it.
+var diskFree = statfsFree
+
+// fileError maps err, returned by the os package, to a TFTP error.
+func fileError(err error) error {
+	switch {
+	case os.IsNotExist(err):
+		return errors.ErrorFileNotFound("")
+	case os.IsPermission(err):
+		return errors.ErrorAccessViolation("")
+	case os.IsExist(err):
+		return errors.ErrorFileExists("")
+	}
+	return err
+}
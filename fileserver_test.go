@@ -0,0 +1,411 @@
+package tftp_test
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	tftp "github.com/doodles526/go-tftp"
+	"github.com/doodles526/go-tftp/errors"
+	"github.com/doodles526/go-tftp/tftptest"
+)
+
+// entries returns the names in dir.
+func entries(t *testing.T, dir string) []string {
+	t.Helper()
+	des, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, de := range des {
+		names = append(names, de.Name())
+	}
+	return names
+}
+
+func TestFileServerAbortedWrite(t *testing.T) {
+	dir := t.TempDir()
+	n := tftptest.NewNetwork(1)
+	done := make(completions, 2)
+	addr := serve(t, n, &tftp.Server{Handler: &tftp.FileServer{Root: dir}, OnTransferComplete: done.hook})
+	c := &tftp.Client{Addr: addr, Transport: n}
+	// The client's reader fails after two blocks have been sent.
+	_, err := c.Put("f", io.MultiReader(&io.LimitedReader{R: zeros{}, N: 1024}, errorReader{io.ErrClosedPipe}))
+	if err == nil {
+		t.Fatal("Put succeeded")
+	}
+	if info := done.next(t); info.Err == nil || info.Bytes != 1024 {
+		t.Errorf("aborted write reported as %+v", info)
+	}
+	if names := entries(t, dir); len(names) != 0 {
+		t.Errorf("aborted write left %q", names)
+	}
+}
+
+// gateReader returns the bytes of data up to at, then blocks until
+// release is closed before returning the rest.
+type gateReader struct {
+	data    []byte
+	at      int
+	reached chan struct{}
+	release chan struct{}
+	off     int
+}
+
+func (r *gateReader) Read(b []byte) (int, error) {
+	if r.off == r.at && r.reached != nil {
+		close(r.reached)
+		r.reached = nil
+		<-r.release
+	}
+	if r.off == len(r.data) {
+		return 0, io.EOF
+	}
+	end := len(r.data)
+	if r.off < r.at {
+		end = r.at
+	}
+	n := copy(b, r.data[r.off:end])
+	r.off += n
+	return n, nil
+}
+
+// putHalted starts a Put of data as filename that halts after the first
+// block, and returns once the server has accepted the request, with a
+// function that resumes the transfer and returns its result.
+func putHalted(t *testing.T, c *tftp.Client, filename string, data []byte) func() error {
+	t.Helper()
+	reached := make(chan struct{})
+	r := &gateReader{data: data, at: 512, reached: reached, release: make(chan struct{})}
+	result := make(chan error, 1)
+	go func() {
+		_, err := c.Put(filename, r)
+		result <- err
+	}()
+	<-reached
+	return func() error {
+		close(r.release)
+		return <-result
+	}
+}
+
+func TestFileServerAtomicWrite(t *testing.T) {
+	dir := t.TempDir()
+	n := tftptest.NewNetwork(1)
+	done := make(completions, 2)
+	addr := serve(t, n, &tftp.Server{Handler: &tftp.FileServer{Root: dir}, OnTransferComplete: done.hook})
+	c := &tftp.Client{Addr: addr, Transport: n}
+	data := file(2000)
+	resume := putHalted(t, c, "f", data)
+	names := entries(t, dir)
+	if len(names) != 1 || names[0] == "f" {
+		t.Fatalf("during the transfer the directory holds %q, want only a temporary file", names)
+	}
+	// The partly written file cannot be read.
+	if _, err := c.Get(names[0], io.Discard); !isAccessViolation(err) {
+		t.Errorf("Get of the temporary file: %#v, want ErrorAccessViolation", err)
+	}
+	done.next(t)
+	if err := resume(); err != nil {
+		t.Fatal(err)
+	}
+	if info := done.next(t); info.Err != nil {
+		t.Fatal(info.Err)
+	}
+	if names := entries(t, dir); len(names) != 1 || names[0] != "f" {
+		t.Errorf("after the transfer the directory holds %q, want only f", names)
+	}
+	b, err := os.ReadFile(filepath.Join(dir, "f"))
+	if err != nil || !bytes.Equal(b, data) {
+		t.Errorf("f holds %d bytes, %v; want the %d sent", len(b), err, len(data))
+	}
+	fi, err := os.Stat(filepath.Join(dir, "f"))
+	if err != nil || fi.Mode().Perm() != 0o644 {
+		t.Errorf("f has mode %v, %v; want 0644", fi.Mode(), err)
+	}
+}
+
+func TestFileServerWriteExisting(t *testing.T) {
+	dir := t.TempDir()
+	old := []byte("old contents")
+	if err := os.WriteFile(filepath.Join(dir, "f"), old, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	n := tftptest.NewNetwork(1)
+	var tr traffic
+	tr.watch(n)
+	done := make(completions, 2)
+	addr := serve(t, n, &tftp.Server{Handler: &tftp.FileServer{Root: dir}, OnTransferComplete: done.hook})
+	c := &tftp.Client{Addr: addr, Transport: n}
+
+	// Refused before any data is sent.
+	_, err := c.Put("f", bytes.NewReader(file(100)))
+	if _, ok := err.(errors.ErrorFileExists); !ok {
+		t.Errorf("Put of an existing file: %#v, want ErrorFileExists", err)
+	}
+	if want := "[WRQ ERROR 6]"; tr.String() != want {
+		t.Errorf("traffic %s, want %s", tr.String(), want)
+	}
+	done.next(t)
+	if b, _ := os.ReadFile(filepath.Join(dir, "f")); !bytes.Equal(b, old) {
+		t.Errorf("f was replaced by a refused write")
+	}
+
+	// Created by someone else while the transfer runs: the commit fails
+	// and the other file is kept.
+	resume := putHalted(t, c, "g", file(2000))
+	if err := os.WriteFile(filepath.Join(dir, "g"), old, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	resume()
+	info := done.next(t)
+	if _, ok := info.Err.(errors.ErrorFileExists); !ok {
+		t.Errorf("write of a file created meanwhile reported %#v, want ErrorFileExists", info.Err)
+	}
+	if b, _ := os.ReadFile(filepath.Join(dir, "g")); !bytes.Equal(b, old) {
+		t.Errorf("g was replaced by a write that started before it existed")
+	}
+	if names := entries(t, dir); len(names) != 2 {
+		t.Errorf("directory holds %q, want f and g", names)
+	}
+}
+
+func TestFileServerAllowOverwrite(t *testing.T) {
+	dir := t.TempDir()
+	old := []byte("old contents")
+	if err := os.WriteFile(filepath.Join(dir, "f"), old, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "d"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	n := tftptest.NewNetwork(1)
+	done := make(completions, 2)
+	addr := serve(t, n, &tftp.Server{Handler: &tftp.FileServer{Root: dir, AllowOverwrite: true}, OnTransferComplete: done.hook})
+	c := &tftp.Client{Addr: addr, Transport: n}
+
+	// Readers see the old file until the new one is complete.
+	data := file(2000)
+	resume := putHalted(t, c, "f", data)
+	if b, _ := os.ReadFile(filepath.Join(dir, "f")); !bytes.Equal(b, old) {
+		t.Errorf("f changed during the transfer")
+	}
+	if err := resume(); err != nil {
+		t.Fatal(err)
+	}
+	if info := done.next(t); info.Err != nil {
+		t.Fatal(info.Err)
+	}
+	if b, _ := os.ReadFile(filepath.Join(dir, "f")); !bytes.Equal(b, data) {
+		t.Errorf("f holds %d bytes, want the %d sent", len(b), len(data))
+	}
+	if names := entries(t, dir); len(names) != 2 {
+		t.Errorf("directory holds %q, want d and f", names)
+	}
+
+	// Only regular files are replaced.
+	_, err := c.Put("d", bytes.NewReader(file(100)))
+	if _, ok := err.(errors.ErrorAccessViolation); !ok {
+		t.Errorf("Put over a directory: %#v, want ErrorAccessViolation", err)
+	}
+}
+
+func TestFileServerWithoutHardLinks(t *testing.T) {
+	saved := *tftp.Link
+	*tftp.Link = func(oldname, newname string) error {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: syscall.EOPNOTSUPP}
+	}
+	t.Cleanup(func() { *tftp.Link = saved })
+
+	dir := t.TempDir()
+	n := tftptest.NewNetwork(1)
+	done := make(completions, 2)
+	addr := serve(t, n, &tftp.Server{Handler: &tftp.FileServer{Root: dir}, OnTransferComplete: done.hook})
+	c := &tftp.Client{Addr: addr, Transport: n}
+	data := file(2000)
+	if _, err := c.Put("f", bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	if info := done.next(t); info.Err != nil {
+		t.Fatal(info.Err)
+	}
+	if b, _ := os.ReadFile(filepath.Join(dir, "f")); !bytes.Equal(b, data) {
+		t.Errorf("f holds %d bytes, want the %d sent", len(b), len(data))
+	}
+
+	// A file created meanwhile is still not replaced.
+	old := []byte("old contents")
+	resume := putHalted(t, c, "g", file(2000))
+	if err := os.WriteFile(filepath.Join(dir, "g"), old, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	resume()
+	if _, ok := done.next(t).Err.(errors.ErrorFileExists); !ok {
+		t.Error("write of a file created meanwhile did not fail with ErrorFileExists")
+	}
+	if b, _ := os.ReadFile(filepath.Join(dir, "g")); !bytes.Equal(b, old) {
+		t.Errorf("g was replaced by a write that started before it existed")
+	}
+	if names := entries(t, dir); len(names) != 2 {
+		t.Errorf("directory holds %q, want f and g", names)
+	}
+}
+
+func TestResolvePath(t *testing.T) {
+	root := filepath.FromSlash("/srv/tftp")
+	for _, c := range []struct {
+		requested string
+		want      string // empty if refused
+	}{
+		{"../../etc/passwd", ""},
+		{"/etc/passwd", ""},
+		{"boot/../../etc/passwd", ""},
+		{"boot/x86/pxelinux.0", "/srv/tftp/boot/x86/pxelinux.0"},
+		{"boot/../pxelinux.0", "/srv/tftp/pxelinux.0"},
+	} {
+		p, err := tftp.ResolvePath(root, c.requested)
+		if c.want == "" {
+			if !isAccessViolation(err) {
+				t.Errorf("ResolvePath(%q) = %q, %#v; want ErrorAccessViolation", c.requested, p, err)
+			}
+		} else if err != nil || p != filepath.FromSlash(c.want) {
+			t.Errorf("ResolvePath(%q) = %q, %v; want %q", c.requested, p, err, c.want)
+		}
+	}
+}
+
+func TestFileServerSymlinkEscape(t *testing.T) {
+	root, outside := t.TempDir(), t.TempDir()
+	if err := os.WriteFile(filepath.Join(outside, "secret"), []byte("secret"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "out")); err != nil {
+		t.Skipf("cannot create symbolic links: %v", err)
+	}
+	fs := &tftp.FileServer{Root: root}
+	r, err := fs.ReadFile("out/secret")
+	if err != nil {
+		t.Fatalf("link followed by default: %v", err)
+	}
+	r.Close()
+
+	fs.RejectSymlinkEscapes = true
+	if _, err := fs.ReadFile("out/secret"); !isAccessViolation(err) {
+		t.Errorf("ReadFile through the link: %#v, want ErrorAccessViolation", err)
+	}
+	if _, err := fs.WriteFile("out/new"); !isAccessViolation(err) {
+		t.Errorf("WriteFile through the link: %#v, want ErrorAccessViolation", err)
+	}
+	if names := entries(t, outside); len(names) != 1 {
+		t.Errorf("outside root: %q", names)
+	}
+}
+
+func isAccessViolation(err error) bool {
+	_, ok := err.(errors.ErrorAccessViolation)
+	return ok
+}
+
+func TestFileServerDiskFull(t *testing.T) {
+	// The file system has 1000 bytes free.
+	saved := *tftp.DiskFree
+	*tftp.DiskFree = func(dir string) (uint64, error) { return 1000, nil }
+	t.Cleanup(func() { *tftp.DiskFree = saved })
+
+	dir := t.TempDir()
+	n := tftptest.NewNetwork(1)
+	var tr traffic
+	tr.watch(n)
+	addr := serve(t, n, &tftp.Server{Handler: &tftp.FileServer{Root: dir}})
+	// OnProgress makes Put send tsize.
+	c := &tftp.Client{Addr: addr, Transport: n, OnProgress: func(transferred, total int64) {}}
+
+	_, err := c.Put("big", bytes.NewReader(file(5000)))
+	if _, ok := err.(errors.ErrorDiskFull); !ok {
+		t.Errorf("Put of 5000 bytes: %#v, want ErrorDiskFull", err)
+	}
+	// Refused in answer to the request, before any DATA.
+	if want := "[WRQ ERROR 3]"; tr.String() != want {
+		t.Errorf("traffic %s, want %s", tr.String(), want)
+	}
+	if names := entries(t, dir); len(names) != 0 {
+		t.Errorf("refused write left %q", names)
+	}
+
+	if _, err := c.Put("small", bytes.NewReader(file(500))); err != nil {
+		t.Errorf("Put of 500 bytes: %v", err)
+	}
+	// Without tsize the size is unknown and the write is accepted.
+	c.OnProgress = nil
+	if _, err := c.Put("unknown", bytes.NewReader(file(5000))); err != nil {
+		t.Errorf("Put without tsize: %v", err)
+	}
+}
+
+func TestFileServerCaseInsensitive(t *testing.T) {
+	dir := t.TempDir()
+	for name, data := range map[string]string{
+		"pxelinux.0":    "loader",
+		"boot/Menu.cfg": "menu",
+		"A.txt":         "upper",
+		"a.txt":         "lower",
+	} {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var log bytes.Buffer
+	fs := &tftp.FileServer{Root: dir, CaseInsensitive: true, Logger: slog.New(slog.NewTextHandler(&log, nil))}
+	read := func(name string) (string, error) {
+		f, err := fs.ReadFile(name)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		b, err := io.ReadAll(f)
+		return string(b), err
+	}
+	for name, want := range map[string]string{
+		"PXELINUX.0":    "loader",
+		"pxelinux.0":    "loader",
+		"BOOT/menu.CFG": "menu",
+		"a.txt":         "lower",
+		// Of several matches, the first in byte order.
+		"A.TXT": "upper",
+	} {
+		if got, err := read(name); got != want || err != nil {
+			t.Errorf("%s: read %q, %v; want %q", name, got, err, want)
+		}
+	}
+	if !strings.Contains(log.String(), "ambiguous") || strings.Count(log.String(), "\n") != 1 {
+		t.Errorf("logged %q, want one warning about A.TXT", log.String())
+	}
+	for _, name := range []string{"missing.0", "boot/missing.cfg", "nothing/menu.cfg"} {
+		if _, err := read(name); err == nil {
+			t.Errorf("%s: found", name)
+		} else if _, ok := err.(errors.ErrorFileNotFound); !ok {
+			t.Errorf("%s: %#v, want ErrorFileNotFound", name, err)
+		}
+	}
+	// Folding does not get around ResolvePath.
+	if _, err := read("../PXELINUX.0"); err == nil {
+		t.Error("../PXELINUX.0: found")
+	} else if _, ok := err.(errors.ErrorAccessViolation); !ok {
+		t.Errorf("../PXELINUX.0: %#v, want ErrorAccessViolation", err)
+	}
+	// Off by default.
+	fs.CaseInsensitive = false
+	if _, err := read("PXELINUX.0"); err == nil {
+		t.Error("PXELINUX.0 found without CaseInsensitive")
+	}
+}
@@ -0,0 +1,394 @@
+package tftp_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	tftp "github.com/doodles526/go-tftp"
+	"github.com/doodles526/go-tftp/errors"
+	"github.com/doodles526/go-tftp/packets"
+	"github.com/doodles526/go-tftp/tftptest"
+	"github.com/doodles526/go-tftp/transfer"
+)
+
+// traffic logs the datagrams sent on a Network, as the opcode followed
+// by the block number or error code where there is one.
+type traffic struct {
+	mu  sync.Mutex
+	log []string
+}
+
+// watch makes t log the traffic on n, which must have no other Fault.
+func (t *traffic) watch(n *tftptest.Network) {
+	n.Fault = func(d *tftptest.Datagram) tftptest.Action {
+		op := packets.Opcode(binary.BigEndian.Uint16(d.Data))
+		s := op.String()
+		switch op {
+		case packets.OpDATA, packets.OpACK, packets.OpERROR:
+			s = fmt.Sprintf("%v %d", op, binary.BigEndian.Uint16(d.Data[2:]))
+		}
+		t.mu.Lock()
+		t.log = append(t.log, s)
+		t.mu.Unlock()
+		return tftptest.Deliver
+	}
+}
+
+// reset discards the traffic logged so far.
+func (t *traffic) reset() {
+	t.mu.Lock()
+	t.log = nil
+	t.mu.Unlock()
+}
+
+func (t *traffic) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return fmt.Sprint(t.log)
+}
+
+func TestGetAcknowledgesOptionAck(t *testing.T) {
+	n := tftptest.NewNetwork(1)
+	var tr traffic
+	tr.watch(n)
+	data := file(1500)
+	addr := serve(t, n, &tftp.Server{Handler: newMemHandler(map[string][]byte{"f": data})})
+	var buf bytes.Buffer
+	if _, err := (&tftp.Client{Addr: addr, Transport: n, BlockSize: 1024}).Get("f", &buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), data) {
+		t.Error("wrong contents")
+	}
+	want := "[RRQ OACK ACK 0 DATA 1 ACK 1 DATA 2 ACK 2]"
+	if got := tr.String(); got != want {
+		t.Errorf("traffic %s, want %s", got, want)
+	}
+}
+
+func TestGetWithoutOptionAck(t *testing.T) {
+	n := tftptest.NewNetwork(1)
+	var tr traffic
+	tr.watch(n)
+	addr := serve(t, n, &tftp.Server{Handler: newMemHandler(map[string][]byte{"f": file(100)})})
+	if _, err := (&tftp.Client{Addr: addr, Transport: n}).Get("f", &bytes.Buffer{}); err != nil {
+		t.Fatal(err)
+	}
+	// No options, so DATA 1 answers the request and there is no ACK 0.
+	want := "[RRQ DATA 1 ACK 1]"
+	if got := tr.String(); got != want {
+		t.Errorf("traffic %s, want %s", got, want)
+	}
+}
+
+func TestPutOptionAck(t *testing.T) {
+	n := tftptest.NewNetwork(1)
+	var tr traffic
+	tr.watch(n)
+	h := newMemHandler(nil)
+	done := make(chan struct{})
+	addr := serve(t, n, &tftp.Server{Handler: h, OnTransferComplete: func(tftp.TransferInfo) { close(done) }})
+	data := file(1500)
+	if _, err := (&tftp.Client{Addr: addr, Transport: n, BlockSize: 1024}).Put("f", bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	<-done
+	if b, _ := h.file("f"); !bytes.Equal(b, data) {
+		t.Error("wrong contents stored")
+	}
+	// DATA 1 answers the OACK; there is no ACK 0.
+	want := "[WRQ OACK DATA 1 ACK 1 DATA 2 ACK 2]"
+	if got := tr.String(); got != want {
+		t.Errorf("traffic %s, want %s", got, want)
+	}
+}
+
+// request sends p to addr from a new socket on n and returns the socket
+// and the reply.
+func request(t *testing.T, n *tftptest.Network, addr string, p packets.Packet) (net.PacketConn, packets.Packet, net.Addr) {
+	t.Helper()
+	conn, err := n.ListenPacket("udp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	to, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := p.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.WriteTo(b, to); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 65536)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	m, from, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply, err := packets.Decode(buf[:m])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn, reply, from
+}
+
+func TestPutOptionAckRefused(t *testing.T) {
+	n := tftptest.NewNetwork(1)
+	h := newMemHandler(nil)
+	done := make(chan tftp.TransferInfo, 1)
+	addr := serve(t, n, &tftp.Server{Handler: h, OnTransferComplete: func(info tftp.TransferInfo) { done <- info }})
+	wrq, _ := packets.NewWriteRequest("f", "", packets.WithBlockSize(1024))
+	conn, reply, tid := request(t, n, addr, wrq)
+	if oack, ok := reply.(*packets.OptionAckPacket); !ok || oack.Options[packets.OptionBlockSize] != "1024" {
+		t.Fatalf("reply %+v, want an OACK of blksize 1024", reply)
+	}
+	// The client cannot use the options after all.
+	b, _ := packets.ErrorToPacket(errors.ErrorOptionNegotiation("no thanks")).Encode()
+	conn.WriteTo(b, tid)
+	info := <-done
+	if _, ok := info.Err.(errors.ErrorOptionNegotiation); !ok {
+		t.Errorf("transfer ended with %#v, want the client's ErrorOptionNegotiation", info.Err)
+	}
+	if _, ok := h.file("f"); ok {
+		t.Error("aborted write stored a file")
+	}
+}
+
+func TestPutBadTransferSize(t *testing.T) {
+	n := tftptest.NewNetwork(1)
+	addr := serve(t, n, &tftp.Server{Handler: newMemHandler(nil)})
+	for _, size := range []string{"-5", "big"} {
+		wrq, _ := packets.NewWriteRequest("f", "", packets.WithOption(packets.OptionTransferSize, size))
+		_, reply, _ := request(t, n, addr, wrq)
+		// The only option is dropped, so the request is accepted with
+		// ACK 0.
+		if ack, ok := reply.(*packets.AckPacket); !ok || ack.BlockNumber != 0 {
+			t.Errorf("tsize %s: reply %+v, want ACK 0", size, reply)
+		}
+	}
+}
+
+// scriptedServer listens on n for requests that the test answers by
+// hand.
+type scriptedServer struct {
+	t        *testing.T
+	listener net.PacketConn
+	tid      net.PacketConn // the transfer's socket
+	client   net.Addr
+}
+
+func newScriptedServer(t *testing.T, n *tftptest.Network) *scriptedServer {
+	t.Helper()
+	l, err := n.ListenPacket("udp", "127.0.0.1:69")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tid, err := n.ListenPacket("udp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		l.Close()
+		tid.Close()
+	})
+	return &scriptedServer{t: t, listener: l, tid: tid}
+}
+
+// accept reads a request and returns it, answering the client from then
+// on from the transfer's socket.
+func (s *scriptedServer) accept() packets.Packet {
+	s.t.Helper()
+	buf := make([]byte, 65536)
+	s.listener.SetReadDeadline(time.Now().Add(time.Second))
+	m, client, err := s.listener.ReadFrom(buf)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	p, err := packets.Decode(buf[:m])
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	s.client = client
+	return p
+}
+
+func (s *scriptedServer) send(p packets.Packet) {
+	b, _ := p.Encode()
+	s.tid.WriteTo(b, s.client)
+}
+
+// expect fails unless the next packet from the client is want.
+func (s *scriptedServer) expect(want packets.Packet) {
+	s.t.Helper()
+	if p := readReply(s.t, s.tid); !packets.Equal(p, want) {
+		s.t.Fatalf("client sent %+v, want %+v", p, want)
+	}
+}
+
+// quiet fails if the client sends anything within 100ms.
+func (s *scriptedServer) quiet() {
+	s.t.Helper()
+	buf := make([]byte, 65536)
+	s.tid.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if m, _, err := s.tid.ReadFrom(buf); err == nil {
+		p, _ := packets.Decode(buf[:m])
+		s.t.Fatalf("client sent %+v", p)
+	}
+}
+
+func TestOptionAckLargerThanRequested(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		oack map[string]string
+	}{
+		{"blksize", map[string]string{packets.OptionBlockSize: "1468"}},
+		{"windowsize", map[string]string{packets.OptionWindowSize: "16"}},
+		{"timeout", map[string]string{packets.OptionTimeout: "5"}},
+		{"unrequested", map[string]string{"vendorfoo": "bar"}},
+	} {
+		n := tftptest.NewNetwork(1)
+		s := newScriptedServer(t, n)
+		cl := &tftp.Client{Addr: s.listener.LocalAddr().String(), Transport: n, BlockSize: 1024, WindowSize: 4, Timeout: 2 * time.Second}
+		result := make(chan error, 1)
+		go func() {
+			_, err := cl.Get("f", &bytes.Buffer{})
+			result <- err
+		}()
+		s.accept()
+		s.send(&packets.OptionAckPacket{Options: c.oack})
+		if e, ok := readReply(t, s.tid).(*packets.ErrorPacket); !ok || e.ErrorCode != packets.ErrCodeOptionNegotiation {
+			t.Errorf("%s: client answered %+v, want ERROR 8", c.name, e)
+		}
+		if _, ok := (<-result).(errors.ErrorOptionNegotiation); !ok {
+			t.Errorf("%s: Get did not fail with ErrorOptionNegotiation", c.name)
+		}
+	}
+}
+
+func TestGetDuplicateOptionAck(t *testing.T) {
+	n := tftptest.NewNetwork(1)
+	s := newScriptedServer(t, n)
+	c := &tftp.Client{Addr: s.listener.LocalAddr().String(), Transport: n, BlockSize: 1024}
+	result := make(chan []byte, 1)
+	go func() {
+		var buf bytes.Buffer
+		if _, err := c.Get("f", &buf); err != nil {
+			t.Error(err)
+		}
+		result <- buf.Bytes()
+	}()
+	s.accept()
+	oack := &packets.OptionAckPacket{Options: map[string]string{packets.OptionBlockSize: "1024"}}
+	s.send(oack)
+	s.expect(&packets.AckPacket{BlockNumber: 0})
+	// The server missed ACK 0 and sends its OACK again.
+	s.send(oack)
+	s.expect(&packets.AckPacket{BlockNumber: 0})
+	s.send(&packets.DataPacket{BlockNumber: 1, Data: file(100)})
+	s.expect(&packets.AckPacket{BlockNumber: 1})
+	if b := <-result; !bytes.Equal(b, file(100)) {
+		t.Errorf("Get returned %d bytes", len(b))
+	}
+}
+
+func TestGetEarlyData(t *testing.T) {
+	n := tftptest.NewNetwork(1)
+	s := newScriptedServer(t, n)
+	c := &tftp.Client{Addr: s.listener.LocalAddr().String(), Transport: n, BlockSize: 1024}
+	result := make(chan []byte, 1)
+	go func() {
+		var buf bytes.Buffer
+		if _, err := c.Get("f", &buf); err != nil {
+			t.Error(err)
+		}
+		result <- buf.Bytes()
+	}()
+	s.accept()
+	// DATA 1 follows the OACK without waiting for ACK 0.
+	s.send(&packets.OptionAckPacket{Options: map[string]string{packets.OptionBlockSize: "1024"}})
+	s.send(&packets.DataPacket{BlockNumber: 1, Data: file(1024)})
+	s.expect(&packets.AckPacket{BlockNumber: 0})
+	s.expect(&packets.AckPacket{BlockNumber: 1})
+	s.send(&packets.DataPacket{BlockNumber: 2, Data: file(10)})
+	s.expect(&packets.AckPacket{BlockNumber: 2})
+	if b := <-result; len(b) != 1034 {
+		t.Errorf("Get returned %d bytes, want 1034", len(b))
+	}
+}
+
+func TestPutDuplicateOptionAck(t *testing.T) {
+	n := tftptest.NewNetwork(1)
+	s := newScriptedServer(t, n)
+	c := &tftp.Client{Addr: s.listener.LocalAddr().String(), Transport: n, BlockSize: 1024}
+	result := make(chan error, 1)
+	go func() {
+		_, err := c.Put("f", bytes.NewReader(file(100)))
+		result <- err
+	}()
+	s.accept()
+	oack := &packets.OptionAckPacket{Options: map[string]string{packets.OptionBlockSize: "1024"}}
+	s.send(oack)
+	s.expect(&packets.DataPacket{BlockNumber: 1, Data: file(100)})
+	// A repeated OACK, once DATA flows, is stale: it neither fails the
+	// transfer nor makes the client send DATA 1 again.
+	s.send(oack)
+	s.quiet()
+	s.send(&packets.AckPacket{BlockNumber: 1})
+	if err := <-result; err != nil {
+		t.Errorf("Put: %v", err)
+	}
+}
+
+func TestPutStartsOnAckZero(t *testing.T) {
+	n := tftptest.NewNetwork(1)
+	s := newScriptedServer(t, n)
+	c := &tftp.Client{Addr: s.listener.LocalAddr().String(), Transport: n}
+	data := file(1000)
+	result := make(chan error, 1)
+	go func() {
+		_, err := c.Put("f", bytes.NewReader(data))
+		result <- err
+	}()
+	if wrq, ok := s.accept().(*packets.WriteRequestPacket); !ok || wrq.Options != nil {
+		t.Fatalf("request %+v, want a WRQ without options", wrq)
+	}
+	// ACK 0 accepts the request: block 1 follows.
+	s.send(&packets.AckPacket{BlockNumber: 0})
+	s.expect(&packets.DataPacket{BlockNumber: 1, Data: data[:512]})
+	s.send(&packets.AckPacket{BlockNumber: 1})
+	s.expect(&packets.DataPacket{BlockNumber: 2, Data: data[512:]})
+	// Once DATA flows, an ACK 0 is stale and ignored.
+	s.send(&packets.AckPacket{BlockNumber: 0})
+	s.quiet()
+	s.send(&packets.AckPacket{BlockNumber: 2})
+	if err := <-result; err != nil {
+		t.Errorf("Put: %v", err)
+	}
+}
+
+func TestStrayAckZeroRejected(t *testing.T) {
+	n := tftptest.NewNetwork(1)
+	addr := serve(t, n, &tftp.Server{
+		Handler:   newMemHandler(map[string][]byte{"f": file(1000)}),
+		AckPolicy: transfer.RejectUnexpectedAcks,
+	})
+	conn, reply, tid := request(t, n, addr, &packets.ReadRequestPacket{Filename: "f", Mode: packets.ModeOctet})
+	if d, ok := reply.(*packets.DataPacket); !ok || d.BlockNumber != 1 {
+		t.Fatalf("reply %+v, want DATA 1", reply)
+	}
+	// Without options there is no handshake to acknowledge.
+	b, _ := (&packets.AckPacket{BlockNumber: 0}).Encode()
+	conn.WriteTo(b, tid)
+	if e, ok := readReply(t, conn).(*packets.ErrorPacket); !ok || e.ErrorCode != packets.ErrCodeIllegalOperation {
+		t.Errorf("stray ACK 0 answered with %+v, want ERROR 4", e)
+	}
+}
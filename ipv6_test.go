@@ -0,0 +1,42 @@
+package tftp_test
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	tftp "github.com/doodles526/go-tftp"
+)
+
+func TestIPv6Loopback(t *testing.T) {
+	l, err := net.ListenPacket("udp6", "[::1]:0")
+	if err != nil {
+		t.Skipf("IPv6 loopback unavailable: %v", err)
+	}
+	h := newMemHandler(map[string][]byte{"down": file(3000)})
+	done := make(chan tftp.TransferInfo, 2)
+	s := &tftp.Server{Handler: h, OnTransferComplete: func(info tftp.TransferInfo) { done <- info }}
+	go s.Serve(l)
+	defer s.Close()
+	c := &tftp.Client{Addr: l.LocalAddr().String()}
+
+	var buf bytes.Buffer
+	if _, err := c.Get("down", &buf); err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), file(3000)) {
+		t.Error("Get: wrong contents")
+	}
+	<-done
+
+	if _, err := c.Put("up", bytes.NewReader(file(1000))); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	info := <-done
+	if b, _ := h.file("up"); !bytes.Equal(b, file(1000)) {
+		t.Error("Put: wrong contents stored")
+	}
+	if ip := info.Remote.(*net.UDPAddr).IP; !ip.Equal(net.IPv6loopback) {
+		t.Errorf("Put came from %v, want ::1", info.Remote)
+	}
+}
@@ -0,0 +1,100 @@
+package tftp_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+
+	tftp "github.com/doodles526/go-tftp"
+	"github.com/doodles526/go-tftp/errors"
+	"github.com/doodles526/go-tftp/tftptest"
+)
+
+// captureHandler is a slog.Handler that keeps every record it handles,
+// with the attributes added by Logger.With.
+type captureHandler struct {
+	mu      *sync.Mutex
+	records *[]map[string]slog.Value
+	attrs   []slog.Attr
+}
+
+func newCaptureHandler() *captureHandler {
+	return &captureHandler{mu: new(sync.Mutex), records: new([]map[string]slog.Value)}
+}
+
+func (h *captureHandler) Enabled(context.Context, slog.Level) bool { return true }
+
+func (h *captureHandler) Handle(_ context.Context, r slog.Record) error {
+	m := map[string]slog.Value{"msg": slog.StringValue(r.Message)}
+	for _, a := range h.attrs {
+		m[a.Key] = a.Value
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		m[a.Key] = a.Value
+		return true
+	})
+	h.mu.Lock()
+	*h.records = append(*h.records, m)
+	h.mu.Unlock()
+	return nil
+}
+
+func (h *captureHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	c := *h
+	c.attrs = append(append([]slog.Attr(nil), h.attrs...), attrs...)
+	return &c
+}
+
+func (h *captureHandler) WithGroup(string) slog.Handler { return h }
+
+// find returns the first record with message msg.
+func (h *captureHandler) find(msg string) map[string]slog.Value {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, r := range *h.records {
+		if r["msg"].String() == msg {
+			return r
+		}
+	}
+	return nil
+}
+
+func TestLoggerMissingFile(t *testing.T) {
+	n := tftptest.NewNetwork(1)
+	h := newCaptureHandler()
+	done := make(chan struct{}, 1)
+	addr := serve(t, n, &tftp.Server{
+		Handler:            newMemHandler(nil),
+		Logger:             slog.New(h),
+		OnTransferComplete: func(tftp.TransferInfo) { done <- struct{}{} },
+	})
+	_, err := (&tftp.Client{Addr: addr, Transport: n}).Get("missing", io.Discard)
+	if _, ok := err.(errors.ErrorFileNotFound); !ok {
+		t.Fatalf("Get: %#v, want ErrorFileNotFound", err)
+	}
+	// The server logs the outcome before reporting completion.
+	<-done
+	req := h.find("request received")
+	if req == nil {
+		t.Fatal("request not logged")
+	}
+	if req["filename"].String() != "missing" || req["mode"].String() != "octet" || req["remote"].String() == "" {
+		t.Errorf("request logged as %v", req)
+	}
+	sent := h.find("error sent")
+	if sent == nil {
+		t.Fatal("error not logged")
+	}
+	if code := sent["code"]; code.Kind() != slog.KindUint64 || code.Uint64() != 1 {
+		t.Errorf("error sent with code %v, want 1", code)
+	}
+	failed := h.find("transfer failed")
+	if failed == nil {
+		t.Fatal("failure not logged")
+	}
+	if _, ok := failed["error"].Any().(errors.ErrorFileNotFound); !ok {
+		t.Errorf("failure logged with error %v, want ErrorFileNotFound", failed["error"])
+	}
+}
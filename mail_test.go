@@ -0,0 +1,38 @@
+package tftp_test
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	tftp "github.com/doodles526/go-tftp"
+	"github.com/doodles526/go-tftp/errors"
+	"github.com/doodles526/go-tftp/tftptest"
+)
+
+func TestMailMode(t *testing.T) {
+	n := tftptest.NewNetwork(1)
+	type mail struct{ user, body string }
+	got := make(chan mail, 1)
+	addr := serve(t, n, &tftp.Server{
+		Handler: newMemHandler(nil),
+		MailHandler: func(username string, r io.Reader) error {
+			b, err := io.ReadAll(r)
+			got <- mail{username, string(b)}
+			return err
+		},
+	})
+	c := &tftp.Client{Addr: addr, Transport: n, Mode: "mail"}
+	msg := "Subject: hello\n\nmail over tftp\n"
+	if _, err := c.Put("root", strings.NewReader(msg)); err != nil {
+		t.Fatal(err)
+	}
+	// The final ACK can reach the client before the handler returns.
+	if m := <-got; m.user != "root" || m.body != msg {
+		t.Errorf("MailHandler got %q, %q; want %q, %q", m.user, m.body, "root", msg)
+	}
+	_, err := c.Get("root", io.Discard)
+	if _, ok := err.(errors.ErrorIllegalOperation); !ok {
+		t.Errorf("mail-mode RRQ: %#v, want ErrorIllegalOperation", err)
+	}
+}
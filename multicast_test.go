@@ -0,0 +1,190 @@
+package tftp_test
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	tftp "github.com/doodles526/go-tftp"
+	"github.com/doodles526/go-tftp/packets"
+)
+
+// loopbackMulticast joins a multicast group on the loopback interface and
+// skips the test unless a datagram sent to the group comes back.
+func loopbackMulticast(t *testing.T) (*net.Interface, *net.UDPAddr) {
+	t.Helper()
+	lo, err := net.InterfaceByName("lo")
+	if err != nil || lo.Flags&net.FlagMulticast == 0 {
+		t.Skip("no multicast loopback interface")
+	}
+	c, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := c.LocalAddr().(*net.UDPAddr).Port
+	c.Close()
+	group := &net.UDPAddr{IP: net.IPv4(239, 255, 69, 69), Port: port}
+	r, err := net.ListenMulticastUDP("udp4", lo, group)
+	if err != nil {
+		t.Skipf("cannot join multicast group: %v", err)
+	}
+	defer r.Close()
+	s, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if _, err := s.WriteTo([]byte("probe"), group); err != nil {
+		t.Skipf("cannot send to multicast group: %v", err)
+	}
+	r.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	if _, _, err := r.ReadFrom(make([]byte, 16)); err != nil {
+		t.Skipf("multicast not looped back: %v", err)
+	}
+	return lo, group
+}
+
+// multicastServer is a scripted RFC 2090 server for one file. It makes
+// the first client to ask the master and sends DATA to the group, then
+// hands the master role to the second, which acknowledges what it holds
+// and is sent anything it missed.
+type multicastServer struct {
+	t         *testing.T
+	listener  net.PacketConn
+	conn      net.PacketConn // the transfer's socket, the TID for both clients
+	group     *net.UDPAddr
+	data      []byte
+	blockSize int
+}
+
+func (m *multicastServer) send(p packets.Packet, to net.Addr) {
+	b, err := p.Encode()
+	if err != nil {
+		m.t.Error(err)
+		return
+	}
+	m.conn.WriteTo(b, to)
+}
+
+func (m *multicastServer) oack(to net.Addr, master bool) {
+	flag := 0
+	if master {
+		flag = 1
+	}
+	m.send(&packets.OptionAckPacket{Options: map[string]string{
+		packets.OptionMulticast: fmt.Sprintf("%s,%d,%d", m.group.IP, m.group.Port, flag),
+	}}, to)
+}
+
+// request reads a multicast RRQ from a new client.
+func (m *multicastServer) request() net.Addr {
+	buf := make([]byte, 1024)
+	m.listener.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, addr, err := m.listener.ReadFrom(buf)
+	if err != nil {
+		m.t.Errorf("reading request: %v", err)
+		return nil
+	}
+	p, err := packets.Decode(buf[:n])
+	if rrq, ok := p.(*packets.ReadRequestPacket); !ok || err != nil {
+		m.t.Errorf("request %+v, %v", p, err)
+	} else if _, ok := rrq.Options[packets.OptionMulticast]; !ok {
+		m.t.Errorf("request without multicast option: %+v", rrq)
+	}
+	return addr
+}
+
+// serve sends the blocks master asks for to the group, until master
+// acknowledges the last, and reports any ACK from another client. A
+// master that has already received everything may never answer, so when
+// optional is set, hearing nothing is not an error.
+func (m *multicastServer) serve(master net.Addr, optional bool) {
+	last := uint16(len(m.data)/m.blockSize + 1)
+	buf := make([]byte, 1024)
+	for {
+		wait := time.Second
+		if optional {
+			wait = 200 * time.Millisecond
+		}
+		m.conn.SetReadDeadline(time.Now().Add(wait))
+		n, addr, err := m.conn.ReadFrom(buf)
+		if err != nil {
+			if !optional {
+				m.t.Errorf("waiting for ACK from %v: %v", master, err)
+			}
+			return
+		}
+		optional = false
+		p, err := packets.Decode(buf[:n])
+		ack, ok := p.(*packets.AckPacket)
+		if !ok || err != nil {
+			m.t.Errorf("got %+v, %v from %v, want an ACK", p, err, addr)
+			return
+		}
+		if addr.String() != master.String() {
+			m.t.Errorf("ACK %d from %v, which is not the master", ack.BlockNumber, addr)
+			continue
+		}
+		if ack.BlockNumber == last {
+			return
+		}
+		block := int(ack.BlockNumber)
+		end := min((block+1)*m.blockSize, len(m.data))
+		m.send(&packets.DataPacket{BlockNumber: ack.BlockNumber + 1, Data: m.data[block*m.blockSize : end]}, m.group)
+	}
+}
+
+func TestMulticastGet(t *testing.T) {
+	lo, group := loopbackMulticast(t)
+	listener, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	srv := &multicastServer{t: t, listener: listener, conn: conn, group: group, data: file(3000), blockSize: 512}
+
+	c := &tftp.Client{
+		Addr:               listener.LocalAddr().String(),
+		Multicast:          true,
+		MulticastInterface: lo,
+		Timeout:            100 * time.Millisecond,
+	}
+	got := make([]chan []byte, 2)
+	for i := range got {
+		got[i] = make(chan []byte, 1)
+	}
+	get := func(i int) {
+		var buf bytes.Buffer
+		if _, err := c.Get("f", &buf); err != nil {
+			t.Errorf("client %d: %v", i, err)
+		}
+		got[i] <- buf.Bytes()
+	}
+
+	go get(0)
+	a := srv.request()
+	srv.oack(a, true)
+	go get(1)
+	b := srv.request()
+	if a == nil || b == nil {
+		return
+	}
+	srv.oack(b, false)
+	srv.serve(a, false)
+	// The second client acknowledges what it holds once it is master,
+	// unless it has every block and has returned already.
+	srv.oack(b, true)
+	srv.serve(b, true)
+	for i := range got {
+		if b := <-got[i]; !bytes.Equal(b, srv.data) {
+			t.Errorf("client %d got %d bytes differing from the %d sent", i, len(b), len(srv.data))
+		}
+	}
+}
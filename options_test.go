@@ -0,0 +1,264 @@
+package tftp_test
+
+import (
+	"bytes"
+	"io"
+	"maps"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	tftp "github.com/doodles526/go-tftp"
+	"github.com/doodles526/go-tftp/packets"
+	"github.com/doodles526/go-tftp/tftptest"
+	"github.com/doodles526/go-tftp/transfer"
+)
+
+// readReply reads the next packet sent to conn.
+func readReply(t *testing.T, conn net.PacketConn) packets.Packet {
+	t.Helper()
+	buf := make([]byte, 65536)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	m, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := packets.Decode(buf[:m])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestVendorOptionIgnored(t *testing.T) {
+	n := tftptest.NewNetwork(1)
+	data := file(1500)
+	addr := serve(t, n, &tftp.Server{Handler: newMemHandler(map[string][]byte{"f": data})})
+	rrq, _ := packets.NewReadRequest("f", "", packets.WithOption("vendorfoo", "bar"), packets.WithBlockSize(1024))
+	conn, reply, tid := request(t, n, addr, rrq)
+	oack, ok := reply.(*packets.OptionAckPacket)
+	if !ok || len(oack.Options) != 1 || oack.Options[packets.OptionBlockSize] != "1024" {
+		t.Fatalf("reply %+v, want an OACK of blksize 1024 alone", reply)
+	}
+	// The transfer proceeds with the acknowledged block size.
+	ack := func(block uint16) {
+		b, _ := (&packets.AckPacket{BlockNumber: block}).Encode()
+		conn.WriteTo(b, tid)
+	}
+	ack(0)
+	var got []byte
+	for block := uint16(1); ; block++ {
+		d, ok := readReply(t, conn).(*packets.DataPacket)
+		if !ok || d.BlockNumber != block {
+			t.Fatalf("got %+v, want DATA %d", d, block)
+		}
+		got = append(got, d.Data...)
+		ack(block)
+		if len(d.Data) < 1024 {
+			break
+		}
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("received %d bytes differing from the %d served", len(got), len(data))
+	}
+}
+
+func TestRejectUnknownOptions(t *testing.T) {
+	for _, strict := range []bool{false, true} {
+		n := tftptest.NewNetwork(1)
+		h := newMemHandler(map[string][]byte{"f": file(100)})
+		addr := serve(t, n, &tftp.Server{Handler: h, RejectUnknownOptions: strict})
+		for _, p := range []packets.Packet{
+			&packets.ReadRequestPacket{Filename: "f", Mode: packets.ModeOctet, Options: map[string]string{"vendorfoo": "bar", packets.OptionBlockSize: "1024"}},
+			&packets.WriteRequestPacket{Filename: "g", Mode: packets.ModeOctet, Options: map[string]string{"vendorfoo": "bar", packets.OptionTransferSize: "100"}},
+		} {
+			_, reply, _ := request(t, n, addr, p)
+			if strict {
+				if e, ok := reply.(*packets.ErrorPacket); !ok || e.ErrorCode != packets.ErrCodeOptionNegotiation {
+					t.Errorf("strict: %T answered with %+v, want ERROR 8", p, reply)
+				}
+				continue
+			}
+			if oack, ok := reply.(*packets.OptionAckPacket); !ok || oack.Options["vendorfoo"] != "" {
+				t.Errorf("lenient: %T answered with %+v, want an OACK without vendorfoo", p, reply)
+			}
+		}
+		// Supported options alone are accepted either way.
+		var buf bytes.Buffer
+		c := &tftp.Client{Addr: addr, Transport: n, BlockSize: 1024, WindowSize: 2}
+		if _, err := c.Get("f", &buf); err != nil {
+			t.Errorf("strict %v: Get with supported options: %v", strict, err)
+		}
+	}
+}
+
+func TestCustomOptionSpec(t *testing.T) {
+	n := tftptest.NewNetwork(1)
+	s := &tftp.Server{
+		Handler: newMemHandler(map[string][]byte{"f": file(100)}),
+		Options: []transfer.OptionSpec{
+			// Replaces the standard blksize.
+			transfer.BlockSizeOption(512, 1024),
+			{Name: "x-speed", Min: 1, Max: 100, Negotiate: func(c *transfer.Config, value string) (string, bool) {
+				v, err := strconv.Atoi(value)
+				if err != nil || v < 1 {
+					return "", false
+				}
+				return strconv.Itoa(min(v, 100)), true
+			}},
+		},
+	}
+	names := make(map[string]int)
+	for _, spec := range s.SupportedOptions() {
+		names[spec.Name]++
+		if spec.Name == packets.OptionBlockSize && (spec.Min != 512 || spec.Max != 1024) {
+			t.Errorf("blksize bounds [%d, %d], want [512, 1024]", spec.Min, spec.Max)
+		}
+	}
+	if names[packets.OptionBlockSize] != 1 || names["x-speed"] != 1 || names[packets.OptionTimeout] != 1 {
+		t.Errorf("SupportedOptions names %v", names)
+	}
+
+	addr := serve(t, n, s)
+	for _, c := range []struct {
+		blksize, speed string
+		want           map[string]string
+	}{
+		{"1468", "500", map[string]string{packets.OptionBlockSize: "1024", "x-speed": "100"}},
+		{"100", "20", map[string]string{"x-speed": "20"}},
+		{"800", "none", map[string]string{packets.OptionBlockSize: "800"}},
+	} {
+		rrq := &packets.ReadRequestPacket{Filename: "f", Mode: packets.ModeOctet, Options: map[string]string{
+			packets.OptionBlockSize: c.blksize,
+			"x-speed":               c.speed,
+		}}
+		_, reply, _ := request(t, n, addr, rrq)
+		oack, ok := reply.(*packets.OptionAckPacket)
+		if !ok || !maps.Equal(oack.Options, c.want) {
+			t.Errorf("blksize %s, x-speed %s: reply %+v, want an OACK of %v", c.blksize, c.speed, reply, c.want)
+		}
+	}
+}
+
+func TestBlockSizeClamp(t *testing.T) {
+	cases := []struct {
+		min, max  int
+		requested string
+		want      string // "" for no blksize in the OACK
+	}{
+		{0, 0, "65464", strconv.Itoa(tftp.DefaultMaxBlockSize)},
+		{0, 0, "1024", "1024"},
+		{512, 8192, "65464", "8192"},
+		// Raising it would exceed the request: the default 512 applies.
+		{512, 8192, "100", ""},
+		// Below the RFC 2348 minimum the request is invalid and ignored.
+		{0, 0, "4", ""},
+	}
+	for _, c := range cases {
+		n := tftptest.NewNetwork(1)
+		addr := serve(t, n, &tftp.Server{
+			Handler:      newMemHandler(map[string][]byte{"f": file(100)}),
+			MinBlockSize: c.min,
+			MaxBlockSize: c.max,
+		})
+		rrq := &packets.ReadRequestPacket{Filename: "f", Mode: packets.ModeOctet, Options: map[string]string{
+			packets.OptionBlockSize:    c.requested,
+			packets.OptionTransferSize: "0",
+		}}
+		_, reply, _ := request(t, n, addr, rrq)
+		oack, ok := reply.(*packets.OptionAckPacket)
+		if !ok {
+			t.Errorf("bounds [%d, %d], blksize %s: reply %+v, want an OACK", c.min, c.max, c.requested, reply)
+			continue
+		}
+		if got, ok := oack.Options[packets.OptionBlockSize]; got != c.want || ok != (c.want != "") {
+			t.Errorf("bounds [%d, %d], blksize %s: OACK %v, want blksize %q", c.min, c.max, c.requested, oack.Options, c.want)
+		}
+	}
+
+	// A client asking for less than the server's minimum still gets the
+	// file, in blocks of 512.
+	n := tftptest.NewNetwork(1)
+	data := file(1500)
+	addr := serve(t, n, &tftp.Server{Handler: newMemHandler(map[string][]byte{"f": data}), MinBlockSize: 1024})
+	var b bytes.Buffer
+	if _, err := (&tftp.Client{Addr: addr, Transport: n, BlockSize: 256}).Get("f", &b); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b.Bytes(), data) {
+		t.Errorf("received %d bytes differing from the %d served", b.Len(), len(data))
+	}
+}
+
+func TestUTimeoutRetransmit(t *testing.T) {
+	n := tftptest.NewNetwork(1)
+	addr := serve(t, n, &tftp.Server{
+		Handler: newMemHandler(map[string][]byte{"f": file(100)}),
+		Timeout: 5 * time.Second,
+	})
+	rrq, _ := packets.NewReadRequest("f", "", packets.WithUTimeout(20000))
+	conn, reply, _ := request(t, n, addr, rrq)
+	if oack, ok := reply.(*packets.OptionAckPacket); !ok || oack.Options[packets.OptionUTimeout] != "20000" {
+		t.Fatalf("reply %+v, want an OACK of utimeout 20000", reply)
+	}
+	// Unacknowledged, the OACK is sent again after 20ms, not 5s.
+	start := time.Now()
+	if _, ok := readReply(t, conn).(*packets.OptionAckPacket); !ok {
+		t.Fatal("OACK not retransmitted")
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Errorf("OACK retransmitted after %v, want about 20ms", d)
+	}
+}
+
+func TestClientRequestTimeout(t *testing.T) {
+	for _, c := range []struct {
+		timeout time.Duration
+		want    map[string]string
+	}{
+		{3 * time.Second, map[string]string{packets.OptionTimeout: "3"}},
+		{1500 * time.Millisecond, map[string]string{packets.OptionTimeout: "2", packets.OptionUTimeout: "1500000"}},
+		{20 * time.Millisecond, map[string]string{packets.OptionTimeout: "1", packets.OptionUTimeout: "20000"}},
+		// Kept within the bounds of the options.
+		{time.Millisecond, map[string]string{packets.OptionTimeout: "1", packets.OptionUTimeout: "10000"}},
+		{10 * time.Minute, map[string]string{packets.OptionTimeout: "255"}},
+	} {
+		n := tftptest.NewNetwork(1)
+		s := newScriptedServer(t, n)
+		cl := &tftp.Client{Addr: s.listener.LocalAddr().String(), Transport: n, RequestTimeout: c.timeout}
+		result := make(chan error, 1)
+		go func() {
+			_, err := cl.Get("f", io.Discard)
+			result <- err
+		}()
+		rrq, ok := s.accept().(*packets.ReadRequestPacket)
+		if !ok || !maps.Equal(rrq.Options, c.want) {
+			t.Errorf("RequestTimeout %v: request %+v, want options %v", c.timeout, rrq, c.want)
+		}
+		s.send(&packets.ErrorPacket{ErrorCode: packets.ErrCodeFileNotFound})
+		<-result
+	}
+
+	// The acknowledged timeout applies to the client's retransmissions.
+	n := tftptest.NewNetwork(1)
+	s := newScriptedServer(t, n)
+	c := &tftp.Client{Addr: s.listener.LocalAddr().String(), Transport: n, Timeout: 5 * time.Second, RequestTimeout: 20 * time.Millisecond}
+	result := make(chan error, 1)
+	go func() {
+		_, err := c.Get("f", io.Discard)
+		result <- err
+	}()
+	rrq := s.accept().(*packets.ReadRequestPacket)
+	s.send(&packets.OptionAckPacket{Options: rrq.Options})
+	s.expect(&packets.AckPacket{BlockNumber: 0})
+	start := time.Now()
+	s.expect(&packets.AckPacket{BlockNumber: 0})
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Errorf("ACK 0 retransmitted after %v, want about 20ms", d)
+	}
+	s.send(&packets.DataPacket{BlockNumber: 1})
+	if err := <-result; err != nil {
+		t.Error(err)
+	}
+}
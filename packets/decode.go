@@ -0,0 +1,302 @@
+package packets
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strings"
+
+	"github.com/doodles526/go-tftp/errors"
+)
+
+// Decode parses a single TFTP packet from b. Malformed packets are
+// reported as errors.ErrorIllegalOperation.
+//
+// The Data of a decoded DataPacket aliases b.
+func Decode(b []byte) (Packet, error) {
+	return Decoder{}.Decode(b)
+}
+
+// Decoder decodes packets like Decode, with optional relaxations for
+// peers that do not follow the RFCs to the letter. The zero Decoder is
+// as strict as Decode.
+type Decoder struct {
+	// LenientDecode accepts ACK and ERROR packets followed by NUL
+	// padding, as sent by some hardware TFTP stacks that pad every
+	// datagram to a fixed size, and ERROR packets whose message is not
+	// NUL-terminated, taking the end of the datagram as its end. Decode
+	// rejects both.
+	LenientDecode bool
+}
+
+// Decode parses a single TFTP packet from b according to d.
+func (d Decoder) Decode(b []byte) (Packet, error) {
+	if len(b) < 2 {
+		return nil, errors.ErrorIllegalOperation("packet too short")
+	}
+	op := Opcode(binary.BigEndian.Uint16(b))
+	if len(b) == 2 {
+		return nil, bodyMissing(op)
+	}
+	switch op {
+	case OpRRQ:
+		filename, mode, options, order, err := decodeRequest(b)
+		if err != nil {
+			return nil, err
+		}
+		return &ReadRequestPacket{Filename: filename, Mode: mode, Options: options, order: order}, nil
+	case OpWRQ:
+		filename, mode, options, order, err := decodeRequest(b)
+		if err != nil {
+			return nil, err
+		}
+		return &WriteRequestPacket{Filename: filename, Mode: mode, Options: options, order: order}, nil
+	}
+	// The typed decoders return nil pointers on failure, which must not
+	// be returned as a non-nil Packet.
+	var (
+		p   Packet
+		err error
+	)
+	switch op {
+	case OpDATA:
+		p, err = decodeDataPacket(b)
+	case OpACK:
+		if d.LenientDecode && len(b) > 4 && isPadding(b[4:]) {
+			b = b[:4]
+		}
+		p, err = decodeAckPacket(b)
+	case OpERROR:
+		p, err = decodeErrorPacket(b, d.LenientDecode)
+	case OpOACK:
+		p, err = decodeOptionAckPacket(b)
+	default:
+		err = errors.ErrorIllegalOperation("unknown opcode")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// bodyMissing returns the error for a packet consisting of opcode op and
+// nothing else. No packet type is valid without a body.
+func bodyMissing(op Opcode) error {
+	switch op {
+	case OpRRQ, OpWRQ:
+		return errors.ErrorIllegalOperation(op.String() + " packet has no filename or mode")
+	case OpDATA, OpACK:
+		return errors.ErrorIllegalOperation(op.String() + " packet has no block number")
+	case OpERROR:
+		return errors.ErrorIllegalOperation("ERROR packet has no error code")
+	case OpOACK:
+		return errors.ErrorIllegalOperation("OACK packet has no options")
+	}
+	return errors.ErrorIllegalOperation("unknown opcode")
+}
+
+// decodeRequest decodes the body shared by RRQ and WRQ packets: a filename
+// and a mode, each NUL-terminated, followed by any options. order lists
+// the option names as received, for decodeOptions.
+func decodeRequest(b []byte) (filename, mode string, options map[string]string, order []string, err error) {
+	buf := bytes.NewBuffer(b[2:])
+	if filename, err = buf.ReadString(0x00); err != nil {
+		return "", "", nil, nil, errors.ErrorIllegalOperation("unterminated filename")
+	}
+	if filename = filename[:len(filename)-1]; filename == "" {
+		return "", "", nil, nil, errors.ErrorIllegalOperation("empty filename")
+	}
+	if len(filename) > MaxFilenameLength {
+		return "", "", nil, nil, errors.ErrorIllegalOperation("filename too long")
+	}
+	if buf.Len() == 0 {
+		return "", "", nil, nil, errors.ErrorIllegalOperation("missing mode")
+	}
+	if mode, err = buf.ReadString(0x00); err != nil {
+		return "", "", nil, nil, errors.ErrorIllegalOperation("unterminated mode")
+	}
+	mode = mode[:len(mode)-1]
+	switch strings.ToLower(mode) {
+	case ModeNetASCII, ModeOctet, ModeMail:
+	default:
+		return "", "", nil, nil, errors.ErrorIllegalOperation("unknown mode " + mode)
+	}
+	// Anything after the mode must be options.
+	if options, order, err = decodeOptions(buf); err != nil {
+		return "", "", nil, nil, err
+	}
+	return filename, mode, options, order, nil
+}
+
+// decodeOptions reads NUL-terminated name/value pairs until buf is
+// exhausted. Every option is kept, including vendor options this package
+// does not know, leaving it to the receiver to ignore them. Option names
+// are case-insensitive and are returned lowercased. An empty name, or one
+// that repeats an earlier name in any case, is an error. The map is nil
+// if there were no options, never empty. order lists the names in the
+// order and case they were received in, so that the packet can be
+// encoded again unchanged.
+func decodeOptions(buf *bytes.Buffer) (options map[string]string, order []string, err error) {
+	for buf.Len() > 0 {
+		name, err := buf.ReadString(0x00)
+		if err != nil {
+			return nil, nil, errors.ErrorIllegalOperation("unterminated option name")
+		}
+		name = name[:len(name)-1]
+		if name == "" {
+			return nil, nil, errors.ErrorIllegalOperation("empty option name")
+		}
+		lower := strings.ToLower(name)
+		if _, ok := options[lower]; ok {
+			return nil, nil, errors.ErrorIllegalOperation("duplicate option " + lower)
+		}
+		if buf.Len() == 0 {
+			return nil, nil, errors.ErrorIllegalOperation("missing value for option " + lower)
+		}
+		value, err := buf.ReadString(0x00)
+		if err != nil {
+			return nil, nil, errors.ErrorIllegalOperation("unterminated value for option " + lower)
+		}
+		if options == nil {
+			options = make(map[string]string)
+		}
+		options[lower] = value[:len(value)-1]
+		order = append(order, name)
+	}
+	return options, order, nil
+}
+
+// Request is a read or write request, for code that handles both alike
+// until it branches on the direction.
+type Request struct {
+	IsWrite  bool
+	Filename string
+	Mode     string
+	Options  map[string]string
+}
+
+// DecodeRequest decodes b, which must be an RRQ or a WRQ, into a Request.
+func DecodeRequest(b []byte) (*Request, error) {
+	if len(b) < 2 {
+		return nil, errors.ErrorIllegalOperation("packet too short")
+	}
+	op := Opcode(binary.BigEndian.Uint16(b))
+	if op != OpRRQ && op != OpWRQ {
+		return nil, errors.ErrorIllegalOperation("not a request")
+	}
+	if len(b) == 2 {
+		return nil, bodyMissing(op)
+	}
+	filename, mode, options, _, err := decodeRequest(b)
+	if err != nil {
+		return nil, err
+	}
+	return &Request{IsWrite: op == OpWRQ, Filename: filename, Mode: mode, Options: options}, nil
+}
+
+// DecodeData decodes b, which must be a DATA packet, without the
+// allocation Decode incurs to return a Packet. Data aliases b.
+func DecodeData(b []byte) (DataPacket, error) {
+	if len(b) < 2 || Opcode(binary.BigEndian.Uint16(b)) != OpDATA {
+		return DataPacket{}, errors.ErrorIllegalOperation("not a DATA packet")
+	}
+	if len(b) == 2 {
+		return DataPacket{}, bodyMissing(OpDATA)
+	}
+	if len(b) < 4 {
+		return DataPacket{}, errors.ErrorIllegalOperation("DATA packet too short")
+	}
+	return DataPacket{
+		BlockNumber: binary.BigEndian.Uint16(b[2:]),
+		Data:        b[4:],
+	}, nil
+}
+
+// DecodeInto decodes b, which must be a DATA packet, into dst. Unlike
+// DecodeData, it copies the payload into dst.Data, reusing its capacity
+// and growing it only when it is too small, so that a receive loop can
+// decode into one DataPacket without allocating and without the payload
+// aliasing b. dst is not modified if b is not a valid DATA packet.
+func DecodeInto(dst *DataPacket, b []byte) error {
+	p, err := DecodeData(b)
+	if err != nil {
+		return err
+	}
+	dst.BlockNumber = p.BlockNumber
+	dst.Data = append(dst.Data[:0], p.Data...)
+	return nil
+}
+
+// DecodeAck decodes b, which must be an ACK packet, without the
+// allocation Decode incurs to return a Packet.
+func DecodeAck(b []byte) (AckPacket, error) {
+	if len(b) < 2 || Opcode(binary.BigEndian.Uint16(b)) != OpACK {
+		return AckPacket{}, errors.ErrorIllegalOperation("not an ACK packet")
+	}
+	if len(b) == 2 {
+		return AckPacket{}, bodyMissing(OpACK)
+	}
+	if len(b) != 4 {
+		return AckPacket{}, errors.ErrorIllegalOperation("ACK packet has wrong length")
+	}
+	return AckPacket{BlockNumber: binary.BigEndian.Uint16(b[2:])}, nil
+}
+
+func decodeDataPacket(b []byte) (*DataPacket, error) {
+	p, err := DecodeData(b)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func decodeAckPacket(b []byte) (*AckPacket, error) {
+	p, err := DecodeAck(b)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// decodeErrorPacket decodes an ERROR packet. An unterminated message, or
+// bytes after the message's terminating NUL, are rejected unless lenient
+// is set and the bytes are all NUL.
+func decodeErrorPacket(b []byte, lenient bool) (*ErrorPacket, error) {
+	if len(b) < 5 && !(lenient && len(b) == 4) {
+		return nil, errors.ErrorIllegalOperation("ERROR packet too short")
+	}
+	code := binary.BigEndian.Uint16(b[2:])
+	if code > ErrCodeOptionNegotiation {
+		return nil, errors.ErrorIllegalOperation("unknown error code")
+	}
+	buf := bytes.NewBuffer(b[4:])
+	msg, err := buf.ReadString(0x00)
+	if err == io.EOF {
+		if !lenient {
+			return nil, errors.ErrorIllegalOperation("unterminated error message")
+		}
+		return &ErrorPacket{ErrorCode: code, ErrorMessage: msg}, nil
+	}
+	if rest := buf.Bytes(); len(rest) > 0 && !(lenient && isPadding(rest)) {
+		return nil, errors.ErrorIllegalOperation("trailing data after error message")
+	}
+	return &ErrorPacket{ErrorCode: code, ErrorMessage: msg[:len(msg)-1]}, nil
+}
+
+// isPadding reports whether b consists only of NUL bytes.
+func isPadding(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func decodeOptionAckPacket(b []byte) (*OptionAckPacket, error) {
+	options, order, err := decodeOptions(bytes.NewBuffer(b[2:]))
+	if err != nil {
+		return nil, err
+	}
+	return &OptionAckPacket{Options: options, order: order}, nil
+}
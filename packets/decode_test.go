@@ -0,0 +1,352 @@
+package packets
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/doodles526/go-tftp/errors"
+)
+
+func TestDecodeTyped(t *testing.T) {
+	d, err := DecodeData([]byte{0, 3, 0, 7, 'a', 'b'})
+	if err != nil || d.BlockNumber != 7 || !bytes.Equal(d.Data, []byte("ab")) {
+		t.Errorf("DecodeData = %+v, %v", d, err)
+	}
+	a, err := DecodeAck([]byte{0, 4, 1, 2})
+	if err != nil || a.BlockNumber != 0x102 {
+		t.Errorf("DecodeAck = %+v, %v", a, err)
+	}
+	if _, err := DecodeData([]byte{0, 4, 0, 1}); err == nil {
+		t.Error("DecodeData accepted an ACK")
+	}
+	if _, err := DecodeAck([]byte{0, 3, 0, 1}); err == nil {
+		t.Error("DecodeAck accepted a DATA packet")
+	}
+	if _, err := DecodeAck([]byte{0, 4, 0, 1, 0}); err == nil {
+		t.Error("DecodeAck accepted a 5-byte ACK")
+	}
+}
+
+func TestDecodeTypedAllocs(t *testing.T) {
+	ack := []byte{0, 4, 0, 1}
+	if n := testing.AllocsPerRun(100, func() { DecodeAck(ack) }); n != 0 {
+		t.Errorf("DecodeAck: %v allocations, want 0", n)
+	}
+	data := append([]byte{0, 3, 0, 1}, make([]byte, 512)...)
+	if n := testing.AllocsPerRun(100, func() { DecodeData(data) }); n != 0 {
+		t.Errorf("DecodeData: %v allocations, want 0", n)
+	}
+	dst := DataPacket{Data: make([]byte, 0, 512)}
+	if n := testing.AllocsPerRun(100, func() { DecodeInto(&dst, data) }); n != 0 {
+		t.Errorf("DecodeInto: %v allocations, want 0", n)
+	}
+}
+
+func TestDecodeInto(t *testing.T) {
+	var dst DataPacket
+	b := []byte{0, 3, 0, 1, 'a', 'b', 'c'}
+	if err := DecodeInto(&dst, b); err != nil || dst.BlockNumber != 1 || string(dst.Data) != "abc" {
+		t.Fatalf("DecodeInto = %+v, %v", dst, err)
+	}
+	// The payload is copied, not aliased.
+	b[4] = 'x'
+	if string(dst.Data) != "abc" {
+		t.Errorf("Data changed with the buffer to %q", dst.Data)
+	}
+	// A shorter payload reuses the slice; a longer one grows it.
+	buf := &dst.Data[0]
+	if err := DecodeInto(&dst, []byte{0, 3, 0, 2, 'd'}); err != nil || string(dst.Data) != "d" || &dst.Data[0] != buf {
+		t.Errorf("shorter block: %+v, %v, reused %v", dst, err, &dst.Data[0] == buf)
+	}
+	long := append([]byte{0, 3, 0, 3}, bytes.Repeat([]byte{'e'}, 600)...)
+	if err := DecodeInto(&dst, long); err != nil || dst.BlockNumber != 3 || len(dst.Data) != 600 {
+		t.Errorf("longer block: %d bytes, %v", len(dst.Data), err)
+	}
+	if err := DecodeInto(&dst, []byte{0, 4, 0, 1}); err == nil {
+		t.Error("DecodeInto accepted an ACK")
+	}
+}
+
+func BenchmarkDecodeAck(b *testing.B) {
+	ack := []byte{0, 4, 0, 1}
+	b.Run("Decode", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			p, _ := Decode(ack)
+			_ = p.(*AckPacket).BlockNumber
+		}
+	})
+	b.Run("DecodeAck", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			p, _ := DecodeAck(ack)
+			_ = p.BlockNumber
+		}
+	})
+}
+
+func BenchmarkDecodeData(b *testing.B) {
+	data := append([]byte{0, 3, 0, 1}, make([]byte, 512)...)
+	b.Run("Decode", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			p, _ := Decode(data)
+			_ = p.(*DataPacket).BlockNumber
+		}
+	})
+	b.Run("DecodeData", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			p, _ := DecodeData(data)
+			_ = p.BlockNumber
+		}
+	})
+	b.Run("DecodeInto", func(b *testing.B) {
+		b.ReportAllocs()
+		var p DataPacket
+		for i := 0; i < b.N; i++ {
+			DecodeInto(&p, data)
+		}
+	})
+}
+
+func TestDecodeBodyMissing(t *testing.T) {
+	for _, c := range []struct {
+		op   Opcode
+		want string
+	}{
+		{OpRRQ, "RRQ packet has no filename or mode"},
+		{OpWRQ, "WRQ packet has no filename or mode"},
+		{OpDATA, "DATA packet has no block number"},
+		{OpACK, "ACK packet has no block number"},
+		{OpERROR, "ERROR packet has no error code"},
+		{OpOACK, "OACK packet has no options"},
+	} {
+		p, err := Decode([]byte{0, byte(c.op)})
+		if p != nil {
+			t.Errorf("%v: decoded %+v", c.op, p)
+		}
+		if _, ok := err.(errors.ErrorIllegalOperation); !ok || err.Error() != c.want {
+			t.Errorf("%v: error %#v, want %q", c.op, err, c.want)
+		}
+		if _, err := Validate([]byte{0, byte(c.op)}); err == nil || err.Error() != c.want {
+			t.Errorf("Validate %v: error %v, want %q", c.op, err, c.want)
+		}
+	}
+	if _, err := DecodeData([]byte{0, 3}); err == nil || err.Error() != "DATA packet has no block number" {
+		t.Errorf("DecodeData: %v", err)
+	}
+	if _, err := DecodeAck([]byte{0, 4}); err == nil || err.Error() != "ACK packet has no block number" {
+		t.Errorf("DecodeAck: %v", err)
+	}
+}
+
+func FuzzDecode(f *testing.F) {
+	for _, b := range [][]byte{
+		[]byte("\x00\x01pxelinux.0\x00octet\x00blksize\x001468\x00tsize\x000\x00"),
+		[]byte("\x00\x02upload\x00netascii\x00"),
+		[]byte("\x00\x03\x00\x01hello"),
+		[]byte("\x00\x04\x00\x01"),
+		[]byte("\x00\x05\x00\x01File not found\x00"),
+		[]byte("\x00\x06blksize\x001468\x00"),
+	} {
+		f.Add(b)
+	}
+	f.Fuzz(func(t *testing.T, b []byte) {
+		p, err := Decode(b)
+		if err != nil {
+			if p != nil {
+				t.Fatalf("Decode(%q) returned %+v with error %v", b, p, err)
+			}
+			return
+		}
+		if p == nil {
+			t.Fatalf("Decode(%q) returned neither a packet nor an error", b)
+		}
+		e, err := p.Encode()
+		if err != nil {
+			t.Fatalf("Decode(%q) = %+v, which does not encode: %v", b, p, err)
+		}
+		if !bytes.Equal(e, b) {
+			t.Fatalf("Decode(%q) = %+v, which encodes to %q", b, p, e)
+		}
+		if n := p.(interface{ EncodedLen() int }).EncodedLen(); n != len(e) {
+			t.Fatalf("Decode(%q) = %+v, with EncodedLen %d", b, p, n)
+		}
+	})
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, b := range []string{
+		"\x00\x01f\x00octet\x00",
+		"\x00\x01pxelinux.0\x00OCTET\x00tsize\x000\x00BlkSize\x001468\x00",
+		"\x00\x02upload\x00netascii\x00",
+		"\x00\x02upload\x00octet\x00windowsize\x0016\x00x-vendor\x00on\x00",
+		// A Kelvin sign lowercases to a one-byte k.
+		"\x00\x01f\x00octet\x00bl\u212asize\x001024\x00",
+		"\x00\x03\x00\x01hello",
+		"\x00\x03\xff\xff",
+		"\x00\x04\x00\x00",
+		"\x00\x05\x00\x01File not found\x00",
+		"\x00\x05\x00\x00\x00",
+		"\x00\x06timeout\x003\x00blksize\x001024\x00",
+	} {
+		p, err := Decode([]byte(b))
+		if err != nil {
+			t.Errorf("Decode(%q): %v", b, err)
+			continue
+		}
+		e, err := p.Encode()
+		if err != nil || string(e) != b {
+			t.Errorf("Decode(%q) = %+v, which encodes to %q, %v", b, p, e, err)
+		}
+		if n := p.(interface{ EncodedLen() int }).EncodedLen(); n != len(b) {
+			t.Errorf("Decode(%q) = %+v, with EncodedLen %d", b, p, n)
+		}
+	}
+}
+
+func TestDecodeOptionNames(t *testing.T) {
+	for _, c := range []struct {
+		b, want string
+	}{
+		{"\x00\x01f\x00octet\x00\x001\x00", "empty option name"},
+		{"\x00\x01f\x00octet\x00blksize\x00512\x00BLKSIZE\x001024\x00", "duplicate option blksize"},
+		{"\x00\x06blksize\x00512\x00bl\u212asize\x001024\x00", "duplicate option blksize"},
+	} {
+		_, err := Decode([]byte(c.b))
+		if _, ok := err.(errors.ErrorIllegalOperation); !ok || err.Error() != c.want {
+			t.Errorf("Decode(%q): %#v, want %q", c.b, err, c.want)
+		}
+	}
+}
+
+func TestDecodeRequestErrors(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		b    string
+		want string
+	}{
+		{"filename without mode", "\x00\x01foo\x00", "missing mode"},
+		{"unterminated mode", "\x00\x01foo\x00oct", "unterminated mode"},
+		{"unterminated filename", "\x00\x01foo", "unterminated filename"},
+		{"unterminated option", "\x00\x01foo\x00octet\x00xyz", "unterminated option name"},
+		{"option without value", "\x00\x01foo\x00octet\x00blksize\x00", "missing value for option blksize"},
+	} {
+		_, err := Decode([]byte(c.b))
+		if _, ok := err.(errors.ErrorIllegalOperation); !ok || err.Error() != c.want {
+			t.Errorf("%s: %#v, want %q", c.name, err, c.want)
+		}
+	}
+	// Complete name/value pairs after the mode are options.
+	p, err := Decode([]byte("\x00\x01foo\x00octet\x00blksize\x001024\x00"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o := p.(*ReadRequestPacket).Options; o[OptionBlockSize] != "1024" || len(o) != 1 {
+		t.Errorf("options = %v", o)
+	}
+}
+
+func TestLenientDecodePadding(t *testing.T) {
+	pad := func(b []byte) []byte { return append(b, make([]byte, 512-len(b))...) }
+	for _, c := range []struct {
+		name string
+		b    []byte
+		want Packet
+	}{
+		{"padded ACK", pad([]byte{0, 4, 0, 7}), &AckPacket{BlockNumber: 7}},
+		{"padded ERROR", pad([]byte("\x00\x05\x00\x01missing\x00")), &ErrorPacket{ErrorCode: 1, ErrorMessage: "missing"}},
+	} {
+		if p, err := Decode(c.b); err == nil {
+			t.Errorf("%s: strict decoding accepted %+v", c.name, p)
+		} else if _, ok := err.(errors.ErrorIllegalOperation); !ok {
+			t.Errorf("%s: strict decoding: %#v, want ErrorIllegalOperation", c.name, err)
+		}
+		p, err := Decoder{LenientDecode: true}.Decode(c.b)
+		if err != nil || !Equal(p, c.want) {
+			t.Errorf("%s: lenient decoding = %+v, %v; want %+v", c.name, p, err, c.want)
+		}
+	}
+	// Padding must be NULs; anything else is still rejected.
+	b := pad([]byte{0, 4, 0, 7})
+	b[100] = 1
+	if _, err := (Decoder{LenientDecode: true}).Decode(b); err == nil {
+		t.Error("ACK followed by non-NUL bytes accepted")
+	}
+}
+
+func TestDecodeRequest(t *testing.T) {
+	for _, c := range []struct {
+		p    Packet
+		want Request
+	}{
+		{
+			&ReadRequestPacket{Filename: "boot/pxelinux.0", Mode: ModeOctet, Options: map[string]string{OptionBlockSize: "1468"}},
+			Request{Filename: "boot/pxelinux.0", Mode: ModeOctet, Options: map[string]string{OptionBlockSize: "1468"}},
+		},
+		{
+			&WriteRequestPacket{Filename: "upload", Mode: ModeNetASCII},
+			Request{IsWrite: true, Filename: "upload", Mode: ModeNetASCII},
+		},
+	} {
+		b, err := c.p.Encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := DecodeRequest(b)
+		if err != nil {
+			t.Errorf("DecodeRequest(%q): %v", b, err)
+			continue
+		}
+		if r.IsWrite != c.want.IsWrite || r.Filename != c.want.Filename || r.Mode != c.want.Mode || len(r.Options) != len(c.want.Options) || r.Options[OptionBlockSize] != c.want.Options[OptionBlockSize] {
+			t.Errorf("DecodeRequest(%q) = %+v, want %+v", b, r, c.want)
+		}
+	}
+	for _, b := range [][]byte{{0, 4, 0, 1}, {0, 1}, {0}} {
+		if r, err := DecodeRequest(b); err == nil {
+			t.Errorf("DecodeRequest(%q) = %+v, want an error", b, r)
+		}
+	}
+}
+
+func TestLenientDecodeUnterminatedError(t *testing.T) {
+	want := &ErrorPacket{ErrorCode: 2, ErrorMessage: "denied"}
+	for _, c := range []struct {
+		name      string
+		b         string
+		strictOK  bool
+		lenientOK bool
+	}{
+		{"terminated", "\x00\x05\x00\x02denied\x00", true, true},
+		{"unterminated", "\x00\x05\x00\x02denied", false, true},
+	} {
+		for _, lenient := range []bool{false, true} {
+			ok := c.strictOK
+			if lenient {
+				ok = c.lenientOK
+			}
+			p, err := Decoder{LenientDecode: lenient}.Decode([]byte(c.b))
+			switch {
+			case ok && (err != nil || !Equal(p, want)):
+				t.Errorf("%s, lenient %v: Decode = %+v, %v; want %+v", c.name, lenient, p, err, want)
+			case !ok && err == nil:
+				t.Errorf("%s, lenient %v: Decode accepted %+v", c.name, lenient, p)
+			case !ok:
+				if _, isIllegal := err.(errors.ErrorIllegalOperation); !isIllegal {
+					t.Errorf("%s, lenient %v: %#v, want ErrorIllegalOperation", c.name, lenient, err)
+				}
+			}
+		}
+	}
+}
+
+func TestDecodeVendorOption(t *testing.T) {
+	p, err := Decode([]byte("\x00\x01f\x00octet\x00VendorFoo\x00bar\x00blksize\x001024\x00"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o := p.(*ReadRequestPacket).Options; len(o) != 2 || o["vendorfoo"] != "bar" || o[OptionBlockSize] != "1024" {
+		t.Errorf("options = %v", o)
+	}
+}
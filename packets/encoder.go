@@ -0,0 +1,29 @@
+package packets
+
+// Encoder encodes packets into a buffer it reuses from one call to the
+// next, so that a sender encoding a packet per block does not allocate
+// once the buffer has grown to the largest packet. The zero Encoder is
+// ready to use. An Encoder must not be used from several goroutines at
+// once.
+type Encoder struct {
+	buf []byte
+}
+
+// Encode encodes p as p.Encode does. The returned slice refers to the
+// Encoder's buffer: it is only valid until the next call to Encode, and
+// must be copied to be kept longer. Packet types without an EncodeAppend
+// method, which all types of this package have, are encoded with Encode.
+func (e *Encoder) Encode(p Packet) ([]byte, error) {
+	a, ok := p.(interface {
+		EncodeAppend(dst []byte) ([]byte, error)
+	})
+	if !ok {
+		return p.Encode()
+	}
+	b, err := a.EncodeAppend(e.buf[:0])
+	if err != nil {
+		return nil, err
+	}
+	e.buf = b
+	return b, nil
+}
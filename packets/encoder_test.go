@@ -0,0 +1,54 @@
+package packets
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEncoder(t *testing.T) {
+	var e Encoder
+	for _, p := range []Packet{
+		&DataPacket{BlockNumber: 1, Data: bytes.Repeat([]byte{'a'}, 512)},
+		&AckPacket{BlockNumber: 1},
+		&ReadRequestPacket{Filename: "f", Mode: ModeOctet, Options: map[string]string{OptionBlockSize: "1024"}},
+		&ErrorPacket{ErrorCode: 1, ErrorMessage: "missing"},
+	} {
+		want, err := p.Encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := e.Encode(p)
+		if err != nil || !bytes.Equal(got, want) {
+			t.Errorf("Encode(%+v) = %q, %v; want %q", p, got, err, want)
+		}
+	}
+	// Once grown, the buffer is reused.
+	data := &DataPacket{BlockNumber: 2, Data: make([]byte, 512)}
+	if n := testing.AllocsPerRun(100, func() { e.Encode(data) }); n != 0 {
+		t.Errorf("Encode of DATA: %v allocations, want 0", n)
+	}
+	// A failed encoding returns nothing and leaves the Encoder usable.
+	if b, err := e.Encode(&ReadRequestPacket{Filename: "a\x00b", Mode: ModeOctet}); err == nil || b != nil {
+		t.Errorf("Encode of a bad request = %q, %v", b, err)
+	}
+	if b, err := e.Encode(&AckPacket{BlockNumber: 3}); err != nil || !bytes.Equal(b, []byte{0, 4, 0, 3}) {
+		t.Errorf("Encode after a failure = %q, %v", b, err)
+	}
+}
+
+func BenchmarkEncodeData(b *testing.B) {
+	p := &DataPacket{BlockNumber: 1, Data: make([]byte, 1468)}
+	b.Run("Encode", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			p.Encode()
+		}
+	})
+	b.Run("Encoder", func(b *testing.B) {
+		b.ReportAllocs()
+		var e Encoder
+		for i := 0; i < b.N; i++ {
+			e.Encode(p)
+		}
+	})
+}
@@ -0,0 +1,70 @@
+package packets
+
+import (
+	"bytes"
+)
+
+// Equal reports whether a and b are the same packet: packets of the same
+// type whose fields are equal. DATA payloads are compared byte by byte and
+// option maps entry by entry, so a nil payload or map equals an empty one,
+// as they encode the same. Two nil packets are equal, whether nil
+// interfaces or nil pointers, and a nil packet equals no other.
+func Equal(a, b Packet) bool {
+	if isNil(a) || isNil(b) {
+		return isNil(a) && isNil(b)
+	}
+	switch a := a.(type) {
+	case *ReadRequestPacket:
+		b, ok := b.(*ReadRequestPacket)
+		return ok && a.Filename == b.Filename && a.Mode == b.Mode && equalOptions(a.Options, b.Options)
+	case *WriteRequestPacket:
+		b, ok := b.(*WriteRequestPacket)
+		return ok && a.Filename == b.Filename && a.Mode == b.Mode && equalOptions(a.Options, b.Options)
+	case *DataPacket:
+		b, ok := b.(*DataPacket)
+		return ok && a.BlockNumber == b.BlockNumber && bytes.Equal(a.Data, b.Data)
+	case *AckPacket:
+		b, ok := b.(*AckPacket)
+		return ok && a.BlockNumber == b.BlockNumber
+	case *ErrorPacket:
+		b, ok := b.(*ErrorPacket)
+		return ok && a.ErrorCode == b.ErrorCode && a.ErrorMessage == b.ErrorMessage
+	case *OptionAckPacket:
+		b, ok := b.(*OptionAckPacket)
+		return ok && equalOptions(a.Options, b.Options)
+	}
+	return false
+}
+
+// isNil reports whether p is nil or a nil pointer to a packet type.
+func isNil(p Packet) bool {
+	switch p := p.(type) {
+	case nil:
+		return true
+	case *ReadRequestPacket:
+		return p == nil
+	case *WriteRequestPacket:
+		return p == nil
+	case *DataPacket:
+		return p == nil
+	case *AckPacket:
+		return p == nil
+	case *ErrorPacket:
+		return p == nil
+	case *OptionAckPacket:
+		return p == nil
+	}
+	return false
+}
+
+func equalOptions(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, value := range a {
+		if v, ok := b[name]; !ok || v != value {
+			return false
+		}
+	}
+	return true
+}
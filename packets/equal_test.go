@@ -0,0 +1,33 @@
+package packets
+
+import "testing"
+
+func TestEqual(t *testing.T) {
+	for _, c := range []struct {
+		name  string
+		a, b  Packet
+		equal bool
+	}{
+		{"equal DATA", &DataPacket{BlockNumber: 1, Data: []byte("abc")}, &DataPacket{BlockNumber: 1, Data: []byte("abc")}, true},
+		{"nil and empty payload", &DataPacket{BlockNumber: 1}, &DataPacket{BlockNumber: 1, Data: []byte{}}, true},
+		{"different payload", &DataPacket{BlockNumber: 1, Data: []byte("abc")}, &DataPacket{BlockNumber: 1, Data: []byte("abd")}, false},
+		{"different block", &DataPacket{BlockNumber: 1, Data: []byte("abc")}, &DataPacket{BlockNumber: 2, Data: []byte("abc")}, false},
+		{"DATA and ACK", &DataPacket{BlockNumber: 1}, &AckPacket{BlockNumber: 1}, false},
+		{"RRQ and WRQ", &ReadRequestPacket{Filename: "f", Mode: ModeOctet}, &WriteRequestPacket{Filename: "f", Mode: ModeOctet}, false},
+		{"nil and empty options", &OptionAckPacket{}, &OptionAckPacket{Options: map[string]string{}}, true},
+		{"different options", &OptionAckPacket{Options: map[string]string{"a": "1"}}, &OptionAckPacket{Options: map[string]string{"b": "1"}}, false},
+		{"different message", &ErrorPacket{ErrorCode: 1, ErrorMessage: "a"}, &ErrorPacket{ErrorCode: 1, ErrorMessage: "b"}, false},
+		{"nil packets", nil, nil, true},
+		{"nil and packet", nil, &AckPacket{}, false},
+		{"typed nil and packet", (*DataPacket)(nil), &DataPacket{}, false},
+		{"typed nil and nil", (*AckPacket)(nil), nil, true},
+		{"typed nils", (*ErrorPacket)(nil), (*OptionAckPacket)(nil), true},
+	} {
+		if got := Equal(c.a, c.b); got != c.equal {
+			t.Errorf("%s: Equal = %v, want %v", c.name, got, c.equal)
+		}
+		if got := Equal(c.b, c.a); got != c.equal {
+			t.Errorf("%s: Equal reversed = %v, want %v", c.name, got, c.equal)
+		}
+	}
+}
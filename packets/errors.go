@@ -0,0 +1,204 @@
+package packets
+
+import (
+	"encoding/binary"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/doodles526/go-tftp/errors"
+)
+
+// Error codes carried by an ErrorPacket.
+const (
+	ErrCodeNotDefined        uint16 = 0
+	ErrCodeFileNotFound      uint16 = 1
+	ErrCodeAccessViolation   uint16 = 2
+	ErrCodeDiskFull          uint16 = 3
+	ErrCodeIllegalOperation  uint16 = 4
+	ErrCodeUnknownTransferID uint16 = 5
+	ErrCodeFileExists        uint16 = 6
+	ErrCodeNoSuchUser        uint16 = 7
+	ErrCodeOptionNegotiation uint16 = 8
+)
+
+// DefaultErrorPacketSize is the largest ERROR packet NewErrorPacket
+// builds: the size of a standard DATA packet's payload, which every TFTP
+// implementation can receive.
+const DefaultErrorPacketSize = 512
+
+// NewErrorPacket returns an ERROR packet with code and msg whose encoding
+// is at most DefaultErrorPacketSize bytes long, truncating msg if needed.
+// It fails with errors.ErrorIllegalOperation for a code above 8 or a msg
+// containing a NUL byte.
+func NewErrorPacket(code uint16, msg string) (*ErrorPacket, error) {
+	return NewErrorPacketSize(code, msg, DefaultErrorPacketSize)
+}
+
+// NewErrorPacketSize is NewErrorPacket with a limit of size bytes on the
+// encoded packet, which must be at least 5 for the header and the NUL
+// terminating the message. msg is truncated at a UTF-8 character
+// boundary.
+func NewErrorPacketSize(code uint16, msg string, size int) (*ErrorPacket, error) {
+	if code > ErrCodeOptionNegotiation {
+		return nil, errors.ErrorIllegalOperation("invalid error code " + strconv.Itoa(int(code)))
+	}
+	if size < 5 {
+		return nil, errors.ErrorIllegalOperation("ERROR packet size below 5 bytes")
+	}
+	if err := checkString("error message", msg); err != nil {
+		return nil, err
+	}
+	if max := size - 5; len(msg) > max {
+		for max > 0 && !utf8.RuneStart(msg[max]) {
+			max--
+		}
+		msg = msg[:max]
+	}
+	return &ErrorPacket{ErrorCode: code, ErrorMessage: msg}, nil
+}
+
+// ErrorToPacket builds the ErrorPacket to send to a peer for err. Errors
+// that are not one of the types in the errors package are sent as code 0
+// with err's text as the message.
+func ErrorToPacket(err error) *ErrorPacket {
+	var code uint16
+	switch err.(type) {
+	case errors.ErrorNotDefined:
+		code = ErrCodeNotDefined
+	case errors.ErrorFileNotFound:
+		code = ErrCodeFileNotFound
+	case errors.ErrorAccessViolation:
+		code = ErrCodeAccessViolation
+	case errors.ErrorDiskFull:
+		code = ErrCodeDiskFull
+	case errors.ErrorIllegalOperation:
+		code = ErrCodeIllegalOperation
+	case errors.ErrorUnknownTransferID:
+		code = ErrCodeUnknownTransferID
+	case errors.ErrorFileExists:
+		code = ErrCodeFileExists
+	case errors.ErrorNoSuchUser:
+		code = ErrCodeNoSuchUser
+	case errors.ErrorOptionNegotiation:
+		code = ErrCodeOptionNegotiation
+	default:
+		code = ErrCodeNotDefined
+	}
+	return &ErrorPacket{ErrorCode: code, ErrorMessage: err.Error()}
+}
+
+// Constructors of ERROR packets with each code and its standard message,
+// for callers without an error from the errors package to pass to
+// ErrorToPacket. Those taking a name add it to the message.
+
+// NewNotDefinedError returns an ERROR packet with code 0 and msg, which
+// should describe the problem.
+func NewNotDefinedError(msg string) *ErrorPacket {
+	return ErrorToPacket(errors.ErrorNotDefined(msg))
+}
+
+// NewFileNotFoundError returns an ERROR packet with code 1 for filename.
+func NewFileNotFoundError(filename string) *ErrorPacket {
+	return ErrorToPacket(errors.ErrorFileNotFound(named("file not found", filename)))
+}
+
+// NewAccessViolationError returns an ERROR packet with code 2.
+func NewAccessViolationError() *ErrorPacket {
+	return ErrorToPacket(errors.ErrorAccessViolation(""))
+}
+
+// NewDiskFullError returns an ERROR packet with code 3.
+func NewDiskFullError() *ErrorPacket {
+	return ErrorToPacket(errors.ErrorDiskFull(""))
+}
+
+// NewIllegalOperationError returns an ERROR packet with code 4.
+func NewIllegalOperationError() *ErrorPacket {
+	return ErrorToPacket(errors.ErrorIllegalOperation(""))
+}
+
+// NewUnknownTransferIDError returns an ERROR packet with code 5.
+func NewUnknownTransferIDError() *ErrorPacket {
+	return ErrorToPacket(errors.ErrorUnknownTransferID(""))
+}
+
+// NewFileExistsError returns an ERROR packet with code 6 for filename.
+func NewFileExistsError(filename string) *ErrorPacket {
+	return ErrorToPacket(errors.ErrorFileExists(named("file already exists", filename)))
+}
+
+// NewNoSuchUserError returns an ERROR packet with code 7 for username.
+func NewNoSuchUserError(username string) *ErrorPacket {
+	return ErrorToPacket(errors.ErrorNoSuchUser(named("no such user", username)))
+}
+
+// NewOptionNegotiationError returns an ERROR packet with code 8.
+func NewOptionNegotiationError() *ErrorPacket {
+	return ErrorToPacket(errors.ErrorOptionNegotiation(""))
+}
+
+// named returns msg followed by name, or msg alone if name is empty.
+func named(msg, name string) string {
+	if name == "" {
+		return msg
+	}
+	return msg + ": " + name
+}
+
+// PacketToError converts an ErrorPacket received from a peer into the
+// matching error type. Unknown codes are reported as errors.ErrorNotDefined.
+func PacketToError(p *ErrorPacket) error {
+	msg := p.ErrorMessage
+	switch p.ErrorCode {
+	case ErrCodeFileNotFound:
+		return errors.ErrorFileNotFound(msg)
+	case ErrCodeAccessViolation:
+		return errors.ErrorAccessViolation(msg)
+	case ErrCodeDiskFull:
+		return errors.ErrorDiskFull(msg)
+	case ErrCodeIllegalOperation:
+		return errors.ErrorIllegalOperation(msg)
+	case ErrCodeUnknownTransferID:
+		return errors.ErrorUnknownTransferID(msg)
+	case ErrCodeFileExists:
+		return errors.ErrorFileExists(msg)
+	case ErrCodeNoSuchUser:
+		return errors.ErrorNoSuchUser(msg)
+	case ErrCodeOptionNegotiation:
+		return errors.ErrorOptionNegotiation(msg)
+	}
+	return errors.ErrorNotDefined(msg)
+}
+
+// DecodeError decodes b, which must be an ERROR packet, and returns the
+// error it carries, as PacketToError does. If b is not a valid ERROR
+// packet, the result is an errors.ErrorIllegalOperation describing the
+// problem. The result is never nil.
+func DecodeError(b []byte) error {
+	if len(b) < 2 || Opcode(binary.BigEndian.Uint16(b)) != OpERROR {
+		return errors.ErrorIllegalOperation("not an ERROR packet")
+	}
+	if len(b) == 2 {
+		return bodyMissing(OpERROR)
+	}
+	p, err := decodeErrorPacket(b, false)
+	if err != nil {
+		return err
+	}
+	return PacketToError(p)
+}
+
+// DecodeFailureResponse returns the encoded ERROR packet to send to a peer
+// whose datagram could not be decoded, and whether the caller should drop
+// the transfer. A decode failure always aborts. Errors that are not already
+// a TFTP error type are reported as an illegal operation.
+func DecodeFailureResponse(err error) (errBytes []byte, abort bool) {
+	p := ErrorToPacket(err)
+	if p.ErrorCode == ErrCodeNotDefined {
+		if _, ok := err.(errors.ErrorNotDefined); !ok {
+			p.ErrorCode = ErrCodeIllegalOperation
+		}
+	}
+	errBytes, _ = p.Encode()
+	return errBytes, true
+}
@@ -0,0 +1,221 @@
+package packets
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/doodles526/go-tftp/errors"
+)
+
+func TestOptionNegotiationRoundTrip(t *testing.T) {
+	p := ErrorToPacket(errors.ErrorOptionNegotiation("blksize too large"))
+	if p.ErrorCode != ErrCodeOptionNegotiation || p.ErrorMessage != "blksize too large" {
+		t.Fatalf("ErrorToPacket = %+v, want code 8", p)
+	}
+	b, err := p.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := Decode(b)
+	if err != nil {
+		t.Fatalf("Decode of code 8: %v", err)
+	}
+	err = PacketToError(d.(*ErrorPacket))
+	if _, ok := err.(errors.ErrorOptionNegotiation); !ok || err.Error() != "blksize too large" {
+		t.Errorf("PacketToError = %#v, want ErrorOptionNegotiation", err)
+	}
+}
+
+func TestDecodeErrorCodeBound(t *testing.T) {
+	if _, err := Decode([]byte{0, 5, 0, 8, 'x', 0}); err != nil {
+		t.Errorf("code 8 rejected: %v", err)
+	}
+	if _, err := Decode([]byte{0, 5, 0, 9, 'x', 0}); err == nil {
+		t.Error("code 9 accepted")
+	}
+}
+
+func TestDecodeFailureResponse(t *testing.T) {
+	for _, b := range [][]byte{
+		{0},
+		{0, 99, 'x', 0},
+		{0, 1, 'f', 0, 'o', 'c', 't', 'e', 't'},
+		{0, 4, 0},
+	} {
+		_, err := Decode(b)
+		if err == nil {
+			t.Fatalf("Decode(%v) succeeded", b)
+		}
+		resp, abort := DecodeFailureResponse(err)
+		if !abort {
+			t.Errorf("Decode(%v): abort = false", b)
+		}
+		p, err := Decode(resp)
+		if err != nil {
+			t.Fatalf("response to %v does not decode: %v", b, err)
+		}
+		if ep, ok := p.(*ErrorPacket); !ok || ep.ErrorCode != ErrCodeIllegalOperation {
+			t.Errorf("response to %v = %+v, want code 4", b, p)
+		}
+	}
+}
+
+func TestDecodeFailureResponseKeepsCode(t *testing.T) {
+	resp, _ := DecodeFailureResponse(errors.ErrorNotDefined("busy"))
+	if p, _ := Decode(resp); p.(*ErrorPacket).ErrorCode != ErrCodeNotDefined {
+		t.Errorf("ErrorNotDefined sent as code %d", p.(*ErrorPacket).ErrorCode)
+	}
+}
+
+func TestErrorRoundTrip(t *testing.T) {
+	for _, c := range []struct {
+		err  error
+		code uint16
+	}{
+		{errors.ErrorNotDefined("x"), ErrCodeNotDefined},
+		{errors.ErrorFileNotFound("x"), ErrCodeFileNotFound},
+		{errors.ErrorAccessViolation("x"), ErrCodeAccessViolation},
+		{errors.ErrorDiskFull("x"), ErrCodeDiskFull},
+		{errors.ErrorIllegalOperation("x"), ErrCodeIllegalOperation},
+		{errors.ErrorUnknownTransferID("x"), ErrCodeUnknownTransferID},
+		{errors.ErrorFileExists("x"), ErrCodeFileExists},
+		{errors.ErrorNoSuchUser("x"), ErrCodeNoSuchUser},
+		{errors.ErrorOptionNegotiation("x"), ErrCodeOptionNegotiation},
+	} {
+		p := ErrorToPacket(c.err)
+		if p.ErrorCode != c.code {
+			t.Errorf("ErrorToPacket(%T) has code %d, want %d", c.err, p.ErrorCode, c.code)
+		}
+		back := PacketToError(p)
+		if back != c.err {
+			t.Errorf("code %d: PacketToError = %#v, want %#v", c.code, back, c.err)
+		}
+		if code := ErrorToPacket(back).ErrorCode; code != c.code {
+			t.Errorf("code %d maps back to code %d", c.code, code)
+		}
+	}
+}
+
+func TestPacketToErrorUnknownCode(t *testing.T) {
+	err := PacketToError(&ErrorPacket{ErrorCode: 42, ErrorMessage: "odd"})
+	if err != errors.ErrorNotDefined("odd") {
+		t.Errorf("code 42: %#v, want ErrorNotDefined", err)
+	}
+}
+
+func TestErrorToPacketUntyped(t *testing.T) {
+	p := ErrorToPacket(io.ErrUnexpectedEOF)
+	if p.ErrorCode != ErrCodeNotDefined || p.ErrorMessage != io.ErrUnexpectedEOF.Error() {
+		t.Errorf("got %+v, want code 0 with the error's text", p)
+	}
+}
+
+func TestNewErrorPacket(t *testing.T) {
+	p, err := NewErrorPacket(ErrCodeFileNotFound, "no such file")
+	if err != nil || p.ErrorCode != ErrCodeFileNotFound || p.ErrorMessage != "no such file" {
+		t.Errorf("NewErrorPacket = %+v, %v", p, err)
+	}
+
+	p, err = NewErrorPacket(ErrCodeNotDefined, strings.Repeat("x", 1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := p.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b) != DefaultErrorPacketSize || b[len(b)-1] != 0 {
+		t.Errorf("over-long message encodes to %d bytes ending in %#x, want %d ending in NUL", len(b), b[len(b)-1], DefaultErrorPacketSize)
+	}
+	if d, err := Decode(b); err != nil || d.(*ErrorPacket).ErrorMessage != strings.Repeat("x", DefaultErrorPacketSize-5) {
+		t.Errorf("truncated packet decodes to %+v, %v", d, err)
+	}
+
+	// Truncation does not split a multi-byte character.
+	p, err = NewErrorPacketSize(ErrCodeNotDefined, "ééé", 9)
+	if err != nil || p.ErrorMessage != "éé" {
+		t.Errorf("truncated to %q, %v; want %q", p.ErrorMessage, err, "éé")
+	}
+
+	for _, c := range []struct {
+		code uint16
+		msg  string
+	}{
+		{9, "bad code"},
+		{ErrCodeNotDefined, "nul\x00inside"},
+	} {
+		if p, err := NewErrorPacket(c.code, c.msg); p != nil {
+			t.Errorf("NewErrorPacket(%d, %q) = %+v", c.code, c.msg, p)
+		} else if _, ok := err.(errors.ErrorIllegalOperation); !ok {
+			t.Errorf("NewErrorPacket(%d, %q): %#v, want ErrorIllegalOperation", c.code, c.msg, err)
+		}
+	}
+}
+
+func TestDecodeError(t *testing.T) {
+	for _, want := range []error{
+		errors.ErrorNotDefined("busy"),
+		errors.ErrorFileNotFound("no such file"),
+		errors.ErrorAccessViolation("denied"),
+		errors.ErrorDiskFull("full"),
+		errors.ErrorIllegalOperation("bad"),
+		errors.ErrorUnknownTransferID("who"),
+		errors.ErrorFileExists("exists"),
+		errors.ErrorNoSuchUser("nobody"),
+		errors.ErrorOptionNegotiation("no"),
+	} {
+		b, err := ErrorToPacket(want).Encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := DecodeError(b); err != want {
+			t.Errorf("DecodeError(%q) = %#v, want %#v", b, err, want)
+		}
+	}
+	// Anything but a well-formed ERROR is an illegal operation.
+	for _, b := range [][]byte{
+		{0, 4, 0, 1},
+		{0, 5},
+		{0, 5, 0, 1, 'x'},
+		{0, 5, 0, 9, 'x', 0},
+		{0},
+	} {
+		if _, ok := DecodeError(b).(errors.ErrorIllegalOperation); !ok {
+			t.Errorf("DecodeError(%q) = %#v, want ErrorIllegalOperation", b, DecodeError(b))
+		}
+	}
+}
+
+func TestErrorConstructors(t *testing.T) {
+	for _, c := range []struct {
+		p    *ErrorPacket
+		code uint16
+		msg  string
+	}{
+		{NewNotDefinedError("quota exceeded"), ErrCodeNotDefined, "quota exceeded"},
+		{NewNotDefinedError(""), ErrCodeNotDefined, "not defined"},
+		{NewFileNotFoundError("pxelinux.0"), ErrCodeFileNotFound, "file not found: pxelinux.0"},
+		{NewFileNotFoundError(""), ErrCodeFileNotFound, "file not found"},
+		{NewAccessViolationError(), ErrCodeAccessViolation, "access violation"},
+		{NewDiskFullError(), ErrCodeDiskFull, "disk full or allocation exceeded"},
+		{NewIllegalOperationError(), ErrCodeIllegalOperation, "illegal TFTP operation"},
+		{NewUnknownTransferIDError(), ErrCodeUnknownTransferID, "unknown transfer ID"},
+		{NewFileExistsError("upload"), ErrCodeFileExists, "file already exists: upload"},
+		{NewFileExistsError(""), ErrCodeFileExists, "file already exists"},
+		{NewNoSuchUserError("root"), ErrCodeNoSuchUser, "no such user: root"},
+		{NewNoSuchUserError(""), ErrCodeNoSuchUser, "no such user"},
+		{NewOptionNegotiationError(), ErrCodeOptionNegotiation, "option negotiation failed"},
+	} {
+		if c.p.ErrorCode != c.code || c.p.ErrorMessage != c.msg {
+			t.Errorf("got code %d %q, want code %d %q", c.p.ErrorCode, c.p.ErrorMessage, c.code, c.msg)
+		}
+		if _, err := c.p.Encode(); err != nil {
+			t.Errorf("%q: %v", c.msg, err)
+		}
+		// The packet maps to the error type of its code.
+		if back := ErrorToPacket(PacketToError(c.p)); *back != *c.p {
+			t.Errorf("%q: round trip through PacketToError gives %+v", c.msg, back)
+		}
+	}
+}
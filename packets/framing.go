@@ -0,0 +1,74 @@
+package packets
+
+import (
+	"encoding/binary"
+	"io"
+
+	"github.com/doodles526/go-tftp/errors"
+)
+
+// TFTP relies on datagram boundaries to delimit packets. To carry it over
+// a byte stream such as a TCP connection or a unix socket, Reader and
+// Writer frame each packet with a 2-byte big-endian length prefix:
+//
+//	+--------+--------+------------------------+
+//	| length (uint16) | packet (length bytes)  |
+//	+--------+--------+------------------------+
+//
+// This framing is specific to this package; it is not part of any RFC.
+
+// Reader reads length-prefixed packets from a byte stream.
+type Reader struct {
+	r   io.Reader
+	hdr [2]byte
+}
+
+// NewReader returns a Reader reading framed packets from r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: r}
+}
+
+// ReadPacket reads and decodes the next packet. It returns io.EOF if the
+// stream ends cleanly between packets and io.ErrUnexpectedEOF if it ends
+// inside one. A frame that holds a malformed packet is consumed and its
+// decode error returned, so reading can continue with the next frame.
+func (r *Reader) ReadPacket() (Packet, error) {
+	if _, err := io.ReadFull(r.r, r.hdr[:]); err != nil {
+		return nil, err
+	}
+	b := make([]byte, binary.BigEndian.Uint16(r.hdr[:]))
+	if _, err := io.ReadFull(r.r, b); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return Decode(b)
+}
+
+// Writer writes length-prefixed packets to a byte stream.
+type Writer struct {
+	w io.Writer
+}
+
+// NewWriter returns a Writer writing framed packets to w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// WritePacket encodes p and writes it as one frame, with a single call to
+// the underlying writer.
+func (w *Writer) WritePacket(p Packet) error {
+	b, err := p.Encode()
+	if err != nil {
+		return err
+	}
+	if len(b) > 65535 {
+		return errors.ErrorIllegalOperation("packet too large to frame")
+	}
+	frame := make([]byte, 2+len(b))
+	binary.BigEndian.PutUint16(frame, uint16(len(b)))
+	copy(frame[2:], b)
+	_, err = w.w.Write(frame)
+	return err
+}
@@ -0,0 +1,53 @@
+package packets
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestFramingRoundTrip(t *testing.T) {
+	want := []Packet{
+		&ReadRequestPacket{Filename: "pxelinux.0", Mode: ModeOctet, Options: map[string]string{"blksize": "1468"}},
+		&OptionAckPacket{Options: map[string]string{"blksize": "1468"}},
+		&AckPacket{BlockNumber: 0},
+		&DataPacket{BlockNumber: 1, Data: bytes.Repeat([]byte{0xab}, 1468)},
+		&DataPacket{BlockNumber: 2, Data: []byte{}},
+		&ErrorPacket{ErrorCode: ErrCodeDiskFull, ErrorMessage: "full"},
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		w := NewWriter(pw)
+		for _, p := range want {
+			if err := w.WritePacket(p); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+		pw.Close()
+	}()
+	r := NewReader(pr)
+	for i, p := range want {
+		got, err := r.ReadPacket()
+		if err != nil {
+			t.Fatalf("packet %d: %v", i, err)
+		}
+		if !Equal(got, p) {
+			t.Errorf("packet %d = %+v, want %+v", i, got, p)
+		}
+	}
+	if p, err := r.ReadPacket(); err != io.EOF {
+		t.Errorf("after the last packet: %+v, %v; want io.EOF", p, err)
+	}
+}
+
+func TestFramingTruncated(t *testing.T) {
+	var buf bytes.Buffer
+	if err := NewWriter(&buf).WritePacket(&AckPacket{BlockNumber: 1}); err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+	if _, err := NewReader(bytes.NewReader(b[:len(b)-1])).ReadPacket(); err != io.ErrUnexpectedEOF {
+		t.Errorf("truncated frame: %v, want io.ErrUnexpectedEOF", err)
+	}
+}
@@ -0,0 +1,175 @@
+package packets
+
+import (
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/doodles526/go-tftp/errors"
+)
+
+// Option names understood by this package. Names are case-insensitive on
+// the wire; Decode lowercases them.
+const (
+	OptionBlockSize    = "blksize"    // RFC 2348
+	OptionTimeout      = "timeout"    // RFC 2349
+	OptionTransferSize = "tsize"      // RFC 2349
+	OptionWindowSize   = "windowsize" // RFC 7440
+	OptionMulticast    = "multicast"  // RFC 2090
+
+	// OptionRollover is not standard. Its value, "0" or "1", is the
+	// block number that follows 65535, which some vendor stacks agree on
+	// with it rather than leaving each end to guess.
+	OptionRollover = "rollover"
+
+	// OptionUTimeout is not standard. It is the timeout option with a
+	// value in microseconds, for local networks where whole seconds are
+	// far too coarse. Peers that support both prefer it to timeout.
+	OptionUTimeout = "utimeout"
+
+	// OptionChecksum is not standard. With a value of "1" it asks for a
+	// CRC-32 (IEEE) of each DATA payload to be appended to the payload,
+	// big-endian. Peers that do not know it leave it out of their OACK,
+	// and the transfer proceeds without checksums.
+	OptionChecksum = "x-crc32"
+)
+
+// Limits on the values of the standard options.
+const (
+	MinBlockSize  = 8     // RFC 2348
+	MaxBlockSize  = 65464 // RFC 2348
+	MinTimeout    = 1     // RFC 2349, seconds
+	MaxTimeout    = 255   // RFC 2349, seconds
+	MaxWindowSize = 65535 // RFC 7440
+
+	// Limits on utimeout, in microseconds: from 10ms, below which
+	// retransmissions would outpace most hosts' scheduling, to the
+	// largest timeout.
+	MinUTimeout = 10000
+	MaxUTimeout = MaxTimeout * 1000000
+)
+
+// ParsedOptions holds the standard options of a request as typed values.
+// BlockSize, Timeout and WindowSize are zero, and TransferSize is -1, when
+// the option is absent or malformed.
+type ParsedOptions struct {
+	// BlockSize is the requested blksize. Values above MaxBlockSize are
+	// lowered to it, as a server may always offer a smaller block.
+	BlockSize int
+	// Timeout is the requested timeout, between MinTimeout and
+	// MaxTimeout seconds.
+	Timeout time.Duration
+	// TransferSize is the tsize value: 0 in a read request, the file
+	// size in a write request.
+	TransferSize int64
+	// WindowSize is the requested windowsize, between 1 and
+	// MaxWindowSize.
+	WindowSize int
+	// Malformed lists, in sorted order, the standard options whose values
+	// are not numbers or are out of range. Unknown options are ignored.
+	Malformed []string
+}
+
+// ParseOptions interprets the standard options in the Options of a
+// decoded request. Each malformed option is listed in Malformed, so the
+// caller can choose between ignoring it, as RFC 2347 allows, and rejecting
+// the request.
+func ParseOptions(options map[string]string) *ParsedOptions {
+	p := &ParsedOptions{TransferSize: -1}
+	for name, value := range options {
+		var ok bool
+		switch name {
+		case OptionBlockSize:
+			var n int
+			if n, ok = parseRange(value, MinBlockSize, math.MaxInt); ok {
+				p.BlockSize = min(n, MaxBlockSize)
+			}
+		case OptionTimeout:
+			var n int
+			if n, ok = parseRange(value, MinTimeout, MaxTimeout); ok {
+				p.Timeout = time.Duration(n) * time.Second
+			}
+		case OptionTransferSize:
+			n, err := strconv.ParseInt(value, 10, 64)
+			if ok = err == nil && n >= 0; ok {
+				p.TransferSize = n
+			}
+		case OptionWindowSize:
+			p.WindowSize, ok = parseRange(value, 1, MaxWindowSize)
+		default:
+			continue
+		}
+		if !ok {
+			p.Malformed = append(p.Malformed, name)
+		}
+	}
+	sort.Strings(p.Malformed)
+	return p
+}
+
+// parseRange parses a decimal integer between lo and hi, returning 0 and
+// false if value is not one.
+func parseRange(value string, lo, hi int) (int, bool) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < lo || n > hi {
+		return 0, false
+	}
+	return n, true
+}
+
+// MulticastOption is the value of the multicast option in an OACK, of the
+// form "addr,port,mc". The address and port may be left empty in OACKs
+// that only change which client is the master, in which case Addr is nil
+// and Port is 0.
+type MulticastOption struct {
+	Addr   net.IP
+	Port   int
+	Master bool
+}
+
+// ParseMulticastOption parses the value of a multicast option.
+func ParseMulticastOption(value string) (*MulticastOption, error) {
+	fields := strings.Split(value, ",")
+	if len(fields) != 3 {
+		return nil, errors.ErrorOptionNegotiation("malformed multicast option")
+	}
+	m := new(MulticastOption)
+	if fields[0] != "" {
+		if m.Addr = net.ParseIP(fields[0]); m.Addr == nil || !m.Addr.IsMulticast() {
+			return nil, errors.ErrorOptionNegotiation("invalid multicast address")
+		}
+	}
+	if fields[1] != "" {
+		port, err := strconv.Atoi(fields[1])
+		if err != nil || port < 1 || port > 65535 {
+			return nil, errors.ErrorOptionNegotiation("invalid multicast port")
+		}
+		m.Port = port
+	}
+	switch fields[2] {
+	case "1":
+		m.Master = true
+	case "0":
+	default:
+		return nil, errors.ErrorOptionNegotiation("invalid multicast master flag")
+	}
+	return m, nil
+}
+
+// MulticastMaster reports whether the OACK designates the receiving client
+// as the master client of a multicast transfer. It returns an error if the
+// OACK carries no multicast option or the option is malformed.
+func (p *OptionAckPacket) MulticastMaster() (bool, error) {
+	value, ok := p.Options[OptionMulticast]
+	if !ok {
+		return false, errors.ErrorOptionNegotiation("no multicast option")
+	}
+	m, err := ParseMulticastOption(value)
+	if err != nil {
+		return false, err
+	}
+	return m.Master, nil
+}
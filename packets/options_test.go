@@ -0,0 +1,75 @@
+package packets
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMulticastMaster(t *testing.T) {
+	for _, c := range []struct {
+		value  string
+		master bool
+	}{
+		{"224.1.2.3,1758,1", true},
+		{"224.1.2.3,1758,0", false},
+		{",,1", true},
+		{",,0", false},
+	} {
+		oack := &OptionAckPacket{Options: map[string]string{OptionMulticast: c.value}}
+		master, err := oack.MulticastMaster()
+		if err != nil || master != c.master {
+			t.Errorf("MulticastMaster(%q) = %v, %v, want %v", c.value, master, err, c.master)
+		}
+	}
+}
+
+func TestParseMulticastOption(t *testing.T) {
+	m, err := ParseMulticastOption("224.1.2.3,1758,1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.Addr.Equal(net.IPv4(224, 1, 2, 3)) || m.Port != 1758 || !m.Master {
+		t.Errorf("got %+v", m)
+	}
+	for _, value := range []string{
+		"",
+		"224.1.2.3,1758",
+		"224.1.2.3,1758,2",
+		"10.0.0.1,1758,1",
+		"224.1.2.3,0,1",
+		"224.1.2.3,port,1",
+	} {
+		if _, err := ParseMulticastOption(value); err == nil {
+			t.Errorf("ParseMulticastOption(%q) succeeded", value)
+		}
+	}
+	if _, err := (&OptionAckPacket{}).MulticastMaster(); err == nil {
+		t.Error("MulticastMaster without the option succeeded")
+	}
+}
+
+func TestParseOptions(t *testing.T) {
+	for _, c := range []struct {
+		name    string
+		options map[string]string
+		want    ParsedOptions
+	}{
+		{"valid", map[string]string{"blksize": "1468", "timeout": "3", "tsize": "0", "windowsize": "8", "vendor": "x"},
+			ParsedOptions{BlockSize: 1468, Timeout: 3 * time.Second, TransferSize: 0, WindowSize: 8}},
+		{"blksize lowered", map[string]string{"blksize": "100000"},
+			ParsedOptions{BlockSize: MaxBlockSize, TransferSize: -1}},
+		{"blksize too small", map[string]string{"blksize": "7"},
+			ParsedOptions{TransferSize: -1, Malformed: []string{"blksize"}}},
+		{"non-numeric timeout", map[string]string{"timeout": "soon", "blksize": "1024"},
+			ParsedOptions{BlockSize: 1024, TransferSize: -1, Malformed: []string{"timeout"}}},
+		{"several malformed", map[string]string{"timeout": "0", "tsize": "-1", "windowsize": "65536"},
+			ParsedOptions{TransferSize: -1, Malformed: []string{"timeout", "tsize", "windowsize"}}},
+		{"none", nil, ParsedOptions{TransferSize: -1}},
+	} {
+		if got := ParseOptions(c.options); !reflect.DeepEqual(*got, c.want) {
+			t.Errorf("%s: got %+v, want %+v", c.name, *got, c.want)
+		}
+	}
+}
@@ -0,0 +1,380 @@
+// Package packets implements encoding and decoding of TFTP packets as
+// defined by RFC 1350, with the option extension of RFC 2347.
+package packets
+
+import (
+	"encoding/binary"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/doodles526/go-tftp/errors"
+)
+
+// Opcode identifies the type of a TFTP packet.
+type Opcode uint16
+
+const (
+	OpRRQ   Opcode = 1 // read request
+	OpWRQ   Opcode = 2 // write request
+	OpDATA  Opcode = 3 // data
+	OpACK   Opcode = 4 // acknowledgment
+	OpERROR Opcode = 5 // error
+	OpOACK  Opcode = 6 // option acknowledgment (RFC 2347)
+)
+
+func (o Opcode) String() string {
+	switch o {
+	case OpRRQ:
+		return "RRQ"
+	case OpWRQ:
+		return "WRQ"
+	case OpDATA:
+		return "DATA"
+	case OpACK:
+		return "ACK"
+	case OpERROR:
+		return "ERROR"
+	case OpOACK:
+		return "OACK"
+	}
+	return "UNKNOWN"
+}
+
+// Transfer modes accepted in a request.
+const (
+	ModeNetASCII = "netascii"
+	ModeOctet    = "octet"
+	ModeMail     = "mail"
+)
+
+// A Packet is any TFTP packet that can be written to the wire.
+type Packet interface {
+	Opcode() Opcode
+	Encode() ([]byte, error)
+}
+
+// ReadRequestPacket is an RRQ. Options holds any RFC 2347 options that
+// were requested. Decode leaves it nil when the request carried none, and
+// Encode writes nothing after the mode for a nil or empty map. Encode
+// writes options sorted by name, except that a decoded packet whose set
+// of option names is unchanged keeps the order and case they were
+// received in, so that it encodes to the bytes it was decoded from.
+type ReadRequestPacket struct {
+	Filename string
+	Mode     string
+	Options  map[string]string
+
+	order []string // option names as decoded
+}
+
+func (p *ReadRequestPacket) Opcode() Opcode { return OpRRQ }
+
+func (p *ReadRequestPacket) Encode() ([]byte, error) {
+	b, err := p.EncodeAppend(make([]byte, 0, p.EncodedLen()))
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (p *ReadRequestPacket) EncodeAppend(dst []byte) ([]byte, error) {
+	return appendRequest(dst, OpRRQ, p.Filename, p.Mode, p.Options, p.order)
+}
+
+func (p *ReadRequestPacket) EncodedLen() int {
+	return requestLen(p.Filename, p.Mode, p.Options, p.order)
+}
+
+// WriteRequestPacket is a WRQ. Options holds any RFC 2347 options that
+// were requested. Decode leaves it nil when the request carried none, and
+// Encode writes nothing after the mode for a nil or empty map. Options
+// are written as for a ReadRequestPacket.
+type WriteRequestPacket struct {
+	Filename string
+	Mode     string
+	Options  map[string]string
+
+	order []string // option names as decoded
+}
+
+func (p *WriteRequestPacket) Opcode() Opcode { return OpWRQ }
+
+func (p *WriteRequestPacket) Encode() ([]byte, error) {
+	b, err := p.EncodeAppend(make([]byte, 0, p.EncodedLen()))
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (p *WriteRequestPacket) EncodeAppend(dst []byte) ([]byte, error) {
+	return appendRequest(dst, OpWRQ, p.Filename, p.Mode, p.Options, p.order)
+}
+
+func (p *WriteRequestPacket) EncodedLen() int {
+	return requestLen(p.Filename, p.Mode, p.Options, p.order)
+}
+
+// DataPacket carries one block of a transfer.
+//
+// The Data of a DataPacket returned by Decode or DecodeData aliases the
+// decoded buffer, so it is overwritten when the buffer is reused for the
+// next read. Use Clone to keep a packet beyond that.
+type DataPacket struct {
+	BlockNumber uint16
+	Data        []byte
+}
+
+func (p *DataPacket) Opcode() Opcode { return OpDATA }
+
+// Clone returns a copy of p with its own copy of Data.
+func (p *DataPacket) Clone() *DataPacket {
+	return &DataPacket{BlockNumber: p.BlockNumber, Data: append([]byte(nil), p.Data...)}
+}
+
+func (p *DataPacket) Encode() ([]byte, error) {
+	return p.EncodeAppend(make([]byte, 0, p.EncodedLen()))
+}
+
+// EncodeAppend appends the encoded packet to dst, growing it if needed,
+// and returns the extended slice, in the manner of strconv.AppendInt.
+// Every packet type has this method. If the packet cannot be encoded, it
+// returns dst unchanged and the error Encode would return.
+func (p *DataPacket) EncodeAppend(dst []byte) ([]byte, error) {
+	dst = binary.BigEndian.AppendUint16(dst, uint16(OpDATA))
+	dst = binary.BigEndian.AppendUint16(dst, p.BlockNumber)
+	return append(dst, p.Data...), nil
+}
+
+// EncodeBuffers returns p encoded as two buffers, the 4-byte header and
+// p.Data itself, whose concatenation is what Encode returns. Writing them
+// with net.Buffers.WriteTo to a connected UDP socket sends them as one
+// datagram with a vectored write, without copying the payload. As
+// p.Data is not copied, it must not be modified until the write is done.
+func (p *DataPacket) EncodeBuffers() net.Buffers {
+	h := make([]byte, 4)
+	binary.BigEndian.PutUint16(h, uint16(OpDATA))
+	binary.BigEndian.PutUint16(h[2:], p.BlockNumber)
+	return net.Buffers{h, p.Data}
+}
+
+// EncodedLen returns the length of the packet Encode returns, without
+// encoding it. Every packet type has this method; for a packet that
+// Encode rejects, the result is meaningless.
+func (p *DataPacket) EncodedLen() int {
+	return 4 + len(p.Data)
+}
+
+// AckPacket acknowledges a DATA block, or a WRQ or OACK with block 0.
+type AckPacket struct {
+	BlockNumber uint16
+}
+
+// IsFinal reports whether p is the last block of a transfer using
+// blockSize-byte blocks, which is the case when its payload is shorter than
+// a full block. A file whose size is an exact multiple of blockSize ends
+// with an empty block, for which IsFinal is true as well.
+func (p *DataPacket) IsFinal(blockSize int) bool {
+	return len(p.Data) < blockSize
+}
+
+func (p *AckPacket) Opcode() Opcode { return OpACK }
+
+func (p *AckPacket) Encode() ([]byte, error) {
+	return p.EncodeAppend(make([]byte, 0, p.EncodedLen()))
+}
+
+func (p *AckPacket) EncodeAppend(dst []byte) ([]byte, error) {
+	dst = binary.BigEndian.AppendUint16(dst, uint16(OpACK))
+	return binary.BigEndian.AppendUint16(dst, p.BlockNumber), nil
+}
+
+func (p *AckPacket) EncodedLen() int {
+	return 4
+}
+
+// ErrorPacket terminates a transfer. ErrorCode is one of the codes
+// described in the errors package.
+type ErrorPacket struct {
+	ErrorCode    uint16
+	ErrorMessage string
+}
+
+func (p *ErrorPacket) Opcode() Opcode { return OpERROR }
+
+func (p *ErrorPacket) Encode() ([]byte, error) {
+	b, err := p.EncodeAppend(make([]byte, 0, p.EncodedLen()))
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (p *ErrorPacket) EncodeAppend(dst []byte) ([]byte, error) {
+	if err := checkString("error message", p.ErrorMessage); err != nil {
+		return dst, err
+	}
+	dst = binary.BigEndian.AppendUint16(dst, uint16(OpERROR))
+	dst = binary.BigEndian.AppendUint16(dst, p.ErrorCode)
+	dst = append(dst, p.ErrorMessage...)
+	return append(dst, 0), nil
+}
+
+func (p *ErrorPacket) EncodedLen() int {
+	return 5 + len(p.ErrorMessage)
+}
+
+// OptionAckPacket is an OACK, sent in reply to a request to list the
+// options the responder accepted. Encode writes them as for a
+// ReadRequestPacket.
+type OptionAckPacket struct {
+	Options map[string]string
+
+	order []string // option names as decoded
+}
+
+func (p *OptionAckPacket) Opcode() Opcode { return OpOACK }
+
+func (p *OptionAckPacket) Encode() ([]byte, error) {
+	b, err := p.EncodeAppend(make([]byte, 0, p.EncodedLen()))
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (p *OptionAckPacket) EncodeAppend(dst []byte) ([]byte, error) {
+	if err := checkOptions(p.Options); err != nil {
+		return dst, err
+	}
+	dst = binary.BigEndian.AppendUint16(dst, uint16(OpOACK))
+	return appendOptions(dst, p.Options, p.order), nil
+}
+
+func (p *OptionAckPacket) EncodedLen() int {
+	return 2 + optionsLen(p.Options, p.order)
+}
+
+// MaxFilenameLength is the longest filename, in bytes, that requests are
+// encoded or decoded with. Longer filenames are rejected with an
+// errors.ErrorIllegalOperation.
+const MaxFilenameLength = 255
+
+// appendRequest appends an encoded request to dst, or returns dst
+// unchanged if the request cannot be encoded.
+func appendRequest(dst []byte, op Opcode, filename, mode string, options map[string]string, order []string) ([]byte, error) {
+	if err := checkString("filename", filename); err != nil {
+		return dst, err
+	}
+	if len(filename) > MaxFilenameLength {
+		return dst, errors.ErrorIllegalOperation("filename too long")
+	}
+	if err := checkString("mode", mode); err != nil {
+		return dst, err
+	}
+	if err := checkOptions(options); err != nil {
+		return dst, err
+	}
+	dst = binary.BigEndian.AppendUint16(dst, uint16(op))
+	dst = append(dst, filename...)
+	dst = append(dst, 0)
+	dst = append(dst, mode...)
+	dst = append(dst, 0)
+	return appendOptions(dst, options, order), nil
+}
+
+// requestLen returns the encoded length of a request.
+func requestLen(filename, mode string, options map[string]string, order []string) int {
+	return 2 + len(filename) + 1 + len(mode) + 1 + optionsLen(options, order)
+}
+
+// optionsLen returns the length appendOptions appends for options and
+// order. The names written from order may differ in length from the keys
+// of options, as lowercasing some characters changes their encoding.
+func optionsLen(options map[string]string, order []string) int {
+	n := 0
+	if sameNames(options, order) {
+		for _, name := range order {
+			n += len(name) + 1 + len(options[strings.ToLower(name)]) + 1
+		}
+		return n
+	}
+	for name, value := range options {
+		n += len(name) + 1 + len(value) + 1
+	}
+	return n
+}
+
+// appendOptions appends options as NUL-terminated name/value pairs. If
+// order names the options of the map, as received, they are written in
+// that order and case; otherwise they are sorted by name so that a packet
+// always encodes to the same bytes. A nil or empty map appends nothing,
+// not even a terminating NUL.
+func appendOptions(dst []byte, options map[string]string, order []string) []byte {
+	if sameNames(options, order) {
+		for _, name := range order {
+			dst = appendOption(dst, name, options[strings.ToLower(name)])
+		}
+		return dst
+	}
+	names := make([]string, 0, len(options))
+	for name := range options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		dst = appendOption(dst, name, options[name])
+	}
+	return dst
+}
+
+func appendOption(dst []byte, name, value string) []byte {
+	dst = append(dst, name...)
+	dst = append(dst, 0)
+	dst = append(dst, value...)
+	return append(dst, 0)
+}
+
+// sameNames reports whether order holds each name of options exactly once,
+// in any case.
+func sameNames(options map[string]string, order []string) bool {
+	if order == nil || len(order) != len(options) {
+		return false
+	}
+	seen := make(map[string]bool, len(order))
+	for _, name := range order {
+		lower := strings.ToLower(name)
+		if _, ok := options[lower]; !ok || seen[lower] {
+			return false
+		}
+		seen[lower] = true
+	}
+	return true
+}
+
+// checkString rejects a string field containing a NUL byte, which would be
+// read back as the end of the field and corrupt the rest of the packet.
+func checkString(field, s string) error {
+	if strings.IndexByte(s, 0) >= 0 {
+		return errors.ErrorIllegalOperation("NUL byte in " + field)
+	}
+	return nil
+}
+
+// checkOptions rejects the options that decodeOptions would: those whose
+// name is empty or whose name or value holds a NUL byte.
+func checkOptions(options map[string]string) error {
+	for name, value := range options {
+		if name == "" {
+			return errors.ErrorIllegalOperation("empty option name")
+		}
+		if err := checkString("option name", name); err != nil {
+			return err
+		}
+		if err := checkString("option "+name, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,287 @@
+package packets
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/doodles526/go-tftp/errors"
+)
+
+func TestRequestNilOptions(t *testing.T) {
+	for _, p := range []Packet{
+		&ReadRequestPacket{Filename: "f", Mode: ModeOctet},
+		&ReadRequestPacket{Filename: "f", Mode: ModeOctet, Options: map[string]string{}},
+		&WriteRequestPacket{Filename: "f", Mode: ModeOctet},
+		&WriteRequestPacket{Filename: "f", Mode: ModeOctet, Options: map[string]string{}},
+	} {
+		b, err := p.Encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Nothing, not even a NUL, after the mode's terminator.
+		want := append([]byte{0, byte(p.Opcode())}, "f\x00octet\x00"...)
+		if !bytes.Equal(b, want) {
+			t.Errorf("%T with options %v encodes to %q, want %q", p, options(p), b, want)
+		}
+		d, err := Decode(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if o := options(d); o != nil {
+			t.Errorf("decoded %T has options %#v, want nil", d, o)
+		}
+	}
+}
+
+func TestRequestOptionsRoundTrip(t *testing.T) {
+	p := &ReadRequestPacket{Filename: "f", Mode: ModeOctet, Options: map[string]string{OptionBlockSize: "1024"}}
+	b, err := p.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := Decode(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o := options(d); len(o) != 1 || o[OptionBlockSize] != "1024" {
+		t.Errorf("decoded options %v, want blksize 1024", o)
+	}
+}
+
+func options(p Packet) map[string]string {
+	switch p := p.(type) {
+	case *ReadRequestPacket:
+		return p.Options
+	case *WriteRequestPacket:
+		return p.Options
+	case *OptionAckPacket:
+		return p.Options
+	}
+	return nil
+}
+
+func TestEncodeRejectsNUL(t *testing.T) {
+	for _, p := range []Packet{
+		&ReadRequestPacket{Filename: "a\x00b", Mode: ModeOctet},
+		&ReadRequestPacket{Filename: "f", Mode: "oc\x00tet"},
+		&WriteRequestPacket{Filename: "a\x00b", Mode: ModeOctet},
+		&WriteRequestPacket{Filename: "f", Mode: "oc\x00tet"},
+		&ErrorPacket{ErrorCode: ErrCodeNotDefined, ErrorMessage: "bad\x00message"},
+	} {
+		b, err := p.Encode()
+		if _, ok := err.(errors.ErrorIllegalOperation); !ok {
+			t.Errorf("%+v encoded to %q, %v; want ErrorIllegalOperation", p, b, err)
+		}
+	}
+}
+
+func TestEncodeRejectsEmptyOptionName(t *testing.T) {
+	options := map[string]string{"": "x", OptionBlockSize: "1024"}
+	for _, p := range []Packet{
+		&ReadRequestPacket{Filename: "f", Mode: ModeOctet, Options: options},
+		&WriteRequestPacket{Filename: "f", Mode: ModeOctet, Options: options},
+		&OptionAckPacket{Options: options},
+	} {
+		b, err := p.Encode()
+		if _, ok := err.(errors.ErrorIllegalOperation); !ok {
+			t.Errorf("%+v encoded to %q, %v; want ErrorIllegalOperation", p, b, err)
+		}
+	}
+	// As Decode rejects it.
+	if p, err := Decode([]byte("\x00\x06\x00x\x00")); err == nil {
+		t.Errorf("decoded an empty option name as %+v", p)
+	}
+}
+
+func TestEncodeStringsRoundTrip(t *testing.T) {
+	for _, p := range []Packet{
+		&ReadRequestPacket{Filename: "dir/file name.bin", Mode: ModeNetASCII},
+		&WriteRequestPacket{Filename: "upload", Mode: ModeOctet},
+		&ErrorPacket{ErrorCode: ErrCodeDiskFull, ErrorMessage: "no space left"},
+	} {
+		b, err := p.Encode()
+		if err != nil {
+			t.Fatalf("%+v: %v", p, err)
+		}
+		d, err := Decode(b)
+		if err != nil {
+			t.Fatalf("%+v: %v", p, err)
+		}
+		if !Equal(d, p) {
+			t.Errorf("decoded %+v, want %+v", d, p)
+		}
+	}
+}
+
+func TestIsFinal(t *testing.T) {
+	for _, c := range []struct {
+		size  int
+		final bool
+	}{
+		{511, true},
+		{512, false},
+		// A file that is a multiple of the block size ends with an empty
+		// block.
+		{0, true},
+	} {
+		if got := (&DataPacket{BlockNumber: 1, Data: make([]byte, c.size)}).IsFinal(512); got != c.final {
+			t.Errorf("IsFinal with %d bytes = %v, want %v", c.size, got, c.final)
+		}
+	}
+}
+
+func TestEncodeDeterministic(t *testing.T) {
+	options := map[string]string{
+		"blksize": "1468", "timeout": "3", "tsize": "0", "windowsize": "16",
+		"rollover": "0", "utimeout": "500000", "vendor-a": "1", "vendor-b": "2",
+	}
+	for _, p := range []Packet{
+		&ReadRequestPacket{Filename: "f", Mode: ModeOctet, Options: options},
+		&WriteRequestPacket{Filename: "f", Mode: ModeOctet, Options: options},
+		&OptionAckPacket{Options: options},
+	} {
+		first, err := p.Encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Map iteration order varies from one range to the next, so a
+		// few tries would catch an unsorted encoding.
+		for i := 0; i < 20; i++ {
+			if b, _ := p.Encode(); !bytes.Equal(b, first) {
+				t.Fatalf("%T encodes to %q, then %q", p, first, b)
+			}
+		}
+	}
+}
+
+func TestDecodedRequestKeepsOrder(t *testing.T) {
+	b := []byte("\x00\x01f\x00octet\x00tsize\x000\x00BlkSize\x001024\x00")
+	p, err := Decode(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, _ := p.Encode(); !bytes.Equal(e, b) {
+		t.Errorf("re-encoded as %q, want %q", e, b)
+	}
+}
+
+func TestDataPacketClone(t *testing.T) {
+	buf := []byte{0, 3, 0, 9, 'a', 'b', 'c'}
+	p, err := Decode(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := p.(*DataPacket)
+	c := d.Clone()
+	// Reuse the buffer, as a read loop would.
+	copy(buf, []byte{0, 3, 0, 10, 'x', 'y', 'z'})
+	if string(d.Data) != "xyz" {
+		t.Fatalf("decoded payload %q does not alias the buffer", d.Data)
+	}
+	if c.BlockNumber != 9 || string(c.Data) != "abc" {
+		t.Errorf("clone changed to %+v", c)
+	}
+}
+
+func TestEncodedLen(t *testing.T) {
+	for _, p := range []interface {
+		Packet
+		EncodedLen() int
+	}{
+		&ReadRequestPacket{Filename: "f", Mode: ModeOctet},
+		&ReadRequestPacket{Filename: "boot/pxelinux.0", Mode: ModeNetASCII, Options: map[string]string{OptionBlockSize: "1468", OptionTransferSize: "0"}},
+		&WriteRequestPacket{Filename: "upload", Mode: ModeOctet, Options: map[string]string{OptionWindowSize: "16"}},
+		&DataPacket{BlockNumber: 1},
+		&DataPacket{BlockNumber: 7, Data: make([]byte, 512)},
+		&AckPacket{BlockNumber: 65535},
+		&ErrorPacket{ErrorCode: 1, ErrorMessage: "file not found"},
+		&ErrorPacket{},
+		&OptionAckPacket{},
+		&OptionAckPacket{Options: map[string]string{OptionBlockSize: "1024", OptionTimeout: "3"}},
+	} {
+		b, err := p.Encode()
+		if err != nil {
+			t.Fatalf("%+v: %v", p, err)
+		}
+		if n := p.EncodedLen(); n != len(b) {
+			t.Errorf("%T%+v: EncodedLen = %d, Encode returned %d bytes", p, p, n, len(b))
+		}
+	}
+}
+
+func TestEncodeBuffers(t *testing.T) {
+	for _, p := range []*DataPacket{
+		{BlockNumber: 1},
+		{BlockNumber: 7, Data: []byte("abc")},
+		{BlockNumber: 65535, Data: make([]byte, 512)},
+	} {
+		want, err := p.Encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		bufs := p.EncodeBuffers()
+		if len(bufs) != 2 || len(bufs[0]) != 4 {
+			t.Fatalf("DATA %d: got %d buffers, want a 4-byte header and the payload", p.BlockNumber, len(bufs))
+		}
+		if got := bytes.Join(bufs, nil); !bytes.Equal(got, want) {
+			t.Errorf("DATA %d: buffers concatenate to %x, Encode returned %x", p.BlockNumber, got, want)
+		}
+		if len(p.Data) > 0 && &bufs[1][0] != &p.Data[0] {
+			t.Errorf("DATA %d: payload copied", p.BlockNumber)
+		}
+	}
+}
+
+func TestEncodeAppend(t *testing.T) {
+	type appender interface {
+		Packet
+		EncodeAppend(dst []byte) ([]byte, error)
+	}
+	all := []appender{
+		&ReadRequestPacket{Filename: "f", Mode: ModeOctet, Options: map[string]string{OptionBlockSize: "1024"}},
+		&WriteRequestPacket{Filename: "upload", Mode: ModeNetASCII},
+		&DataPacket{BlockNumber: 7, Data: []byte("abc")},
+		&AckPacket{BlockNumber: 65535},
+		&ErrorPacket{ErrorCode: 1, ErrorMessage: "file not found"},
+		&OptionAckPacket{Options: map[string]string{OptionTimeout: "3"}},
+	}
+	for _, a := range all {
+		for _, b := range all {
+			want := []byte("prefix")
+			for _, p := range []appender{a, b} {
+				enc, err := p.Encode()
+				if err != nil {
+					t.Fatal(err)
+				}
+				want = append(want, enc...)
+			}
+			// Too small to start with, so the buffer has to grow.
+			buf := append(make([]byte, 0, 8), "prefix"...)
+			buf, err := a.EncodeAppend(buf)
+			if err == nil {
+				buf, err = b.EncodeAppend(buf)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(buf, want) {
+				t.Errorf("%T then %T: appended %x, want %x", a, b, buf, want)
+			}
+		}
+	}
+	// With room enough, the bytes go into dst itself.
+	buf := make([]byte, 0, 64)
+	out, err := (&AckPacket{BlockNumber: 1}).EncodeAppend(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if &out[:1][0] != &buf[:1][0] {
+		t.Error("EncodeAppend reallocated a buffer with room to spare")
+	}
+	// A packet that cannot be encoded leaves dst as it was.
+	dst := []byte("prefix")
+	out, err = (&ReadRequestPacket{Filename: "a\x00b", Mode: ModeOctet}).EncodeAppend(dst)
+	if err == nil || string(out) != "prefix" {
+		t.Errorf("invalid request: EncodeAppend returned %q, %v", out, err)
+	}
+}
@@ -0,0 +1,121 @@
+package packets
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/doodles526/go-tftp/errors"
+)
+
+// RequestOption sets an RFC 2347 option on a request built with
+// NewReadRequest or NewWriteRequest.
+type RequestOption func(options map[string]string)
+
+// WithOption sets the option name to value. Names are case-insensitive
+// and are stored lowercased.
+func WithOption(name, value string) RequestOption {
+	return func(options map[string]string) {
+		options[strings.ToLower(name)] = value
+	}
+}
+
+// WithBlockSize requests the blksize option (RFC 2348).
+func WithBlockSize(size int) RequestOption {
+	return WithOption(OptionBlockSize, strconv.Itoa(size))
+}
+
+// WithTimeout requests the timeout option, in seconds (RFC 2349).
+func WithTimeout(seconds int) RequestOption {
+	return WithOption(OptionTimeout, strconv.Itoa(seconds))
+}
+
+// WithTransferSize sends the tsize option (RFC 2349): the size of the file
+// for a write request, or 0 to ask for it in a read request.
+func WithTransferSize(size int64) RequestOption {
+	return WithOption(OptionTransferSize, strconv.FormatInt(size, 10))
+}
+
+// WithWindowSize requests the windowsize option (RFC 7440).
+func WithWindowSize(size int) RequestOption {
+	return WithOption(OptionWindowSize, strconv.Itoa(size))
+}
+
+// WithUTimeout requests the utimeout option (see OptionUTimeout), in
+// microseconds.
+func WithUTimeout(microseconds int) RequestOption {
+	return WithOption(OptionUTimeout, strconv.Itoa(microseconds))
+}
+
+// WithRollover requests the rollover option (see OptionRollover); to is
+// 0 or 1.
+func WithRollover(to int) RequestOption {
+	return WithOption(OptionRollover, strconv.Itoa(to))
+}
+
+// WithChecksum requests per-block CRC-32 checksums (see OptionChecksum).
+func WithChecksum() RequestOption {
+	return WithOption(OptionChecksum, "1")
+}
+
+// WithMulticast requests a multicast transfer (RFC 2090). The option's
+// value is empty in requests.
+func WithMulticast() RequestOption {
+	return WithOption(OptionMulticast, "")
+}
+
+// NewReadRequest returns an RRQ for filename in mode, which defaults to
+// octet when empty. It rejects requests that would not survive encoding:
+// an empty filename or one longer than MaxFilenameLength, an unknown
+// mode, or a NUL byte in any string.
+func NewReadRequest(filename, mode string, opts ...RequestOption) (*ReadRequestPacket, error) {
+	mode, options, err := buildRequest(filename, mode, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &ReadRequestPacket{Filename: filename, Mode: mode, Options: options}, nil
+}
+
+// NewWriteRequest returns a WRQ, validated as for NewReadRequest.
+func NewWriteRequest(filename, mode string, opts ...RequestOption) (*WriteRequestPacket, error) {
+	mode, options, err := buildRequest(filename, mode, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &WriteRequestPacket{Filename: filename, Mode: mode, Options: options}, nil
+}
+
+func buildRequest(filename, mode string, opts []RequestOption) (string, map[string]string, error) {
+	if filename == "" {
+		return "", nil, errors.ErrorIllegalOperation("empty filename")
+	}
+	if strings.IndexByte(filename, 0) >= 0 {
+		return "", nil, errors.ErrorIllegalOperation("NUL byte in filename")
+	}
+	if len(filename) > MaxFilenameLength {
+		return "", nil, errors.ErrorIllegalOperation("filename too long")
+	}
+	if mode == "" {
+		mode = ModeOctet
+	}
+	switch strings.ToLower(mode) {
+	case ModeNetASCII, ModeOctet, ModeMail:
+	default:
+		return "", nil, errors.ErrorIllegalOperation("unknown mode " + mode)
+	}
+	if len(opts) == 0 {
+		return mode, nil, nil
+	}
+	options := make(map[string]string, len(opts))
+	for _, opt := range opts {
+		opt(options)
+	}
+	for name, value := range options {
+		if name == "" {
+			return "", nil, errors.ErrorIllegalOperation("empty option name")
+		}
+		if strings.IndexByte(name, 0) >= 0 || strings.IndexByte(value, 0) >= 0 {
+			return "", nil, errors.ErrorIllegalOperation("NUL byte in option " + name)
+		}
+	}
+	return mode, options, nil
+}
@@ -0,0 +1,76 @@
+package packets
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/doodles526/go-tftp/errors"
+)
+
+func TestNewRequest(t *testing.T) {
+	r, err := NewReadRequest("boot/pxelinux.0", "", WithBlockSize(1468), WithTransferSize(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Filename != "boot/pxelinux.0" || r.Mode != ModeOctet {
+		t.Errorf("NewReadRequest = %+v", r)
+	}
+	if r.Options[OptionBlockSize] != "1468" || r.Options[OptionTransferSize] != "0" {
+		t.Errorf("options = %v", r.Options)
+	}
+	w, err := NewWriteRequest("upload", ModeNetASCII, WithOption("TSize", "10"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.Mode != ModeNetASCII || w.Options[OptionTransferSize] != "10" {
+		t.Errorf("NewWriteRequest = %+v", w)
+	}
+	if _, err := w.Encode(); err != nil {
+		t.Errorf("Encode: %v", err)
+	}
+}
+
+func TestNewRequestRejects(t *testing.T) {
+	for _, c := range []struct {
+		name, filename, mode string
+	}{
+		{"NUL in filename", "a\x00b", ModeOctet},
+		{"empty filename", "", ModeOctet},
+		{"unknown mode", "f", "binary"},
+		{"NUL in mode", "f", "octet\x00"},
+	} {
+		if r, err := NewReadRequest(c.filename, c.mode); r != nil || err == nil {
+			t.Errorf("NewReadRequest with %s = %+v, %v", c.name, r, err)
+		} else if _, ok := err.(errors.ErrorIllegalOperation); !ok {
+			t.Errorf("NewReadRequest with %s: %#v, want ErrorIllegalOperation", c.name, err)
+		}
+		if w, err := NewWriteRequest(c.filename, c.mode); w != nil || err == nil {
+			t.Errorf("NewWriteRequest with %s = %+v, %v", c.name, w, err)
+		}
+	}
+}
+
+func TestMaxFilenameLength(t *testing.T) {
+	for _, c := range []struct {
+		n  int
+		ok bool
+	}{
+		{MaxFilenameLength, true},
+		{MaxFilenameLength + 1, false},
+	} {
+		name := strings.Repeat("a", c.n)
+		_, err := (&ReadRequestPacket{Filename: name, Mode: ModeOctet}).Encode()
+		if (err == nil) != c.ok {
+			t.Errorf("encoding a %d-byte filename: %v", c.n, err)
+		}
+		// Encoded by hand, as a client without the limit would.
+		b := append([]byte{0, 2}, name+"\x00octet\x00"...)
+		_, err = Decode(b)
+		if (err == nil) != c.ok {
+			t.Errorf("decoding a %d-byte filename: %v", c.n, err)
+		}
+		if _, isIllegal := err.(errors.ErrorIllegalOperation); err != nil && !isIllegal {
+			t.Errorf("decoding a %d-byte filename: %#v, want ErrorIllegalOperation", c.n, err)
+		}
+	}
+}
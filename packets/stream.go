@@ -0,0 +1,126 @@
+package packets
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+
+	"github.com/doodles526/go-tftp/errors"
+)
+
+// DataPacketsReader returns a Reader over the concatenated payloads of
+// packets, which must hold consecutive blocks in order. Block numbers may
+// wrap from 65535 to either 0 or 1. If the blocks are not contiguous,
+// every Read fails with an errors.ErrorIllegalOperation naming the gap.
+func DataPacketsReader(packets []*DataPacket) io.Reader {
+	for i := 1; i < len(packets); i++ {
+		prev, cur := packets[i-1].BlockNumber, packets[i].BlockNumber
+		if cur != prev+1 && !(prev == 65535 && cur == 1) {
+			return &errReader{errors.ErrorIllegalOperation(
+				"block " + strconv.Itoa(int(cur)) + " does not follow block " + strconv.Itoa(int(prev)))}
+		}
+	}
+	readers := make([]io.Reader, len(packets))
+	for i, p := range packets {
+		readers[i] = bytes.NewReader(p.Data)
+	}
+	return io.MultiReader(readers...)
+}
+
+// DataPacketsFrom returns an iterator that splits r into DATA packets of
+// blockSize bytes, numbered from 1 and wrapping from 65535 to 0. Short
+// reads are accumulated until a block is full or r is exhausted. The last
+// packet is shorter than blockSize, and empty if the length of r is a
+// multiple of blockSize; after it the iterator returns io.EOF. Any other
+// read error is returned as is, and by every later call.
+func DataPacketsFrom(r io.Reader, blockSize int) func() (*DataPacket, error) {
+	var (
+		block uint16
+		err   error
+	)
+	return func() (*DataPacket, error) {
+		if err != nil {
+			return nil, err
+		}
+		data := make([]byte, blockSize)
+		n, rerr := io.ReadFull(r, data)
+		switch rerr {
+		case nil:
+		case io.EOF, io.ErrUnexpectedEOF:
+			err = io.EOF
+		default:
+			err = rerr
+			return nil, err
+		}
+		block++
+		return &DataPacket{BlockNumber: block, Data: data[:n]}, nil
+	}
+}
+
+// BlockOrderError is returned by DataAssembler.Add for a block other than
+// the next one or a repeat of the last one.
+type BlockOrderError struct {
+	Want, Got uint16
+}
+
+func (e *BlockOrderError) Error() string {
+	return "got block " + strconv.Itoa(int(e.Got)) + ", want block " + strconv.Itoa(int(e.Want))
+}
+
+// DataAssembler writes the payloads of consecutive DATA packets to a
+// Writer, checking that each packet is the next block. It is the
+// counterpart of DataPacketsFrom.
+type DataAssembler struct {
+	w         io.Writer
+	blockSize int
+	last      uint16 // last block written, if started
+	started   bool
+	n         int64
+	done      bool
+}
+
+// NewDataAssembler returns a DataAssembler writing to w the payloads of
+// blockSize-byte blocks, starting with block 1.
+func NewDataAssembler(w io.Writer, blockSize int) *DataAssembler {
+	return &DataAssembler{w: w, blockSize: blockSize}
+}
+
+// Add writes the payload of p to the underlying Writer if p is the next
+// block, and reports whether the stream is complete, which is the case
+// once a short block has been written. After block 65535 either 0 or 1
+// is accepted. A repeat of the last block written is ignored, as it is a
+// retransmission. Any other block fails with a *BlockOrderError, as does
+// any block but a repeat of the last once the stream is complete.
+func (a *DataAssembler) Add(p *DataPacket) (done bool, err error) {
+	if a.started && p.BlockNumber == a.last {
+		return a.done, nil
+	}
+	want := a.last + 1
+	if a.done || (p.BlockNumber != want && !(a.last == 65535 && p.BlockNumber == 1)) {
+		return a.done, &BlockOrderError{Want: want, Got: p.BlockNumber}
+	}
+	m, err := a.w.Write(p.Data)
+	a.n += int64(m)
+	if err == nil && m < len(p.Data) {
+		err = io.ErrShortWrite
+	}
+	if err != nil {
+		return false, err
+	}
+	a.last, a.started = p.BlockNumber, true
+	a.done = len(p.Data) < a.blockSize
+	return a.done, nil
+}
+
+// Written returns the number of bytes written so far.
+func (a *DataAssembler) Written() int64 {
+	return a.n
+}
+
+type errReader struct {
+	err error
+}
+
+func (r *errReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
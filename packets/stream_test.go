@@ -0,0 +1,128 @@
+package packets
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"testing/iotest"
+
+	"github.com/doodles526/go-tftp/errors"
+)
+
+func TestDataPacketsReader(t *testing.T) {
+	want := bytes.Repeat([]byte("0123456789"), 150)
+	var ps []*DataPacket
+	for i := 0; i*512 < len(want); i++ {
+		ps = append(ps, &DataPacket{BlockNumber: uint16(i + 1), Data: want[i*512 : min((i+1)*512, len(want))]})
+	}
+	got, err := io.ReadAll(DataPacketsReader(ps))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("read %d bytes differing from the %d assembled", len(got), len(want))
+	}
+}
+
+func TestDataPacketsReaderWrap(t *testing.T) {
+	for _, next := range []uint16{0, 1} {
+		ps := []*DataPacket{{BlockNumber: 65535, Data: []byte("ab")}, {BlockNumber: next, Data: []byte("c")}}
+		if got, err := io.ReadAll(DataPacketsReader(ps)); err != nil || string(got) != "abc" {
+			t.Errorf("65535 then %d: %q, %v", next, got, err)
+		}
+	}
+}
+
+func TestDataPacketsReaderGap(t *testing.T) {
+	ps := []*DataPacket{{BlockNumber: 1, Data: []byte("a")}, {BlockNumber: 3, Data: []byte("c")}}
+	_, err := io.ReadAll(DataPacketsReader(ps))
+	if _, ok := err.(errors.ErrorIllegalOperation); !ok {
+		t.Errorf("gap: %#v, want ErrorIllegalOperation", err)
+	}
+}
+
+// collect returns the packets DataPacketsFrom produces from r.
+func collect(t *testing.T, r io.Reader, blockSize int) []*DataPacket {
+	t.Helper()
+	next := DataPacketsFrom(r, blockSize)
+	var ps []*DataPacket
+	for {
+		p, err := next()
+		if err == io.EOF {
+			return ps
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		ps = append(ps, p)
+	}
+}
+
+func TestDataPacketsFrom(t *testing.T) {
+	for _, c := range []struct {
+		size  int
+		sizes []int
+	}{
+		{1024, []int{512, 512, 0}},
+		{1100, []int{512, 512, 76}},
+		{0, []int{0}},
+	} {
+		data := bytes.Repeat([]byte{'z'}, c.size)
+		// One byte at a time, so every block is built from short reads.
+		ps := collect(t, iotest.OneByteReader(bytes.NewReader(data)), 512)
+		if len(ps) != len(c.sizes) {
+			t.Fatalf("%d bytes: %d packets, want %d", c.size, len(ps), len(c.sizes))
+		}
+		for i, p := range ps {
+			if p.BlockNumber != uint16(i+1) || len(p.Data) != c.sizes[i] {
+				t.Errorf("%d bytes: packet %d is block %d of %d bytes, want block %d of %d", c.size, i, p.BlockNumber, len(p.Data), i+1, c.sizes[i])
+			}
+		}
+		if got, _ := io.ReadAll(DataPacketsReader(ps)); !bytes.Equal(got, data) {
+			t.Errorf("%d bytes: reassembled data differs", c.size)
+		}
+	}
+}
+
+func TestDataPacketsFromError(t *testing.T) {
+	next := DataPacketsFrom(iotest.ErrReader(io.ErrClosedPipe), 512)
+	for i := 0; i < 2; i++ {
+		if p, err := next(); p != nil || err != io.ErrClosedPipe {
+			t.Errorf("call %d: %+v, %v; want io.ErrClosedPipe", i, p, err)
+		}
+	}
+}
+
+func TestDataAssembler(t *testing.T) {
+	var buf bytes.Buffer
+	a := NewDataAssembler(&buf, 4)
+	for _, c := range []struct {
+		block uint16
+		data  string
+		done  bool
+		order bool // fails with a BlockOrderError
+	}{
+		{1, "abcd", false, false},
+		{1, "abcd", false, false}, // duplicate, ignored
+		{3, "ijkl", false, true},  // block 2 skipped
+		{2, "efgh", false, false},
+		{3, "ij", true, false},
+		{3, "ij", true, false}, // duplicate of the final block
+		{4, "", true, true},    // after the end
+	} {
+		done, err := a.Add(&DataPacket{BlockNumber: c.block, Data: []byte(c.data)})
+		if done != c.done {
+			t.Errorf("block %d: done = %v, want %v", c.block, done, c.done)
+		}
+		if c.order {
+			if oerr, ok := err.(*BlockOrderError); !ok || oerr.Got != c.block {
+				t.Errorf("block %d: %v, want a BlockOrderError", c.block, err)
+			}
+		} else if err != nil {
+			t.Errorf("block %d: %v", c.block, err)
+		}
+	}
+	if buf.String() != "abcdefghij" || a.Written() != 10 {
+		t.Errorf("assembled %q, Written = %d", buf.String(), a.Written())
+	}
+}
@@ -0,0 +1,78 @@
+package packets
+
+import (
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/doodles526/go-tftp/errors"
+)
+
+// defaultPort is the port of a TFTP URL that does not name one.
+const defaultPort = "69"
+
+// ParseTFTPURL parses a URL of the form
+//
+//	tftp://host[:port]/filename[?mode=octet&blksize=1024...]
+//
+// into the server's address, as host:port with the port defaulting to 69,
+// and a read request for filename. The mode defaults to octet; it may also
+// be given RFC 3617 style, as a ";mode=" suffix of the path. Every other
+// query parameter becomes an option of the request.
+func ParseTFTPURL(raw string) (host string, req *ReadRequestPacket, err error) {
+	host, filename, mode, opts, err := parseURL(raw)
+	if err != nil {
+		return "", nil, err
+	}
+	req, err = NewReadRequest(filename, mode, opts...)
+	if err != nil {
+		return "", nil, err
+	}
+	return host, req, nil
+}
+
+// ParseTFTPWriteURL is ParseTFTPURL for a write request.
+func ParseTFTPWriteURL(raw string) (host string, req *WriteRequestPacket, err error) {
+	host, filename, mode, opts, err := parseURL(raw)
+	if err != nil {
+		return "", nil, err
+	}
+	req, err = NewWriteRequest(filename, mode, opts...)
+	if err != nil {
+		return "", nil, err
+	}
+	return host, req, nil
+}
+
+func parseURL(raw string) (host, filename, mode string, opts []RequestOption, err error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", "", "", nil, errors.ErrorIllegalOperation("malformed URL")
+	}
+	if !strings.EqualFold(u.Scheme, "tftp") {
+		return "", "", "", nil, errors.ErrorIllegalOperation("not a tftp URL")
+	}
+	if u.Hostname() == "" {
+		return "", "", "", nil, errors.ErrorIllegalOperation("missing host in URL")
+	}
+	port := u.Port()
+	if port == "" {
+		port = defaultPort
+	}
+	host = net.JoinHostPort(u.Hostname(), port)
+	filename = strings.TrimPrefix(u.Path, "/")
+	if i := strings.LastIndex(filename, ";mode="); i >= 0 {
+		filename, mode = filename[:i], filename[i+len(";mode="):]
+	}
+	for name, values := range u.Query() {
+		if len(values) != 1 {
+			return "", "", "", nil, errors.ErrorIllegalOperation("repeated URL parameter " + name)
+		}
+		if strings.EqualFold(name, "mode") {
+			mode = values[0]
+			continue
+		}
+		opts = append(opts, WithOption(name, values[0]))
+	}
+	return host, filename, mode, opts, nil
+}
@@ -0,0 +1,53 @@
+package packets
+
+import (
+	"testing"
+
+	"github.com/doodles526/go-tftp/errors"
+)
+
+func TestParseTFTPURL(t *testing.T) {
+	host, rrq, err := ParseTFTPURL("tftp://boot.example.com:6969/pxe/pxelinux.0?mode=netascii&blksize=1024&tsize=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if host != "boot.example.com:6969" || rrq.Filename != "pxe/pxelinux.0" || rrq.Mode != ModeNetASCII {
+		t.Errorf("full URL = %q, %+v", host, rrq)
+	}
+	if len(rrq.Options) != 2 || rrq.Options[OptionBlockSize] != "1024" || rrq.Options[OptionTransferSize] != "0" {
+		t.Errorf("full URL options = %v", rrq.Options)
+	}
+
+	host, rrq, err = ParseTFTPURL("tftp://10.0.0.1/f")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if host != "10.0.0.1:69" || rrq.Filename != "f" || rrq.Mode != ModeOctet || rrq.Options != nil {
+		t.Errorf("minimal URL = %q, %+v", host, rrq)
+	}
+
+	// RFC 3617 mode suffix, and an IPv6 host.
+	host, wrq, err := ParseTFTPWriteURL("tftp://[::1]/upload;mode=netascii")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if host != "[::1]:69" || wrq.Filename != "upload" || wrq.Mode != ModeNetASCII {
+		t.Errorf("write URL = %q, %+v", host, wrq)
+	}
+
+	for _, raw := range []string{
+		"tftp://host:bad/f",
+		"http://host/f",
+		"tftp:///f",
+		"tftp://host/",
+		"tftp://host/f?mode=binary",
+		"tftp://host/f?blksize=512&blksize=1024",
+		"%zz",
+	} {
+		if _, _, err := ParseTFTPURL(raw); err == nil {
+			t.Errorf("ParseTFTPURL(%q) succeeded", raw)
+		} else if _, ok := err.(errors.ErrorIllegalOperation); !ok {
+			t.Errorf("ParseTFTPURL(%q): %#v, want ErrorIllegalOperation", raw, err)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package packets
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/doodles526/go-tftp/errors"
+)
+
+// Validate checks that b is a well-formed TFTP packet without decoding it:
+// the opcode is known, the length is plausible for the opcode and any
+// strings are NUL-terminated. It returns the opcode, or an
+// errors.ErrorIllegalOperation describing the problem. Validate does not
+// allocate, which makes it suitable for filtering datagrams in a proxy.
+// A packet that passes may still be rejected by Decode, for instance for
+// an unknown transfer mode.
+func Validate(b []byte) (Opcode, error) {
+	if len(b) < 2 {
+		return 0, errors.ErrorIllegalOperation("packet too short")
+	}
+	op := Opcode(binary.BigEndian.Uint16(b))
+	if len(b) == 2 {
+		return op, bodyMissing(op)
+	}
+	switch op {
+	case OpRRQ, OpWRQ:
+		if len(b) < 6 {
+			return op, errors.ErrorIllegalOperation("request too short")
+		}
+		// Filename and mode, then name/value pairs: an even number of
+		// NUL-terminated strings, at least two.
+		if n := bytes.Count(b[2:], []byte{0}); n < 2 || n%2 != 0 || b[len(b)-1] != 0 {
+			return op, errors.ErrorIllegalOperation("malformed request")
+		}
+	case OpDATA:
+		if len(b) < 4 {
+			return op, errors.ErrorIllegalOperation("DATA packet too short")
+		}
+	case OpACK:
+		if len(b) != 4 {
+			return op, errors.ErrorIllegalOperation("ACK packet has wrong length")
+		}
+	case OpERROR:
+		if len(b) < 5 {
+			return op, errors.ErrorIllegalOperation("ERROR packet too short")
+		}
+		if binary.BigEndian.Uint16(b[2:]) > ErrCodeOptionNegotiation {
+			return op, errors.ErrorIllegalOperation("unknown error code")
+		}
+		if i := bytes.IndexByte(b[4:], 0); i < 0 {
+			return op, errors.ErrorIllegalOperation("unterminated error message")
+		} else if 4+i != len(b)-1 {
+			return op, errors.ErrorIllegalOperation("trailing data after error message")
+		}
+	case OpOACK:
+		if n := bytes.Count(b[2:], []byte{0}); n%2 != 0 || b[len(b)-1] != 0 {
+			return op, errors.ErrorIllegalOperation("malformed OACK")
+		}
+	default:
+		return op, errors.ErrorIllegalOperation("unknown opcode")
+	}
+	return op, nil
+}
@@ -0,0 +1,62 @@
+package packets
+
+import (
+	"testing"
+
+	"github.com/doodles526/go-tftp/errors"
+)
+
+func TestValidate(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		b    []byte
+		op   Opcode
+		ok   bool
+	}{
+		{"truncated RRQ", []byte{0, 1, 'f', 'o', 'o', 0, 'o', 'c'}, OpRRQ, false},
+		{"unknown opcode", []byte{0, 42, 0, 1}, 42, false},
+		{"short ACK", []byte{0, 4, 0}, OpACK, false},
+		{"DATA", []byte{0, 3, 0, 1, 'h', 'i'}, OpDATA, true},
+		{"empty DATA", []byte{0, 3, 0, 1}, OpDATA, true},
+		{"RRQ", []byte{0, 1, 'f', 0, 'o', 'c', 't', 'e', 't', 0}, OpRRQ, true},
+	} {
+		op, err := Validate(c.b)
+		if op != c.op {
+			t.Errorf("%s: opcode %d, want %d", c.name, op, c.op)
+		}
+		if c.ok {
+			if err != nil {
+				t.Errorf("%s: %v", c.name, err)
+			}
+			continue
+		}
+		if _, ok := err.(errors.ErrorIllegalOperation); !ok {
+			t.Errorf("%s: error %#v, want ErrorIllegalOperation", c.name, err)
+		}
+	}
+}
+
+func TestValidateAgreesWithDecode(t *testing.T) {
+	for _, p := range []Packet{
+		&ReadRequestPacket{Filename: "a", Mode: "octet", Options: map[string]string{"blksize": "1024"}},
+		&DataPacket{BlockNumber: 7, Data: []byte("data")},
+		&AckPacket{BlockNumber: 7},
+		&ErrorPacket{ErrorCode: ErrCodeDiskFull, ErrorMessage: "full"},
+		&OptionAckPacket{Options: map[string]string{"tsize": "10"}},
+	} {
+		b, err := p.Encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Validate(b); err != nil {
+			t.Errorf("Validate(%T): %v", p, err)
+		}
+	}
+}
+
+func TestValidateAllocs(t *testing.T) {
+	b := []byte{0, 1, 'f', 0, 'o', 'c', 't', 'e', 't', 0}
+	if n := testing.AllocsPerRun(100, func() { Validate(b) }); n != 0 {
+		t.Errorf("Validate allocates %v times", n)
+	}
+}
@@ -0,0 +1,67 @@
+package tftp
+
+import (
+	"github.com/doodles526/go-tftp/errors"
+	"github.com/doodles526/go-tftp/packets"
+)
+
+// Operation is the kind of request made by Probe.
+type Operation int
+
+const (
+	OperationRead  Operation = iota // a read request (RRQ)
+	OperationWrite                  // a write request (WRQ)
+)
+
+// Probe checks whether the server would accept a request for filename
+// without transferring any data. It sends the request with the client's
+// options and returns nil if the server accepts it, or the error the
+// server replies with, such as errors.ErrorFileNotFound. An accepted
+// transfer is then aborted with an ERROR packet.
+func (c *Client) Probe(filename string, op Operation) error {
+	addr, err := c.resolve()
+	if err != nil {
+		return err
+	}
+	conn, err := c.listen()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	s := c.newSession(conn, addr)
+	var req packets.Packet
+	switch op {
+	case OperationRead:
+		req, err = packets.NewReadRequest(filename, c.Mode, c.options()...)
+	case OperationWrite:
+		req, err = packets.NewWriteRequest(filename, c.Mode, c.options()...)
+	default:
+		return errors.ErrorIllegalOperation("unknown operation")
+	}
+	if err != nil {
+		return err
+	}
+	p, err := s.Exchange(req)
+	if err != nil {
+		return err
+	}
+	switch p := p.(type) {
+	case *packets.OptionAckPacket:
+	case *packets.DataPacket:
+		if op != OperationRead || p.BlockNumber != 1 {
+			err = errors.ErrorIllegalOperation("unexpected DATA block")
+		}
+	case *packets.AckPacket:
+		if op != OperationWrite || p.BlockNumber != 0 {
+			err = errors.ErrorIllegalOperation("unexpected ACK")
+		}
+	default:
+		err = errors.ErrorIllegalOperation("unexpected " + p.Opcode().String())
+	}
+	if err != nil {
+		s.SendError(err)
+		return err
+	}
+	s.SendError(errors.ErrorNotDefined("probe only"))
+	return nil
+}
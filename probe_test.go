@@ -0,0 +1,43 @@
+package tftp_test
+
+import (
+	"testing"
+
+	tftp "github.com/doodles526/go-tftp"
+	"github.com/doodles526/go-tftp/errors"
+	"github.com/doodles526/go-tftp/tftptest"
+)
+
+func TestProbe(t *testing.T) {
+	n := tftptest.NewNetwork(1)
+	var tr traffic
+	tr.watch(n)
+	h := newMemHandler(map[string][]byte{"present": file(5000)})
+	addr := serve(t, n, &tftp.Server{Handler: h})
+	c := &tftp.Client{Addr: addr, Transport: n}
+
+	err := c.Probe("missing", tftp.OperationRead)
+	if _, ok := err.(errors.ErrorFileNotFound); !ok {
+		t.Errorf("Probe of a missing file: %#v, want ErrorFileNotFound", err)
+	}
+	if got := tr.String(); got != "[RRQ ERROR 1]" {
+		t.Errorf("traffic %s, want [RRQ ERROR 1]", got)
+	}
+
+	// An accepted read is abandoned after its first block.
+	var present traffic
+	present.watch(n)
+	if err := c.Probe("present", tftp.OperationRead); err != nil {
+		t.Errorf("Probe of a file: %v", err)
+	}
+	if got := present.String(); got != "[RRQ DATA 1 ERROR 0]" {
+		t.Errorf("traffic %s, want [RRQ DATA 1 ERROR 0]", got)
+	}
+
+	if err := c.Probe("new", tftp.OperationWrite); err != nil {
+		t.Errorf("Probe of a write: %v", err)
+	}
+	if _, ok := h.file("new"); ok {
+		t.Error("Probe of a write stored a file")
+	}
+}
@@ -0,0 +1,75 @@
+package tftp_test
+
+import (
+	"bytes"
+	"testing"
+
+	tftp "github.com/doodles526/go-tftp"
+	"github.com/doodles526/go-tftp/tftptest"
+)
+
+// progressLog records OnProgress calls.
+type progressLog struct {
+	transferred, total []int64
+}
+
+func (p *progressLog) add(transferred, total int64) {
+	p.transferred = append(p.transferred, transferred)
+	p.total = append(p.total, total)
+}
+
+func (p *progressLog) check(t *testing.T, size int64, blocks int) {
+	t.Helper()
+	if len(p.transferred) != blocks {
+		t.Fatalf("%d progress calls, want %d", len(p.transferred), blocks)
+	}
+	for i := 1; i < len(p.transferred); i++ {
+		if p.transferred[i] < p.transferred[i-1] {
+			t.Errorf("progress went back from %d to %d", p.transferred[i-1], p.transferred[i])
+		}
+	}
+	if last := p.transferred[len(p.transferred)-1]; last != size {
+		t.Errorf("final progress %d, want %d", last, size)
+	}
+	for _, total := range p.total {
+		if total != size {
+			t.Errorf("total %d, want %d", total, size)
+			break
+		}
+	}
+}
+
+func TestProgress(t *testing.T) {
+	n := tftptest.NewNetwork(1)
+	data := file(2500)
+	h := newMemHandler(map[string][]byte{"f": data})
+	addr := serve(t, n, &tftp.Server{Handler: h})
+
+	var get progressLog
+	c := &tftp.Client{Addr: addr, Transport: n, OnProgress: get.add}
+	if _, err := c.Get("f", &bytes.Buffer{}); err != nil {
+		t.Fatal(err)
+	}
+	get.check(t, int64(len(data)), 5)
+
+	var put progressLog
+	c.OnProgress = put.add
+	if _, err := c.Put("g", bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	put.check(t, int64(len(data)), 5)
+}
+
+func TestProgressUnknownTotal(t *testing.T) {
+	n := tftptest.NewNetwork(1)
+	addr := serve(t, n, &tftp.Server{Handler: newMemHandler(map[string][]byte{"f": file(700)})})
+	var p progressLog
+	// Without options there is no tsize to learn the total from.
+	c := &tftp.Client{Addr: addr, Transport: n, StrictRFC1350: true, OnProgress: p.add}
+	if _, err := c.Get("f", &bytes.Buffer{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.total) != 2 || p.total[0] != -1 || p.total[1] != -1 || p.transferred[1] != 700 {
+		t.Errorf("progress %v of %v, want 512 and 700 of -1", p.transferred, p.total)
+	}
+}
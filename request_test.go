@@ -0,0 +1,64 @@
+package tftp_test
+
+import (
+	"bytes"
+	"io"
+	"maps"
+	"net"
+	"sync"
+	"testing"
+
+	tftp "github.com/doodles526/go-tftp"
+	"github.com/doodles526/go-tftp/packets"
+	"github.com/doodles526/go-tftp/tftptest"
+)
+
+// scriptHandler serves a boot script naming the client's IP address, and
+// records the options of each request.
+type scriptHandler struct {
+	memHandler
+	mu      sync.Mutex
+	options []map[string]string
+}
+
+func (h *scriptHandler) ReadFileRequest(filename string, remote net.Addr, options map[string]string) (io.ReadCloser, error) {
+	h.mu.Lock()
+	h.options = append(h.options, maps.Clone(options))
+	h.mu.Unlock()
+	host, _, _ := net.SplitHostPort(remote.String())
+	return io.NopCloser(bytes.NewReader([]byte("boot " + filename + " for " + host))), nil
+}
+
+func TestReadRequester(t *testing.T) {
+	n := tftptest.NewNetwork(1)
+	// ReadFile would serve the same file to every client.
+	h := &scriptHandler{memHandler: memHandler{files: map[string][]byte{"script": []byte("static")}}}
+	addr := serve(t, n, &tftp.Server{Handler: h})
+	for _, c := range []struct {
+		client  *tftp.Client
+		want    string
+		options map[string]string
+	}{
+		{&tftp.Client{Addr: addr, Transport: n, LocalAddr: "127.0.0.2:0"}, "boot script for 127.0.0.2", nil},
+		{
+			// tsize, requested because of OnProgress, is not passed.
+			&tftp.Client{Addr: addr, Transport: n, LocalAddr: "127.0.0.3:0", BlockSize: 1024, OnProgress: func(transferred, total int64) {}},
+			"boot script for 127.0.0.3",
+			map[string]string{packets.OptionBlockSize: "1024"},
+		},
+	} {
+		var b bytes.Buffer
+		if _, err := c.client.Get("script", &b); err != nil {
+			t.Fatal(err)
+		}
+		if b.String() != c.want {
+			t.Errorf("client at %s got %q, want %q", c.client.LocalAddr, b.String(), c.want)
+		}
+		h.mu.Lock()
+		got := h.options[len(h.options)-1]
+		h.mu.Unlock()
+		if !maps.Equal(got, c.options) || (got == nil) != (c.options == nil) {
+			t.Errorf("client at %s: handler passed options %v, want %v", c.client.LocalAddr, got, c.options)
+		}
+	}
+}
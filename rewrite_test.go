@@ -0,0 +1,68 @@
+package tftp_test
+
+import (
+	"bytes"
+	stderrors "errors"
+	"net"
+	"strings"
+	"testing"
+
+	tftp "github.com/doodles526/go-tftp"
+	"github.com/doodles526/go-tftp/errors"
+	"github.com/doodles526/go-tftp/tftptest"
+)
+
+func TestRewriteFilename(t *testing.T) {
+	n := tftptest.NewNetwork(1)
+	h := newMemHandler(map[string][]byte{"firmware-1.2.bin": file(800), "firmware-1.1.bin": file(600)})
+	var allowed []string
+	done := make(completions, 4)
+	addr := serve(t, n, &tftp.Server{
+		Handler: h,
+		RewriteFilename: func(remote net.Addr, filename string) (string, error) {
+			switch {
+			case filename == "latest.bin":
+				return "firmware-1.2.bin", nil
+			case strings.HasPrefix(filename, "secret/"):
+				return "", stderrors.New("no secrets")
+			}
+			return filename, nil
+		},
+		// Access checks see the rewritten name.
+		AllowRead: func(remote net.Addr, filename string) error {
+			allowed = append(allowed, filename)
+			return nil
+		},
+		OnTransferComplete: done.hook,
+	})
+	c := &tftp.Client{Addr: addr, Transport: n}
+
+	var buf bytes.Buffer
+	if _, err := c.Get("latest.bin", &buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), file(800)) {
+		t.Errorf("latest.bin served %d bytes, want firmware-1.2.bin", buf.Len())
+	}
+	// The requested name is reported.
+	if info := done.next(t); info.Filename != "latest.bin" {
+		t.Errorf("transfer reported as %q", info.Filename)
+	}
+	if len(allowed) != 1 || allowed[0] != "firmware-1.2.bin" {
+		t.Errorf("AllowRead saw %q", allowed)
+	}
+
+	// Writes are rewritten too.
+	if _, err := c.Put("latest.bin", bytes.NewReader(file(900))); err != nil {
+		t.Fatal(err)
+	}
+	done.next(t)
+	if b, _ := h.file("firmware-1.2.bin"); !bytes.Equal(b, file(900)) {
+		t.Error("write of latest.bin did not replace firmware-1.2.bin")
+	}
+
+	_, err := c.Get("secret/key", &buf)
+	if _, ok := err.(errors.ErrorAccessViolation); !ok {
+		t.Errorf("Get refused by the hook: %#v, want ErrorAccessViolation", err)
+	}
+}
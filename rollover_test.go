@@ -0,0 +1,98 @@
+package tftp_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sync"
+	"testing"
+
+	tftp "github.com/doodles526/go-tftp"
+	"github.com/doodles526/go-tftp/packets"
+	"github.com/doodles526/go-tftp/tftptest"
+	"github.com/doodles526/go-tftp/transfer"
+)
+
+// TestNegotiateRollover transfers files that cross the block number wrap,
+// with the server defaulting to the mode the client does not use, so that
+// only the negotiated rollover option keeps the two ends synchronized.
+func TestNegotiateRollover(t *testing.T) {
+	// 8-byte blocks cross the wrap in half a megabyte.
+	data := file(8*65540 + 3)
+	for _, c := range []struct {
+		client, server transfer.RolloverMode
+		value          string
+	}{
+		{transfer.RolloverToZero, transfer.RolloverToOne, "0"},
+		{transfer.RolloverToOne, transfer.RolloverToZero, "1"},
+	} {
+		n := tftptest.NewNetwork(1)
+		var mu sync.Mutex
+		block0 := 0
+		var oack map[string]string
+		n.Fault = func(d *tftptest.Datagram) tftptest.Action {
+			mu.Lock()
+			defer mu.Unlock()
+			switch packets.Opcode(binary.BigEndian.Uint16(d.Data)) {
+			case packets.OpDATA:
+				if binary.BigEndian.Uint16(d.Data[2:]) == 0 {
+					block0++
+				}
+			case packets.OpOACK:
+				p, _ := packets.Decode(d.Data)
+				oack = p.(*packets.OptionAckPacket).Options
+			}
+			return tftptest.Deliver
+		}
+		h := newMemHandler(map[string][]byte{"f": data})
+		addr := serve(t, n, &tftp.Server{Handler: h, Rollover: c.server})
+		cl := &tftp.Client{Addr: addr, Transport: n, BlockSize: 8, WindowSize: 16, Rollover: c.client, NegotiateRollover: true}
+		// 65535 blocks, then 0 to 5 or 1 to 6: one DATA 0 per transfer
+		// when wrapping to 0.
+		want0 := 0
+		if c.client == transfer.RolloverToZero {
+			want0 = 1
+		}
+
+		var buf bytes.Buffer
+		if _, err := cl.Get("f", &buf); err != nil {
+			t.Fatalf("rollover %s: Get: %v", c.value, err)
+		}
+		if !bytes.Equal(buf.Bytes(), data) {
+			t.Errorf("rollover %s: Get returned %d bytes differing from the %d served", c.value, buf.Len(), len(data))
+		}
+		if _, err := cl.Put("g", bytes.NewReader(data)); err != nil {
+			t.Fatalf("rollover %s: Put: %v", c.value, err)
+		}
+		if b, _ := h.file("g"); !bytes.Equal(b, data) {
+			t.Errorf("rollover %s: Put stored %d bytes differing from the %d sent", c.value, len(b), len(data))
+		}
+		mu.Lock()
+		if block0 != 2*want0 {
+			t.Errorf("rollover %s: %d DATA packets numbered 0, want %d", c.value, block0, 2*want0)
+		}
+		if oack[packets.OptionRollover] != c.value {
+			t.Errorf("rollover %s: OACK %v", c.value, oack)
+		}
+		mu.Unlock()
+	}
+}
+
+func TestRolloverMalformed(t *testing.T) {
+	n := tftptest.NewNetwork(1)
+	addr := serve(t, n, &tftp.Server{Handler: newMemHandler(map[string][]byte{"f": file(100)})})
+	for _, value := range []string{"2", "-1", "01", "one"} {
+		rrq := &packets.ReadRequestPacket{Filename: "f", Mode: packets.ModeOctet, Options: map[string]string{
+			packets.OptionRollover:  value,
+			packets.OptionBlockSize: "64",
+		}}
+		_, reply, _ := request(t, n, addr, rrq)
+		oack, ok := reply.(*packets.OptionAckPacket)
+		if !ok {
+			t.Errorf("rollover %q: reply %+v, want an OACK", value, reply)
+			continue
+		}
+		if _, ok := oack.Options[packets.OptionRollover]; ok || oack.Options[packets.OptionBlockSize] != "64" {
+			t.Errorf("rollover %q: OACK %v, want only blksize", value, oack.Options)
+		}
+	}
+}
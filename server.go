@@ -0,0 +1,832 @@
+package tftp
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/doodles526/go-tftp/errors"
+	"github.com/doodles526/go-tftp/packets"
+	"github.com/doodles526/go-tftp/transfer"
+)
+
+// Handler provides the files served by a Server. Errors of the types in
+// the errors package are sent to the client with their code; any other
+// error is sent as code 0 with its text as the message.
+type Handler interface {
+	// ReadFile opens filename for a read request.
+	ReadFile(filename string) (io.ReadCloser, error)
+	// WriteFile creates filename for a write request. The writer is
+	// closed when the transfer ends, or aborted if it fails and the
+	// writer implements WriteAborter.
+	WriteFile(filename string) (io.WriteCloser, error)
+}
+
+// WriteAborter may be implemented by the writers a Handler returns from
+// WriteFile. When a write transfer fails, the server calls Abort instead
+// of Close, so that the handler can discard the partial file rather than
+// commit it.
+type WriteAborter interface {
+	Abort() error
+}
+
+// WriteSizer may be implemented by a Handler that wants to know the size
+// of a file before it is written, for instance to refuse one that does not
+// fit. For a write request with a tsize option, the server calls
+// WriteFileSize instead of WriteFile, before accepting the request.
+type WriteSizer interface {
+	WriteFileSize(filename string, size int64) (io.WriteCloser, error)
+}
+
+// ReadRequester may be implemented by a Handler whose files depend on the
+// client, such as boot scripts generated for each machine booting from the
+// network. For a read request, the server calls ReadFileRequest instead of
+// ReadFile, with the client's address and the options negotiated for the
+// transfer, or nil if none were; tsize is not among them, as its value is
+// the size of the file returned. The options must not be modified.
+//
+// The server's Cache is keyed by filename, so files that differ between
+// clients must not be returned with a Stat method when Cache is set.
+type ReadRequester interface {
+	ReadFileRequest(filename string, remote net.Addr, options map[string]string) (io.ReadCloser, error)
+}
+
+// MailHandler delivers the body of a mail-mode write request to username.
+// The body is streamed as it is received. Returning an error aborts the
+// transfer with that error, so an unknown recipient should be rejected
+// with errors.ErrorNoSuchUser before the body is read.
+type MailHandler func(username string, body io.Reader) error
+
+// Server is a TFTP server. Each request is served from a new socket in a
+// goroutine of its own.
+//
+// Transfer modes are not interpreted: netascii and octet files are sent
+// as the handler provides them. The obsolete mail mode is supported for
+// write requests when MailHandler is set.
+type Server struct {
+	// Addr is the address to listen on; the default is port 69 on
+	// BindAddress.
+	Addr string
+	// BindAddress is the IP address transfer sockets are bound to, so
+	// that replies leave from it. The default is the address of the
+	// listening socket, unless that is a wildcard address, in which case
+	// the system picks the source address of each reply. On a host with
+	// several addresses, set this or listen on a single address to make
+	// sure clients see replies come from the address they sent to.
+	BindAddress string
+	// ReadBuffer and WriteBuffer, if not zero, set the sizes in bytes of
+	// the operating system's receive and send buffers for the sockets
+	// that ListenAndServe and transfers open. A larger receive buffer
+	// absorbs bursts of DATA in windowed transfers. The system may cap the
+	// sizes without an error, as Linux does at net.core.rmem_max and
+	// net.core.wmem_max. Sockets from a Transport that cannot set them are
+	// left as they are.
+	ReadBuffer  int
+	WriteBuffer int
+	// Handler serves read and write requests.
+	Handler Handler
+	// MailHandler, if set, is called for write requests in mail mode,
+	// whose filename is the recipient's user name. Mail-mode write
+	// requests are rejected with errors.ErrorIllegalOperation otherwise,
+	// and mail-mode read requests always are.
+	MailHandler MailHandler
+	// Mode restricts the server to read or write requests. Requests it
+	// does not allow are refused with errors.ErrorAccessViolation before
+	// any other check.
+	Mode AccessMode
+	// RewriteFilename, if set, maps the filename of every read and write
+	// request to the name used for access checks and passed to the
+	// handler, for instance to lowercase names or resolve aliases. An
+	// error refuses the request with errors.ErrorAccessViolation.
+	// Logger and OnTransferComplete report the requested name.
+	RewriteFilename func(remote net.Addr, filename string) (string, error)
+	// AllowRead and AllowWrite, if set, are called before a read or write
+	// request is passed to the handler. A non-nil error, usually
+	// errors.ErrorAccessViolation, is sent to the client and the request
+	// is refused. AllowWrite is consulted for mail-mode requests too.
+	AllowRead  func(remote net.Addr, filename string) error
+	AllowWrite func(remote net.Addr, filename string) error
+	// Timeout is the retransmission timeout; zero means
+	// transfer.DefaultTimeout.
+	Timeout time.Duration
+	// Retries is the number of retransmissions before a transfer fails;
+	// zero means transfer.DefaultRetries.
+	Retries int
+	// Backoff, if set, lengthens the timeout after each retransmission.
+	Backoff transfer.Backoff
+	// IdleTimeout, if not zero, aborts a transfer that makes no progress
+	// for that long, however many retransmissions remain. It should be
+	// longer than Timeout.
+	IdleTimeout time.Duration
+	// AckPolicy selects whether an ACK for a block far from the ones in
+	// flight is ignored, the default, or aborts a read transfer.
+	AckPolicy transfer.AckPolicy
+	// MinBlockSize and MaxBlockSize bound the block sizes the server
+	// agrees to, by default DefaultMinBlockSize and DefaultMaxBlockSize.
+	// A blksize request above MaxBlockSize is answered with it, and one
+	// below MinBlockSize is declined, leaving the transfer at 512 bytes.
+	// Blocks larger than the path MTU allows are fragmented by IP, and the
+	// loss of any fragment loses the block, so raising MaxBlockSize only
+	// pays off on networks with large MTUs or little loss. Both must lie
+	// within transfer.MinBlockSize and transfer.MaxBlockSize.
+	MinBlockSize int
+	MaxBlockSize int
+	// Rollover selects whether block numbers wrap from 65535 to 0, the
+	// default and most common choice, or to 1, for files of more than
+	// 65535 blocks. Both ends of a transfer must agree; a client that
+	// requests the rollover option (packets.OptionRollover) gets the
+	// value it asks for.
+	Rollover transfer.RolloverMode
+	// LenientDecode accepts ACK and ERROR packets padded with NUL bytes,
+	// which some embedded clients send, and ERROR packets whose message
+	// lacks its terminating NUL.
+	LenientDecode bool
+	// RejectUnknownOptions refuses requests carrying an option the server
+	// does not support with errors.ErrorOptionNegotiation, instead of
+	// leaving the option out of the OACK as RFC 2347 has it.
+	RejectUnknownOptions bool
+	// Options, if set, adds options to those the server negotiates, or
+	// replaces the standard ones of the same name, for instance to clamp
+	// blksize to a smaller maximum. See SupportedOptions.
+	Options []transfer.OptionSpec
+	// Logger, if set, receives an event for every request, completed or
+	// failed transfer and ERROR sent, and a debug event for every
+	// retransmission. Events carry the remote address, filename, mode,
+	// negotiated options and byte count as attributes.
+	Logger *slog.Logger
+	// Metrics, if set, is updated by every transfer.
+	Metrics *transfer.Metrics
+	// Tracer, if set, is told of every packet of every transfer. Its
+	// methods are called from the goroutines of all transfers at once,
+	// and the packets do not identify the transfer.
+	Tracer transfer.Tracer
+	// RateLimit, if not zero, caps the rate at which each transfer sends
+	// DATA, in bytes per second.
+	RateLimit int
+	// SendDelay, if not zero, is the least time between two DATA packets
+	// of a transfer, for pacing devices that cannot keep up otherwise.
+	SendDelay time.Duration
+	// MinThroughput, if not zero, is the lowest average rate in bytes per
+	// second a transfer of a file of known size may run at; see
+	// transfer.Config.MinThroughput. The size of a file read is that of
+	// the file the handler opens, and of a file written the client's
+	// tsize option.
+	MinThroughput int
+	// Cache, if set, keeps encoded DATA packets of the files read, which
+	// repeated reads of a popular file are served from. It is used for
+	// files the handler opens with a Stat method giving their modification
+	// time and a Seek method, such as *os.File.
+	Cache *transfer.BlockCache
+	// MaxTransferSize, if not zero, limits the size of files written by
+	// clients. A write request whose tsize option exceeds it is refused,
+	// and a transfer is aborted before the first block that would exceed
+	// it is written. Both fail with errors.ErrorDiskFull.
+	MaxTransferSize int64
+	// MaxConcurrentTransfers, if not zero, limits the number of transfers
+	// served at once. Requests over the limit are rejected from the
+	// listening socket with errors.ErrorNotDefined("server busy").
+	MaxConcurrentTransfers int
+	// OnTransferComplete, if set, is called once for every transfer when
+	// it ends, whether it completed, failed or was refused. It runs on the
+	// transfer's goroutine after the transfer's socket is closed and its
+	// file writer, if any, has been closed, so it may remove the file of a
+	// failed write.
+	OnTransferComplete func(info TransferInfo)
+	// Transport, if set, opens the server's sockets instead of the net
+	// package.
+	Transport Transport
+
+	mu        sync.Mutex
+	closed    bool // set by Shutdown and Close
+	aborted   bool // set by Close
+	listeners map[net.PacketConn]struct{}
+	conns     map[net.PacketConn]struct{} // sockets of active transfers
+	transfers map[string]*activeTransfer  // by ID, for ActiveTransfers
+	lastID    uint64
+	active    int
+	wg        sync.WaitGroup
+}
+
+// Default bounds of Server.MinBlockSize and Server.MaxBlockSize. 1468
+// bytes of payload, with the TFTP, UDP and IPv4 headers, fill a 1500-byte
+// Ethernet frame.
+const (
+	DefaultMinBlockSize = transfer.MinBlockSize
+	DefaultMaxBlockSize = 1468
+)
+
+// AccessMode selects the requests a Server accepts.
+type AccessMode int
+
+const (
+	ReadWrite AccessMode = iota // read and write requests
+	ReadOnly                    // read requests only
+	WriteOnly                   // write requests only
+)
+
+// TransferInfo describes a transfer that has ended, for
+// Server.OnTransferComplete, or one in progress, for
+// Server.ActiveTransfers.
+type TransferInfo struct {
+	// ID identifies the transfer among those of the Server, for
+	// Server.CancelTransfer.
+	ID       string
+	Remote   net.Addr
+	Op       packets.Opcode // OpRRQ for a read, OpWRQ for a write
+	Filename string
+	Mode     string
+	// Start is when the request was received and End when the transfer
+	// ended.
+	Start, End time.Time
+	// BlockSize is the negotiated block size.
+	BlockSize int
+	// Options are the negotiated options, or nil if none were.
+	Options map[string]string
+	// Bytes is the number of payload bytes acknowledged.
+	Bytes int64
+	// Err is the error that ended the transfer, if any.
+	Err error
+}
+
+type serverClosedError struct{}
+
+func (serverClosedError) Error() string { return "tftp: server closed" }
+
+// ErrServerClosed is returned by Serve and ListenAndServe after a call to
+// Shutdown or Close.
+var ErrServerClosed error = serverClosedError{}
+
+// ListenAndServe serves handler on addr.
+func ListenAndServe(addr string, handler Handler) error {
+	s := &Server{Addr: addr, Handler: handler}
+	return s.ListenAndServe()
+}
+
+// ListenAndServe listens on s.Addr and serves requests.
+func (s *Server) ListenAndServe() error {
+	addr := s.Addr
+	if addr == "" {
+		addr = net.JoinHostPort(s.BindAddress, DefaultPort)
+	}
+	conn, err := listen(s.Transport, addr, s.ReadBuffer, s.WriteBuffer)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return s.Serve(conn)
+}
+
+// Serve reads requests from conn, which is usually bound to port 69, until
+// reading fails or the server is shut down. Packets other than requests are
+// answered with an error.
+func (s *Server) Serve(conn net.PacketConn) error {
+	if !s.track(&s.listeners, conn, true, &s.closed) {
+		return ErrServerClosed
+	}
+	defer s.track(&s.listeners, conn, false, nil)
+	buf := make([]byte, 65536)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if s.isClosed() {
+				return ErrServerClosed
+			}
+			return err
+		}
+		p, err := packets.Decode(buf[:n])
+		if err != nil {
+			b, _ := packets.DecodeFailureResponse(err)
+			conn.WriteTo(b, addr)
+			continue
+		}
+		switch p.(type) {
+		case *packets.ReadRequestPacket, *packets.WriteRequestPacket:
+			if err := s.startTransfer(); err == ErrServerClosed {
+				return err
+			} else if err != nil {
+				b, _ := packets.ErrorToPacket(err).Encode()
+				conn.WriteTo(b, addr)
+				continue
+			}
+			go func() {
+				defer s.endTransfer()
+				s.serveRequest(conn, addr, p)
+			}()
+		case *packets.ErrorPacket:
+		default:
+			b, _ := packets.ErrorToPacket(errors.ErrorUnknownTransferID("")).Encode()
+			conn.WriteTo(b, addr)
+		}
+	}
+}
+
+// Shutdown stops the server gracefully. It closes the listening sockets so
+// that no new requests are accepted, then waits for active transfers to
+// finish. If ctx is done first, Shutdown returns ctx.Err() and the remaining
+// transfers carry on; Close can then be used to end them.
+func (s *Server) Shutdown(ctx context.Context) error {
+	err := s.close(false)
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close stops the server immediately, closing the listening sockets and
+// the sockets of all active transfers. It does not wait for the transfer
+// goroutines to return.
+func (s *Server) Close() error {
+	return s.close(true)
+}
+
+func (s *Server) close(transfers bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	var err error
+	for conn := range s.listeners {
+		if cerr := conn.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if transfers {
+		s.aborted = true
+		for conn := range s.conns {
+			conn.Close()
+		}
+	}
+	return err
+}
+
+func (s *Server) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+// startTransfer counts a new transfer goroutine. It fails with
+// ErrServerClosed if the server has been shut down, and with the error to
+// send to the client if MaxConcurrentTransfers has been reached. The count
+// is taken under s.mu so it cannot race with Shutdown starting to wait.
+func (s *Server) startTransfer() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrServerClosed
+	}
+	if s.MaxConcurrentTransfers > 0 && s.active >= s.MaxConcurrentTransfers {
+		return errors.ErrorNotDefined("server busy")
+	}
+	s.active++
+	s.wg.Add(1)
+	return nil
+}
+
+func (s *Server) endTransfer() {
+	s.mu.Lock()
+	s.active--
+	s.mu.Unlock()
+	s.wg.Done()
+}
+
+// track adds conn to or removes it from set. Adding fails if closed is set.
+// It is used with s.closed for listeners, which may not be added once
+// Shutdown has been called, and with s.aborted for transfer sockets, which
+// may not be added once Close has been called.
+func (s *Server) track(set *map[net.PacketConn]struct{}, conn net.PacketConn, add bool, closed *bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !add {
+		delete(*set, conn)
+		return true
+	}
+	if *closed {
+		return false
+	}
+	if *set == nil {
+		*set = make(map[net.PacketConn]struct{})
+	}
+	(*set)[conn] = struct{}{}
+	return true
+}
+
+// transferAddr returns the address to bind the socket of a transfer
+// requested on the listening socket at local to.
+func (s *Server) transferAddr(local net.Addr) string {
+	if s.BindAddress != "" {
+		return net.JoinHostPort(s.BindAddress, "0")
+	}
+	if ua, ok := local.(*net.UDPAddr); ok && ua.IP != nil && !ua.IP.IsUnspecified() {
+		return (&net.UDPAddr{IP: ua.IP, Zone: ua.Zone}).String()
+	}
+	return ":0"
+}
+
+func (s *Server) serveRequest(listener net.PacketConn, remote net.Addr, req packets.Packet) {
+	start := time.Now()
+	var (
+		sess *transfer.Session
+		t    *activeTransfer
+		err  error
+	)
+	if s.OnTransferComplete != nil {
+		// Deferred first so it runs last, once the socket is closed, and
+		// so that requests that fail before their transfer starts are
+		// reported too.
+		defer func() {
+			filename, mode, _ := requestFields(req)
+			info := TransferInfo{
+				Remote:   remote,
+				Op:       req.Opcode(),
+				Filename: filename,
+				Mode:     mode,
+				Start:    start,
+				End:      time.Now(),
+				Err:      err,
+			}
+			if t != nil {
+				info.ID = t.info.ID
+			}
+			if sess != nil {
+				sum := sess.Summary()
+				info.BlockSize = sess.Config.BlockSize
+				info.Options = sum.Options
+				info.Bytes = sum.Bytes
+			}
+			s.OnTransferComplete(info)
+		}()
+	}
+	conn, err := listen(s.Transport, s.transferAddr(listener.LocalAddr()), s.ReadBuffer, s.WriteBuffer)
+	if err != nil {
+		// Without a socket there is no TID to answer from, so the
+		// refusal comes from the listening socket.
+		b, _ := packets.ErrorToPacket(errors.ErrorNotDefined("cannot open transfer socket")).Encode()
+		listener.WriteTo(b, remote)
+		return
+	}
+	defer conn.Close()
+	if !s.track(&s.conns, conn, true, &s.aborted) {
+		// Dropped by Close before it started.
+		err = ErrServerClosed
+		return
+	}
+	defer s.track(&s.conns, conn, false, nil)
+	t = s.register(conn, remote, req, start)
+	defer s.unregister(t)
+	sess = transfer.NewSession(conn, remote, transfer.Config{
+		Timeout:       s.Timeout,
+		Retries:       s.Retries,
+		Backoff:       s.Backoff,
+		Rollover:      s.Rollover,
+		IdleTimeout:   s.IdleTimeout,
+		LenientDecode: s.LenientDecode,
+		SendDelay:     s.SendDelay,
+		AckPolicy:     s.AckPolicy,
+		MinThroughput: s.MinThroughput,
+	})
+	sess.Metrics = s.Metrics
+	sess.Tracer = s.Tracer
+	sess.OnProgress = t.bytes.Store
+	if s.RateLimit > 0 {
+		sess.Limiter = transfer.NewLimiter(s.RateLimit)
+	}
+	var log *slog.Logger
+	if s.Logger != nil {
+		filename, mode, options := requestFields(req)
+		log = s.Logger.With("remote", remote, "op", req.Opcode(), "filename", filename, "mode", mode)
+		log.Info("request received", "options", options)
+		sess.Logger = log
+	}
+	switch req := req.(type) {
+	case *packets.ReadRequestPacket:
+		err = s.serveRead(sess, req)
+	case *packets.WriteRequestPacket:
+		err = s.serveWrite(sess, req)
+	}
+	if err != nil && t.canceled.Load() {
+		err = ErrTransferCanceled
+	}
+	if log != nil {
+		sum := sess.Summary()
+		if err != nil {
+			log.Warn("transfer failed", "bytes", sum.Bytes, "options", sum.Options, "error", err)
+		} else {
+			log.Info("transfer completed", "bytes", sum.Bytes, "options", sum.Options)
+		}
+	}
+}
+
+// requestFields returns the fields shared by read and write requests.
+func requestFields(req packets.Packet) (filename, mode string, options map[string]string) {
+	switch req := req.(type) {
+	case *packets.ReadRequestPacket:
+		return req.Filename, req.Mode, req.Options
+	case *packets.WriteRequestPacket:
+		return req.Filename, req.Mode, req.Options
+	}
+	return "", "", nil
+}
+
+func (s *Server) serveRead(sess *transfer.Session, req *packets.ReadRequestPacket) error {
+	if s.Mode == WriteOnly {
+		err := errors.ErrorAccessViolation("server is write-only")
+		sess.SendError(err)
+		return err
+	}
+	if err := s.checkOptions(req.Options); err != nil {
+		sess.SendError(err)
+		return err
+	}
+	if s.RewriteFilename != nil {
+		filename, err := s.rewrite(sess, req.Filename)
+		if err != nil {
+			return err
+		}
+		r := *req
+		r.Filename = filename
+		req = &r
+	}
+	if strings.EqualFold(req.Mode, packets.ModeMail) {
+		err := errors.ErrorIllegalOperation("mail mode is only valid for write requests")
+		sess.SendError(err)
+		return err
+	}
+	if s.AllowRead != nil {
+		if err := s.AllowRead(sess.RemoteAddr(), req.Filename); err != nil {
+			sess.SendError(err)
+			return err
+		}
+	}
+	oack := s.negotiate(sess, req.Options)
+	r, err := s.readFile(sess, req, oack)
+	if err != nil {
+		sess.SendError(err)
+		return err
+	}
+	defer r.Close()
+	if s.Cache != nil {
+		if fi, ok := statOf(r); ok {
+			sess.UseCache(s.Cache, req.Filename, fi.ModTime())
+		}
+	}
+	if _, ok := req.Options[packets.OptionTransferSize]; ok || s.MinThroughput > 0 {
+		if size, known := sizeOf(r); known {
+			sess.ExpectSize(size)
+			if ok {
+				if oack == nil {
+					oack = make(map[string]string)
+				}
+				oack[packets.OptionTransferSize] = strconv.FormatInt(size, 10)
+			}
+		}
+	}
+	var out packets.Packet
+	if oack != nil {
+		out = &packets.OptionAckPacket{Options: oack}
+	}
+	_, err = sess.Send(r, out)
+	return err
+}
+
+// readFile opens the file of a read request, with ReadFileRequest if the
+// handler implements ReadRequester.
+func (s *Server) readFile(sess *transfer.Session, req *packets.ReadRequestPacket, options map[string]string) (io.ReadCloser, error) {
+	if rr, ok := s.Handler.(ReadRequester); ok {
+		return rr.ReadFileRequest(req.Filename, sess.RemoteAddr(), options)
+	}
+	return s.Handler.ReadFile(req.Filename)
+}
+
+func (s *Server) serveWrite(sess *transfer.Session, req *packets.WriteRequestPacket) error {
+	if s.Mode == ReadOnly {
+		err := errors.ErrorAccessViolation("server is read-only")
+		sess.SendError(err)
+		return err
+	}
+	if err := s.checkOptions(req.Options); err != nil {
+		sess.SendError(err)
+		return err
+	}
+	if s.RewriteFilename != nil {
+		filename, err := s.rewrite(sess, req.Filename)
+		if err != nil {
+			return err
+		}
+		w := *req
+		w.Filename = filename
+		req = &w
+	}
+	if s.AllowWrite != nil {
+		if err := s.AllowWrite(sess.RemoteAddr(), req.Filename); err != nil {
+			sess.SendError(err)
+			return err
+		}
+	}
+	if s.MaxTransferSize > 0 {
+		size, err := strconv.ParseInt(req.Options[packets.OptionTransferSize], 10, 64)
+		if err == nil && size > s.MaxTransferSize {
+			err := errors.ErrorDiskFull("file too large")
+			sess.SendError(err)
+			return err
+		}
+	}
+	if strings.EqualFold(req.Mode, packets.ModeMail) {
+		return s.serveMail(sess, req)
+	}
+	w, err := s.writeFile(req)
+	if err != nil {
+		sess.SendError(err)
+		return err
+	}
+	_, err = sess.Receive(s.limit(w), s.acceptWrite(sess, req))
+	if a, ok := w.(WriteAborter); ok && err != nil {
+		a.Abort()
+		return err
+	}
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// rewrite applies RewriteFilename to filename, refusing the request if it
+// fails.
+func (s *Server) rewrite(sess *transfer.Session, filename string) (string, error) {
+	filename, err := s.RewriteFilename(sess.RemoteAddr(), filename)
+	if err != nil {
+		err = errors.ErrorAccessViolation(err.Error())
+		sess.SendError(err)
+		return "", err
+	}
+	return filename, nil
+}
+
+// writeFile opens the file of a write request with the handler, passing
+// the size from the tsize option to a WriteSizer.
+func (s *Server) writeFile(req *packets.WriteRequestPacket) (io.WriteCloser, error) {
+	if ws, ok := s.Handler.(WriteSizer); ok {
+		if size, err := strconv.ParseInt(req.Options[packets.OptionTransferSize], 10, 64); err == nil && size >= 0 {
+			return ws.WriteFileSize(req.Filename, size)
+		}
+	}
+	return s.Handler.WriteFile(req.Filename)
+}
+
+// serveMail receives a mail-mode write request and streams the message
+// body to the MailHandler as it arrives.
+func (s *Server) serveMail(sess *transfer.Session, req *packets.WriteRequestPacket) error {
+	if s.MailHandler == nil {
+		err := errors.ErrorIllegalOperation("mail mode not supported")
+		sess.SendError(err)
+		return err
+	}
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		err := s.MailHandler(req.Filename, pr)
+		// Unblock the transfer if the handler stops reading early.
+		pr.CloseWithError(err)
+		done <- err
+	}()
+	_, err := sess.Receive(s.limit(pw), s.acceptWrite(sess, req))
+	pw.CloseWithError(err)
+	if herr := <-done; err == nil {
+		err = herr
+	}
+	return err
+}
+
+// SupportedOptions returns the options the server negotiates: the
+// transfer.StandardOptions with blksize bounded by MinBlockSize and
+// MaxBlockSize, tsize, and those of Options, which replace options of the
+// same name.
+func (s *Server) SupportedOptions() []transfer.OptionSpec {
+	specs := append(transfer.StandardOptions(), transfer.OptionSpec{Name: packets.OptionTransferSize})
+	lo, hi := s.MinBlockSize, s.MaxBlockSize
+	if lo == 0 {
+		lo = DefaultMinBlockSize
+	}
+	if hi == 0 {
+		hi = DefaultMaxBlockSize
+	}
+	for i := range specs {
+		if specs[i].Name == packets.OptionBlockSize {
+			specs[i] = transfer.BlockSizeOption(lo, hi)
+		}
+	}
+	for _, spec := range s.Options {
+		replaced := false
+		for i := range specs {
+			if specs[i].Name == spec.Name {
+				specs[i], replaced = spec, true
+			}
+		}
+		if !replaced {
+			specs = append(specs, spec)
+		}
+	}
+	return specs
+}
+
+// negotiate applies the options of a request to sess.
+func (s *Server) negotiate(sess *transfer.Session, requested map[string]string) map[string]string {
+	return sess.Config.NegotiateWith(s.SupportedOptions(), requested)
+}
+
+// checkOptions applies RejectUnknownOptions to the options of a request.
+func (s *Server) checkOptions(options map[string]string) error {
+	if !s.RejectUnknownOptions {
+		return nil
+	}
+	supported := s.SupportedOptions()
+	for name := range options {
+		if !slices.ContainsFunc(supported, func(spec transfer.OptionSpec) bool { return spec.Name == name }) {
+			return errors.ErrorOptionNegotiation("unsupported option " + name)
+		}
+	}
+	return nil
+}
+
+// acceptWrite negotiates the options of a write request and returns the
+// packet that accepts it: an OACK, or ACK 0 if no options were accepted.
+// RFC 2347 has the client answer an OACK with DATA 1, or with an ERROR if
+// it cannot use the options, which ends the transfer. Clients that send
+// ACK 0 first are tolerated, as Receive ignores ACKs.
+func (s *Server) acceptWrite(sess *transfer.Session, req *packets.WriteRequestPacket) packets.Packet {
+	oack := s.negotiate(sess, req.Options)
+	// A malformed tsize is ignored like any option the server does not
+	// understand, rather than echoed back.
+	if size, ok := req.Options[packets.OptionTransferSize]; ok {
+		if n, err := strconv.ParseInt(size, 10, 64); err == nil && n >= 0 {
+			sess.ExpectSize(n)
+			if oack == nil {
+				oack = make(map[string]string)
+			}
+			oack[packets.OptionTransferSize] = size
+		}
+	}
+	if oack == nil {
+		return &packets.AckPacket{BlockNumber: 0}
+	}
+	return &packets.OptionAckPacket{Options: oack}
+}
+
+// limit applies MaxTransferSize to w.
+func (s *Server) limit(w io.Writer) io.Writer {
+	if s.MaxTransferSize <= 0 {
+		return w
+	}
+	return &limitWriter{w: w, n: s.MaxTransferSize}
+}
+
+// limitWriter fails with errors.ErrorDiskFull, writing nothing, once a
+// write would take it past n bytes.
+type limitWriter struct {
+	w io.Writer
+	n int64 // bytes left
+}
+
+func (l *limitWriter) Write(p []byte) (int, error) {
+	if int64(len(p)) > l.n {
+		return 0, errors.ErrorDiskFull("file too large")
+	}
+	n, err := l.w.Write(p)
+	l.n -= int64(n)
+	return n, err
+}
+
+// sizeOf returns the size of the file behind r, if it can be determined.
+func sizeOf(r io.Reader) (int64, bool) {
+	if r, ok := r.(interface{ Size() int64 }); ok {
+		return r.Size(), true
+	}
+	if fi, ok := statOf(r); ok {
+		return fi.Size(), true
+	}
+	return 0, false
+}
+
+// statOf returns information about the regular file behind r, if r has a
+// Stat method.
+func statOf(r io.Reader) (os.FileInfo, bool) {
+	if r, ok := r.(interface{ Stat() (os.FileInfo, error) }); ok {
+		if fi, err := r.Stat(); err == nil && fi.Mode().IsRegular() {
+			return fi, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,192 @@
+package tftp_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	tftp "github.com/doodles526/go-tftp"
+	"github.com/doodles526/go-tftp/errors"
+	"github.com/doodles526/go-tftp/packets"
+	"github.com/doodles526/go-tftp/tftptest"
+	"github.com/doodles526/go-tftp/transfer"
+)
+
+// slowHandler serves data for any filename, pausing before every read.
+// It signals started when a file is opened, and blocks opening until
+// release is closed, if it is set.
+type slowHandler struct {
+	data    []byte
+	delay   time.Duration
+	started chan string
+	release chan struct{}
+}
+
+func (h *slowHandler) ReadFile(filename string) (io.ReadCloser, error) {
+	if h.started != nil {
+		h.started <- filename
+	}
+	if h.release != nil {
+		<-h.release
+	}
+	return io.NopCloser(&slowReader{bytes.NewReader(h.data), h.delay}), nil
+}
+
+func (h *slowHandler) WriteFile(filename string) (io.WriteCloser, error) {
+	return nil, io.ErrClosedPipe
+}
+
+type slowReader struct {
+	r     io.Reader
+	delay time.Duration
+}
+
+func (r *slowReader) Read(b []byte) (int, error) {
+	time.Sleep(r.delay)
+	return r.r.Read(b)
+}
+
+func TestShutdownWaitsForTransfer(t *testing.T) {
+	n := tftptest.NewNetwork(1)
+	data := file(2000)
+	h := &slowHandler{data: data, delay: 10 * time.Millisecond, started: make(chan string, 1)}
+	completed := make(chan error, 1)
+	s := &tftp.Server{
+		Handler:            h,
+		OnTransferComplete: func(info tftp.TransferInfo) { completed <- info.Err },
+	}
+	addr := serve(t, n, s)
+	got := make(chan []byte, 1)
+	go func() {
+		var buf bytes.Buffer
+		if _, err := (&tftp.Client{Addr: addr, Transport: n}).Get("slow", &buf); err != nil {
+			t.Errorf("Get: %v", err)
+		}
+		got <- buf.Bytes()
+	}()
+	<-h.started
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	select {
+	case err := <-completed:
+		if err != nil {
+			t.Errorf("transfer failed: %v", err)
+		}
+	default:
+		t.Fatal("Shutdown returned before the transfer completed")
+	}
+	if b := <-got; !bytes.Equal(b, data) {
+		t.Errorf("got %d bytes differing from the %d served", len(b), len(data))
+	}
+}
+
+func TestShutdownDeadline(t *testing.T) {
+	n := tftptest.NewNetwork(1)
+	h := &slowHandler{data: file(100), started: make(chan string, 1), release: make(chan struct{})}
+	s := &tftp.Server{Handler: h}
+	addr := serve(t, n, s)
+	go (&tftp.Client{Addr: addr, Transport: n}).Get("stuck", io.Discard)
+	<-h.started
+	defer close(h.release)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Shutdown = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestMaxConcurrentTransfers(t *testing.T) {
+	n := tftptest.NewNetwork(1)
+	h := &slowHandler{data: file(100), started: make(chan string, 2), release: make(chan struct{})}
+	addr := serve(t, n, &tftp.Server{Handler: h, MaxConcurrentTransfers: 1})
+	c := &tftp.Client{Addr: addr, Transport: n}
+	first := make(chan error, 1)
+	go func() {
+		_, err := c.Get("first", io.Discard)
+		first <- err
+	}()
+	<-h.started
+	start := time.Now()
+	_, err := c.Get("second", io.Discard)
+	if _, ok := err.(errors.ErrorNotDefined); !ok {
+		t.Errorf("second Get: %#v, want ErrorNotDefined", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("second Get rejected after %v", d)
+	}
+	close(h.release)
+	if err := <-first; err != nil {
+		t.Errorf("first Get: %v", err)
+	}
+}
+
+func TestMaxTransferSize(t *testing.T) {
+	n := tftptest.NewNetwork(1)
+	var tr traffic
+	tr.watch(n)
+	h := newMemHandler(nil)
+	addr := serve(t, n, &tftp.Server{Handler: h, MaxTransferSize: 1000})
+	c := &tftp.Client{Addr: addr, Transport: n}
+
+	// Without tsize the limit is only found out as the data arrives.
+	_, err := c.Put("stream", io.MultiReader(bytes.NewReader(file(3000))))
+	if _, ok := err.(errors.ErrorDiskFull); !ok {
+		t.Errorf("Put past the limit: %#v, want ErrorDiskFull", err)
+	}
+	if got := tr.String(); got != "[WRQ ACK 0 DATA 1 ACK 1 DATA 2 ERROR 3]" {
+		t.Errorf("traffic %s", got)
+	}
+
+	// With tsize it is refused before any data is sent. OnProgress makes
+	// Put send the size.
+	var sized traffic
+	sized.watch(n)
+	c.OnProgress = func(int64, int64) {}
+	_, err = c.Put("sized", bytes.NewReader(file(3000)))
+	if _, ok := err.(errors.ErrorDiskFull); !ok {
+		t.Errorf("Put with tsize past the limit: %#v, want ErrorDiskFull", err)
+	}
+	if got := sized.String(); got != "[WRQ ERROR 3]" {
+		t.Errorf("traffic %s, want [WRQ ERROR 3]", got)
+	}
+
+	// Up to the limit is fine.
+	if _, err := c.Put("small", bytes.NewReader(file(1000))); err != nil {
+		t.Errorf("Put at the limit: %v", err)
+	}
+}
+
+func TestIdleTimeout(t *testing.T) {
+	n := tftptest.NewNetwork(1)
+	done := make(chan tftp.TransferInfo, 1)
+	addr := serve(t, n, &tftp.Server{
+		Handler: newMemHandler(map[string][]byte{"f": file(5000)}),
+		// Retransmissions alone would keep the transfer going for 5s.
+		Timeout:            50 * time.Millisecond,
+		Retries:            100,
+		IdleTimeout:        200 * time.Millisecond,
+		OnTransferComplete: func(info tftp.TransferInfo) { done <- info },
+	})
+	rrq, _ := packets.NewReadRequest("f", "")
+	start := time.Now()
+	// Take DATA 1 and vanish.
+	if _, reply, _ := request(t, n, addr, rrq); !packets.Equal(reply, &packets.DataPacket{BlockNumber: 1, Data: file(5000)[:512]}) {
+		t.Fatalf("reply %+v, want DATA 1", reply)
+	}
+	select {
+	case info := <-done:
+		if info.Err != transfer.ErrTimeout {
+			t.Errorf("transfer ended with %v, want %v", info.Err, transfer.ErrTimeout)
+		}
+		if d := time.Since(start); d < 200*time.Millisecond {
+			t.Errorf("transfer ended after %v, before the idle timeout", d)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("transfer still running after 1s")
+	}
+}
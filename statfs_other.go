@@ -0,0 +1,11 @@
+//go:build !linux && !darwin && !freebsd
+
+package tftp
+
+import stderrors "errors"
+
+// statfsFree reports that free space cannot be determined on this
+// system, so FileServer skips the check.
+func statfsFree(dir string) (uint64, error) {
+	return 0, stderrors.ErrUnsupported
+}
@@ -0,0 +1,53 @@
+package tftp_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	tftp "github.com/doodles526/go-tftp"
+	"github.com/doodles526/go-tftp/packets"
+	"github.com/doodles526/go-tftp/tftptest"
+)
+
+func TestStrictRFC1350(t *testing.T) {
+	n := tftptest.NewNetwork(1)
+	h := newMemHandler(map[string][]byte{"f": file(1000)})
+	addr := serve(t, n, &tftp.Server{Handler: h})
+	rec := &tftptest.Recorder{Transport: n}
+	c := &tftp.Client{
+		Addr:          addr,
+		Transport:     rec,
+		StrictRFC1350: true,
+		// Each of these would otherwise add an option.
+		BlockSize:  1024,
+		WindowSize: 4,
+		Checksum:   true,
+		OnProgress: func(transferred, total int64) {},
+	}
+	var buf bytes.Buffer
+	if _, err := c.Get("f", &buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), file(1000)) {
+		t.Error("Get: wrong contents")
+	}
+	if _, err := c.Put("g", bytes.NewReader(file(1000))); err != nil {
+		t.Fatal(err)
+	}
+	var requests [][]byte
+	for _, p := range rec.Packets() {
+		if op := packets.Opcode(binary.BigEndian.Uint16(p)); op == packets.OpRRQ || op == packets.OpWRQ {
+			requests = append(requests, p)
+		}
+	}
+	want := []string{"\x00\x01f\x00octet\x00", "\x00\x02g\x00octet\x00"}
+	if len(requests) != len(want) {
+		t.Fatalf("sent %d requests, want %d", len(requests), len(want))
+	}
+	for i, r := range requests {
+		if string(r) != want[i] {
+			t.Errorf("request %q, want %q", r, want[i])
+		}
+	}
+}
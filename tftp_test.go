@@ -0,0 +1,102 @@
+package tftp_test
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"testing"
+
+	tftp "github.com/doodles526/go-tftp"
+	"github.com/doodles526/go-tftp/errors"
+	"github.com/doodles526/go-tftp/tftptest"
+)
+
+// memHandler serves the files in a map and stores written files in it.
+type memHandler struct {
+	mu    sync.Mutex
+	files map[string][]byte
+}
+
+func newMemHandler(files map[string][]byte) *memHandler {
+	if files == nil {
+		files = make(map[string][]byte)
+	}
+	return &memHandler{files: files}
+}
+
+func (h *memHandler) ReadFile(filename string) (io.ReadCloser, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	b, ok := h.files[filename]
+	if !ok {
+		return nil, errors.ErrorFileNotFound("")
+	}
+	return memReader{bytes.NewReader(b)}, nil
+}
+
+func (h *memHandler) WriteFile(filename string) (io.WriteCloser, error) {
+	return &memWriter{h: h, name: filename}, nil
+}
+
+func (h *memHandler) file(filename string) ([]byte, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	b, ok := h.files[filename]
+	return b, ok
+}
+
+// memReader has a Size method, so that transfers know the file's size.
+type memReader struct {
+	*bytes.Reader
+}
+
+func (memReader) Close() error { return nil }
+
+// memWriter stores the file when closed, unless the transfer was
+// aborted.
+type memWriter struct {
+	bytes.Buffer
+	h       *memHandler
+	name    string
+	aborted bool
+}
+
+func (w *memWriter) Abort() error {
+	w.aborted = true
+	return nil
+}
+
+func (w *memWriter) Close() error {
+	if w.aborted {
+		return nil
+	}
+	w.h.mu.Lock()
+	defer w.h.mu.Unlock()
+	w.h.files[w.name] = w.Bytes()
+	return nil
+}
+
+// serve starts s on n, with n as its Transport unless it has one, and
+// returns the address it listens on.
+func serve(t *testing.T, n *tftptest.Network, s *tftp.Server) string {
+	t.Helper()
+	l, err := n.ListenPacket("udp", "127.0.0.1:69")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Transport == nil {
+		s.Transport = n
+	}
+	go s.Serve(l)
+	t.Cleanup(func() { s.Close() })
+	return l.LocalAddr().String()
+}
+
+// file returns size bytes of test data.
+func file(size int) []byte {
+	b := make([]byte, size)
+	for i := range b {
+		b[i] = byte(i * 7 / 3)
+	}
+	return b
+}
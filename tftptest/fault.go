@@ -0,0 +1,85 @@
+package tftptest
+
+import (
+	"encoding/binary"
+	"net"
+
+	"github.com/doodles526/go-tftp/packets"
+)
+
+// Datagram is a packet sent on a Network, as seen by a Fault.
+type Datagram struct {
+	// N is the number of datagrams sent on the network before this one
+	// plus one, counting those dropped.
+	N        int
+	From, To *net.UDPAddr
+	// Data is a copy of the packet, which a Fault may modify to corrupt
+	// it.
+	Data []byte
+}
+
+// Action is what a Fault does with a datagram.
+type Action int
+
+const (
+	Deliver   Action = iota // deliver the datagram
+	Drop                    // drop the datagram
+	Duplicate               // deliver the datagram twice
+	Delay                   // deliver the datagram after the next one
+)
+
+// A Fault is called for every datagram sent on a Network, in order, and
+// decides what happens to it. It runs with the network locked, so it must
+// not use the network, but it need not be safe for concurrent use.
+type Fault func(d *Datagram) Action
+
+// DropNth drops the nth datagram sent on the network, counting from 1.
+func DropNth(n int) Fault {
+	return func(d *Datagram) Action {
+		if d.N == n {
+			return Drop
+		}
+		return Deliver
+	}
+}
+
+// CorruptNth inverts byte offset of the nth datagram sent on the network,
+// if it is that long.
+func CorruptNth(n, offset int) Fault {
+	return func(d *Datagram) Action {
+		if d.N == n && offset < len(d.Data) {
+			d.Data[offset] ^= 0xff
+		}
+		return Deliver
+	}
+}
+
+// OnBlock applies a to the first DATA or ACK packet, as op says, for
+// block number block, and delivers every other datagram. It scripts
+// faults by block rather than by position in the traffic, which varies
+// with the options negotiated.
+func OnBlock(op packets.Opcode, block uint16, a Action) Fault {
+	done := false
+	return func(d *Datagram) Action {
+		if done || len(d.Data) < 4 ||
+			packets.Opcode(binary.BigEndian.Uint16(d.Data)) != op ||
+			binary.BigEndian.Uint16(d.Data[2:]) != block {
+			return Deliver
+		}
+		done = true
+		return a
+	}
+}
+
+// Faults combines faults: each datagram is passed to every fault in turn,
+// and the first action other than Deliver is taken.
+func Faults(faults ...Fault) Fault {
+	return func(d *Datagram) Action {
+		for _, f := range faults {
+			if a := f(d); a != Deliver {
+				return a
+			}
+		}
+		return Deliver
+	}
+}
@@ -0,0 +1,96 @@
+package tftptest_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	tftp "github.com/doodles526/go-tftp"
+	"github.com/doodles526/go-tftp/packets"
+	"github.com/doodles526/go-tftp/tftptest"
+)
+
+// dataLog records the block numbers of the DATA packets sent on a
+// network.
+type dataLog struct {
+	mu     sync.Mutex
+	blocks []uint16
+}
+
+func (l *dataLog) fault(d *tftptest.Datagram) tftptest.Action {
+	if len(d.Data) >= 4 && packets.Opcode(binary.BigEndian.Uint16(d.Data)) == packets.OpDATA {
+		l.mu.Lock()
+		l.blocks = append(l.blocks, binary.BigEndian.Uint16(d.Data[2:]))
+		l.mu.Unlock()
+	}
+	return tftptest.Deliver
+}
+
+// sends returns how many times each block was sent.
+func (l *dataLog) sends() map[uint16]int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n := make(map[uint16]int)
+	for _, b := range l.blocks {
+		n[b]++
+	}
+	return n
+}
+
+// TestDroppedAck drops ACK 3 in each direction. The sender, whose timeout
+// is the shorter, retransmits block 3; the receiver acknowledges the
+// duplicate, and the transfer goes on without sending any other block
+// twice.
+func TestDroppedAck(t *testing.T) {
+	const short, long = 20 * time.Millisecond, time.Second
+	want := data(6 * 512)
+	for _, put := range []bool{false, true} {
+		t.Run(fmt.Sprintf("put=%v", put), func(t *testing.T) {
+			n := tftptest.NewNetwork(1)
+			var log dataLog
+			n.Fault = tftptest.Faults(tftptest.OnBlock(packets.OpACK, 3, tftptest.Drop), log.fault)
+			h := &handler{files: map[string][]byte{"f": want}}
+			done := make(chan tftp.TransferInfo, 1)
+			s := &tftp.Server{Handler: h, Timeout: long, OnTransferComplete: func(info tftp.TransferInfo) { done <- info }}
+			c := &tftp.Client{Transport: n, Timeout: short}
+			if !put {
+				s.Timeout, c.Timeout = short, long
+			}
+			c.Addr = serve(t, n, s)
+
+			var got []byte
+			if put {
+				if _, err := c.Put("g", bytes.NewReader(want)); err != nil {
+					t.Fatal(err)
+				}
+				<-done
+				got = h.file("g")
+			} else {
+				var buf bytes.Buffer
+				if _, err := c.Get("f", &buf); err != nil {
+					t.Fatal(err)
+				}
+				got = buf.Bytes()
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("received %d bytes differing from the %d sent", len(got), len(want))
+			}
+			sends := log.sends()
+			for block := uint16(1); block <= 7; block++ {
+				want := 1
+				if block == 3 {
+					want = 2
+				}
+				if sends[block] != want {
+					t.Errorf("block %d sent %d times, want %d", block, sends[block], want)
+				}
+			}
+			if len(sends) != 7 {
+				t.Errorf("blocks sent: %v", sends)
+			}
+		})
+	}
+}
@@ -0,0 +1,290 @@
+// Package tftptest provides an in-memory network for testing TFTP clients
+// and servers without real sockets, with optional packet loss,
+// duplication and reordering.
+package tftptest
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// firstEphemeralPort is the first port handed out for port 0.
+const firstEphemeralPort = 49152
+
+// queueLen is the number of datagrams a socket holds before further ones
+// are dropped, as a full UDP receive buffer would.
+const queueLen = 256
+
+// Network is an in-memory datagram network. Its ListenPacket method makes
+// it a tftp.Transport. Sockets have UDP addresses; an empty or unspecified
+// host is taken to be 127.0.0.1.
+//
+// Loss, Duplicate and Reorder are the probabilities that a datagram is
+// dropped, delivered twice, or held back and delivered after the next
+// datagram sent on the network. The random choices are drawn from a
+// source seeded by NewNetwork, so a single-threaded sequence of sends is
+// reproducible. Fault, if set, scripts what happens to specific
+// datagrams; the random choices apply to those it delivers. These fields
+// should be set before the network is used.
+//
+// The zero value is an empty network whose random choices are seeded
+// with 0.
+type Network struct {
+	Loss      float64
+	Duplicate float64
+	Reorder   float64
+	Fault     Fault
+
+	mu       sync.Mutex
+	rand     *rand.Rand
+	sockets  map[string]*PacketConn
+	nextPort int
+	sent     int        // datagrams sent
+	held     []datagram // delayed datagrams awaiting the next send
+}
+
+// NewNetwork returns an empty Network whose random choices are seeded
+// with seed.
+func NewNetwork(seed int64) *Network {
+	return &Network{rand: rand.New(rand.NewSource(seed))}
+}
+
+// init sets up a zero Network, or the parts NewNetwork leaves zero. It
+// must be called with n.mu held.
+func (n *Network) init() {
+	if n.rand == nil {
+		n.rand = rand.New(rand.NewSource(0))
+	}
+	if n.sockets == nil {
+		n.sockets = make(map[string]*PacketConn)
+		n.nextPort = firstEphemeralPort
+	}
+}
+
+// ListenPacket opens a socket on the network. network must be "udp",
+// "udp4" or "udp6"; a zero port in address picks an unused one.
+func (n *Network) ListenPacket(network, address string) (net.PacketConn, error) {
+	switch network {
+	case "udp", "udp4", "udp6":
+	default:
+		return nil, &net.OpError{Op: "listen", Net: network, Err: net.UnknownNetworkError(network)}
+	}
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}
+	if ip := net.ParseIP(host); ip != nil && !ip.IsUnspecified() {
+		addr.IP = ip
+	} else if host != "" && ip == nil {
+		return nil, &net.OpError{Op: "listen", Net: network, Err: errors.New("invalid IP address " + host)}
+	}
+	if addr.Port, err = strconv.Atoi(port); err != nil {
+		return nil, err
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.init()
+	if addr.Port == 0 {
+		for n.sockets[key(addr.IP, n.nextPort)] != nil {
+			n.nextPort++
+		}
+		addr.Port = n.nextPort
+		n.nextPort++
+	}
+	k := key(addr.IP, addr.Port)
+	if n.sockets[k] != nil {
+		return nil, &net.OpError{Op: "listen", Net: network, Addr: addr, Err: errors.New("address already in use")}
+	}
+	c := &PacketConn{
+		net:    n,
+		addr:   addr,
+		in:     make(chan datagram, queueLen),
+		closed: make(chan struct{}),
+		wake:   make(chan struct{}),
+	}
+	n.sockets[k] = c
+	return c, nil
+}
+
+func key(ip net.IP, port int) string {
+	return net.JoinHostPort(ip.String(), strconv.Itoa(port))
+}
+
+// datagram is a packet in flight.
+type datagram struct {
+	b    []byte
+	from *net.UDPAddr
+	to   string
+}
+
+// send routes d, applying the network's loss, duplication and
+// reordering.
+func (n *Network) send(d datagram) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.init()
+	n.sent++
+	a := Deliver
+	if n.Fault != nil {
+		to, _ := net.ResolveUDPAddr("udp", d.to)
+		dg := &Datagram{N: n.sent, From: d.from, To: to, Data: d.b}
+		a = n.Fault(dg)
+		d.b = dg.Data
+	}
+	if a == Deliver {
+		switch {
+		case n.Loss > 0 && n.rand.Float64() < n.Loss:
+			a = Drop
+		case n.Reorder > 0 && n.rand.Float64() < n.Reorder:
+			a = Delay
+		case n.Duplicate > 0 && n.rand.Float64() < n.Duplicate:
+			a = Duplicate
+		}
+	}
+	var out []datagram
+	switch a {
+	case Deliver:
+		out = append(out, d)
+	case Duplicate:
+		out = append(out, d, d)
+	case Delay:
+		n.held = append(n.held, d)
+		return
+	}
+	out = append(out, n.held...)
+	n.held = nil
+	for _, d := range out {
+		if c := n.sockets[d.to]; c != nil {
+			select {
+			case c.in <- d:
+			default:
+			}
+		}
+	}
+}
+
+// PacketConn is a socket on a Network.
+type PacketConn struct {
+	net  *Network
+	addr *net.UDPAddr
+	in   chan datagram
+
+	mu        sync.Mutex
+	closed    chan struct{}
+	isClosed  bool
+	deadline  time.Time
+	wake      chan struct{} // closed when the read deadline changes
+	wdeadline time.Time
+}
+
+// ReadFrom reads the next datagram sent to c.
+func (c *PacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	for {
+		c.mu.Lock()
+		deadline, wake := c.deadline, c.wake
+		c.mu.Unlock()
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if !deadline.IsZero() {
+			d := time.Until(deadline)
+			if d <= 0 {
+				return 0, nil, c.opError("read", os.ErrDeadlineExceeded)
+			}
+			timer = time.NewTimer(d)
+			timeout = timer.C
+		}
+		select {
+		case d := <-c.in:
+			if timer != nil {
+				timer.Stop()
+			}
+			return copy(b, d.b), d.from, nil
+		case <-c.closed:
+			return 0, nil, c.opError("read", net.ErrClosed)
+		case <-wake:
+		case <-timeout:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// WriteTo sends b to addr, which must be a *net.UDPAddr. As with UDP,
+// datagrams to an address nobody listens on are silently dropped.
+func (c *PacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	ua, ok := addr.(*net.UDPAddr)
+	if !ok {
+		return 0, c.opError("write", errors.New("not a UDP address"))
+	}
+	c.mu.Lock()
+	closed, wdeadline := c.isClosed, c.wdeadline
+	c.mu.Unlock()
+	if closed {
+		return 0, c.opError("write", net.ErrClosed)
+	}
+	if !wdeadline.IsZero() && !time.Now().Before(wdeadline) {
+		return 0, c.opError("write", os.ErrDeadlineExceeded)
+	}
+	ip := ua.IP
+	if ip == nil || ip.IsUnspecified() {
+		ip = net.IPv4(127, 0, 0, 1)
+	}
+	from := *c.addr
+	c.net.send(datagram{b: append([]byte(nil), b...), from: &from, to: key(ip, ua.Port)})
+	return len(b), nil
+}
+
+// Close closes the socket, unblocking any ReadFrom.
+func (c *PacketConn) Close() error {
+	c.mu.Lock()
+	if c.isClosed {
+		c.mu.Unlock()
+		return c.opError("close", net.ErrClosed)
+	}
+	c.isClosed = true
+	close(c.closed)
+	c.mu.Unlock()
+	c.net.mu.Lock()
+	delete(c.net.sockets, key(c.addr.IP, c.addr.Port))
+	c.net.mu.Unlock()
+	return nil
+}
+
+// LocalAddr returns the socket's address, a *net.UDPAddr.
+func (c *PacketConn) LocalAddr() net.Addr {
+	return c.addr
+}
+
+func (c *PacketConn) SetDeadline(t time.Time) error {
+	c.SetReadDeadline(t)
+	return c.SetWriteDeadline(t)
+}
+
+// SetReadDeadline sets the read deadline, waking a blocked ReadFrom so
+// that it takes effect at once.
+func (c *PacketConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.deadline = t
+	close(c.wake)
+	c.wake = make(chan struct{})
+	return nil
+}
+
+func (c *PacketConn) SetWriteDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.wdeadline = t
+	return nil
+}
+
+func (c *PacketConn) opError(op string, err error) error {
+	return &net.OpError{Op: op, Net: "udp", Addr: c.addr, Err: err}
+}
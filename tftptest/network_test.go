@@ -0,0 +1,132 @@
+package tftptest_test
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	tftp "github.com/doodles526/go-tftp"
+	"github.com/doodles526/go-tftp/packets"
+	"github.com/doodles526/go-tftp/tftptest"
+	"github.com/doodles526/go-tftp/transfer"
+)
+
+// handler serves the files in a map and stores written files in it.
+type handler struct {
+	mu    sync.Mutex
+	files map[string][]byte
+}
+
+func (h *handler) ReadFile(filename string) (io.ReadCloser, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return io.NopCloser(bytes.NewReader(h.files[filename])), nil
+}
+
+func (h *handler) WriteFile(filename string) (io.WriteCloser, error) {
+	return &writer{h: h, name: filename}, nil
+}
+
+func (h *handler) file(filename string) []byte {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.files[filename]
+}
+
+type writer struct {
+	bytes.Buffer
+	h    *handler
+	name string
+}
+
+// Abort discards the file of a failed transfer.
+func (w *writer) Abort() error { return nil }
+
+func (w *writer) Close() error {
+	w.h.mu.Lock()
+	defer w.h.mu.Unlock()
+	w.h.files[w.name] = w.Bytes()
+	return nil
+}
+
+// serve starts s on n and returns the address it listens on.
+func serve(t *testing.T, n *tftptest.Network, s *tftp.Server) string {
+	t.Helper()
+	l, err := n.ListenPacket("udp", "127.0.0.1:69")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Transport = n
+	go s.Serve(l)
+	t.Cleanup(func() { s.Close() })
+	return l.LocalAddr().String()
+}
+
+func data(size int) []byte {
+	b := make([]byte, size)
+	for i := range b {
+		b[i] = byte(i * 7 / 3)
+	}
+	return b
+}
+
+func TestLoss(t *testing.T) {
+	want := data(100 * 512)
+	for seed := int64(1); seed <= 5; seed++ {
+		n := tftptest.NewNetwork(seed)
+		n.Loss = 0.1
+		h := &handler{files: map[string][]byte{"f": want}}
+		done := make(chan tftp.TransferInfo, 16)
+		addr := serve(t, n, &tftp.Server{
+			Handler:            h,
+			Timeout:            10 * time.Millisecond,
+			Retries:            20,
+			OnTransferComplete: func(info tftp.TransferInfo) { done <- info },
+		})
+		c := &tftp.Client{Addr: addr, Transport: n, Timeout: 10 * time.Millisecond, Retries: 20}
+
+		var buf bytes.Buffer
+		if _, err := c.Get("f", &buf); err != nil {
+			t.Errorf("seed %d: Get: %v", seed, err)
+		} else if !bytes.Equal(buf.Bytes(), want) {
+			t.Errorf("seed %d: Get returned %d bytes differing from the %d served", seed, buf.Len(), len(want))
+		}
+
+		// Without a dallying server, a lost final ACK leaves the client
+		// retransmitting the last block until it gives up, although the
+		// file is complete; RFC 1350 accepts this.
+		_, err := c.Put("g", bytes.NewReader(want))
+		if err != nil && err != transfer.ErrTimeout {
+			t.Errorf("seed %d: Put: %v", seed, err)
+		}
+		// A WRQ retransmitted after a lost ACK 0 starts a second
+		// transfer, which the client refuses, so wait for the one that
+		// succeeds.
+		for stored := false; !stored; {
+			select {
+			case info := <-done:
+				stored = info.Op == packets.OpWRQ && info.Err == nil
+			case <-time.After(time.Second):
+				t.Fatalf("seed %d: the server did not complete the Put", seed)
+			}
+		}
+		if got := h.file("g"); !bytes.Equal(got, want) {
+			t.Errorf("seed %d: Put stored %d bytes differing from the %d sent", seed, len(got), len(want))
+		}
+	}
+}
+
+func TestZeroNetwork(t *testing.T) {
+	n := &tftptest.Network{Loss: 0.01}
+	h := &handler{files: map[string][]byte{"f": data(3000)}}
+	c := &tftp.Client{Addr: serve(t, n, &tftp.Server{Handler: h}), Transport: n, Timeout: 50 * time.Millisecond}
+	var b bytes.Buffer
+	if _, err := c.Get("f", &b); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b.Bytes(), h.file("f")) {
+		t.Errorf("got %d bytes differing from the %d served", b.Len(), len(h.file("f")))
+	}
+}
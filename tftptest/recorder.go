@@ -0,0 +1,56 @@
+package tftptest
+
+import (
+	"net"
+	"sync"
+
+	tftp "github.com/doodles526/go-tftp"
+)
+
+// Recorder is a tftp.Transport that records every datagram sent on the
+// sockets it opens, in order, before passing it on. Given to a Client, with
+// a Network as the underlying transport and a Server on that network, it
+// captures the exact packets the client sends for a transfer without
+// using real sockets, for comparison with a known-good capture.
+type Recorder struct {
+	// Transport opens the recorded sockets.
+	Transport tftp.Transport
+
+	mu      sync.Mutex
+	packets [][]byte
+}
+
+// ListenPacket opens a socket with r.Transport that records what it sends.
+func (r *Recorder) ListenPacket(network, address string) (net.PacketConn, error) {
+	c, err := r.Transport.ListenPacket(network, address)
+	if err != nil {
+		return nil, err
+	}
+	return &recordingConn{PacketConn: c, r: r}, nil
+}
+
+// Packets returns copies of the datagrams sent so far, in order.
+func (r *Recorder) Packets() [][]byte {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([][]byte(nil), r.packets...)
+}
+
+// Reset discards the datagrams recorded so far.
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.packets = nil
+}
+
+type recordingConn struct {
+	net.PacketConn
+	r *Recorder
+}
+
+func (c *recordingConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	c.r.mu.Lock()
+	c.r.packets = append(c.r.packets, append([]byte(nil), b...))
+	c.r.mu.Unlock()
+	return c.PacketConn.WriteTo(b, addr)
+}
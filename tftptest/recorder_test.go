@@ -0,0 +1,48 @@
+package tftptest_test
+
+import (
+	"bytes"
+	"testing"
+
+	tftp "github.com/doodles526/go-tftp"
+	"github.com/doodles526/go-tftp/tftptest"
+)
+
+func TestRecorder(t *testing.T) {
+	n := tftptest.NewNetwork(1)
+	want := data(1500)
+	addr := serve(t, n, &tftp.Server{Handler: &handler{files: map[string][]byte{"f": want}}})
+	rec := &tftptest.Recorder{Transport: n}
+	c := &tftp.Client{Addr: addr, Transport: rec, BlockSize: 1024}
+	var buf bytes.Buffer
+	if _, err := c.Get("f", &buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Error("Get: wrong contents")
+	}
+	// The request, the acknowledgement of the OACK, and one ACK for
+	// each of the two blocks.
+	got := rec.Packets()
+	for i, want := range []string{
+		"\x00\x01f\x00octet\x00blksize\x001024\x00",
+		"\x00\x04\x00\x00",
+		"\x00\x04\x00\x01",
+		"\x00\x04\x00\x02",
+	} {
+		if i >= len(got) {
+			t.Fatalf("recorded %d packets, want 4", len(got))
+		}
+		if string(got[i]) != want {
+			t.Errorf("packet %d is %q, want %q", i, got[i], want)
+		}
+	}
+	if len(got) != 4 {
+		t.Errorf("recorded %d packets, want 4", len(got))
+	}
+
+	rec.Reset()
+	if p := rec.Packets(); len(p) != 0 {
+		t.Errorf("after Reset, %d packets recorded", len(p))
+	}
+}
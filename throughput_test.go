@@ -0,0 +1,61 @@
+package tftp_test
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	tftp "github.com/doodles526/go-tftp"
+	"github.com/doodles526/go-tftp/errors"
+	"github.com/doodles526/go-tftp/tftptest"
+	"github.com/doodles526/go-tftp/transfer"
+)
+
+// throttle delays every datagram on the network by 25ms, so that a
+// transfer of 512-byte blocks runs at about 10KB/s.
+func throttle(d *tftptest.Datagram) tftptest.Action {
+	time.Sleep(25 * time.Millisecond)
+	return tftptest.Deliver
+}
+
+func TestMinThroughput(t *testing.T) {
+	// 20KB at 40KB/s may take 300ms + 512ms, where it needs 2s.
+	data := file(40 * 512)
+
+	n := tftptest.NewNetwork(1)
+	n.Fault = throttle
+	done := make(completions, 1)
+	addr := serve(t, n, &tftp.Server{
+		Handler:            newMemHandler(map[string][]byte{"f": data}),
+		Timeout:            300 * time.Millisecond,
+		MinThroughput:      40000,
+		OnTransferComplete: done.hook,
+		// Nearer than the retransmission deadline, so that it is checked
+		// along with the slow one, which must still prevail.
+		IdleTimeout: 200 * time.Millisecond,
+	})
+	c := &tftp.Client{Addr: addr, Transport: n, Timeout: 5 * time.Second}
+	start := time.Now()
+	_, err := c.Get("f", io.Discard)
+	if e, ok := err.(errors.ErrorNotDefined); !ok || string(e) != "transfer too slow" {
+		t.Errorf("Get from a server requiring 40KB/s: %#v, want the server's transfer too slow", err)
+	}
+	if info := done.next(t); info.Err != transfer.ErrTooSlow {
+		t.Errorf("server reported %v, want ErrTooSlow", info.Err)
+	}
+	if d := time.Since(start); d > 1500*time.Millisecond {
+		t.Errorf("server aborted after %v", d)
+	}
+
+	n = tftptest.NewNetwork(1)
+	n.Fault = throttle
+	addr = serve(t, n, &tftp.Server{Handler: newMemHandler(map[string][]byte{"f": data})})
+	c = &tftp.Client{Addr: addr, Transport: n, Timeout: 300 * time.Millisecond, MinThroughput: 40000}
+	start = time.Now()
+	if _, err := c.Get("f", io.Discard); err != transfer.ErrTooSlow {
+		t.Errorf("Get requiring 40KB/s: %v, want ErrTooSlow", err)
+	}
+	if d := time.Since(start); d > 1500*time.Millisecond {
+		t.Errorf("client aborted after %v", d)
+	}
+}
@@ -0,0 +1,80 @@
+package tftp_test
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	tftp "github.com/doodles526/go-tftp"
+	"github.com/doodles526/go-tftp/packets"
+	"github.com/doodles526/go-tftp/tftptest"
+)
+
+// timeline is a transfer.Tracer recording events as "send DATA 1" and
+// the like, with their times.
+type timeline struct {
+	mu     sync.Mutex
+	events []string
+	times  []time.Time
+}
+
+func (l *timeline) add(dir string, p packets.Packet) {
+	s := fmt.Sprint(dir, " ", p.Opcode())
+	switch p := p.(type) {
+	case *packets.DataPacket:
+		s += fmt.Sprint(" ", p.BlockNumber)
+	case *packets.AckPacket:
+		s += fmt.Sprint(" ", p.BlockNumber)
+	}
+	l.mu.Lock()
+	l.events = append(l.events, s)
+	l.times = append(l.times, time.Now())
+	l.mu.Unlock()
+}
+
+func (l *timeline) OnSend(p packets.Packet) { l.add("send", p) }
+func (l *timeline) OnRecv(p packets.Packet) { l.add("recv", p) }
+
+func (l *timeline) check(t *testing.T, who string, want []string) {
+	t.Helper()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if fmt.Sprint(l.events) != fmt.Sprint(want) {
+		t.Errorf("%s traced %q, want %q", who, l.events, want)
+	}
+	for i := 1; i < len(l.times); i++ {
+		if l.times[i].Before(l.times[i-1]) {
+			t.Errorf("%s traced %q before %q", who, l.events[i], l.events[i-1])
+		}
+	}
+}
+
+func TestTracer(t *testing.T) {
+	n := tftptest.NewNetwork(1)
+	var server, client timeline
+	done := make(completions, 1)
+	addr := serve(t, n, &tftp.Server{
+		Handler:            newMemHandler(map[string][]byte{"f": file(2*512 + 100)}),
+		Tracer:             &server,
+		OnTransferComplete: done.hook,
+	})
+	c := &tftp.Client{Addr: addr, Transport: n, Tracer: &client}
+	if _, err := c.Get("f", io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	done.next(t)
+	client.check(t, "client", []string{
+		"send RRQ",
+		"recv DATA 1", "send ACK 1",
+		"recv DATA 2", "send ACK 2",
+		"recv DATA 3", "send ACK 3",
+	})
+	// The request reaches the server's listener, not the transfer.
+	server.check(t, "server", []string{
+		"send DATA 1", "recv ACK 1",
+		"send DATA 2", "recv ACK 2",
+		"send DATA 3", "recv ACK 3",
+	})
+}
@@ -0,0 +1,30 @@
+package tftp
+
+import (
+	"io"
+)
+
+// Transfer is a file on a TFTP server, implementing io.WriterTo and
+// io.ReaderFrom: WriteTo downloads the file and ReadFrom uploads it, each
+// as one transfer.
+type Transfer struct {
+	client   *Client
+	filename string
+}
+
+// Transfer returns a Transfer for filename on c's server.
+func (c *Client) Transfer(filename string) *Transfer {
+	return &Transfer{client: c, filename: filename}
+}
+
+// WriteTo downloads the file and writes it to w. If w fails, the transfer
+// is aborted and the error returned with the number of bytes written.
+func (t *Transfer) WriteTo(w io.Writer) (int64, error) {
+	return t.client.Get(t.filename, w)
+}
+
+// ReadFrom uploads the contents of r, which may return short reads; the
+// final DATA block is the first that cannot be filled before io.EOF.
+func (t *Transfer) ReadFrom(r io.Reader) (int64, error) {
+	return t.client.Put(t.filename, r)
+}
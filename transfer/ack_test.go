@@ -0,0 +1,113 @@
+package transfer_test
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/doodles526/go-tftp/errors"
+	"github.com/doodles526/go-tftp/packets"
+	"github.com/doodles526/go-tftp/tftptest"
+	"github.com/doodles526/go-tftp/transfer"
+)
+
+// scriptedPeer is the receiving end of a transfer, driven by the test.
+type scriptedPeer struct {
+	t    *testing.T
+	conn net.PacketConn
+	to   net.Addr
+}
+
+func (p *scriptedPeer) ack(block uint16) {
+	b, _ := (&packets.AckPacket{BlockNumber: block}).Encode()
+	p.conn.WriteTo(b, p.to)
+}
+
+// read returns the next packet sent to the peer, or nil if there is none
+// within wait.
+func (p *scriptedPeer) read(wait time.Duration) packets.Packet {
+	buf := make([]byte, 1024)
+	p.conn.SetReadDeadline(time.Now().Add(wait))
+	m, _, err := p.conn.ReadFrom(buf)
+	if err != nil {
+		return nil
+	}
+	pkt, err := packets.Decode(buf[:m])
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	return pkt
+}
+
+// expectData fails unless the next packet is DATA block.
+func (p *scriptedPeer) expectData(block uint16) {
+	p.t.Helper()
+	if d, ok := p.read(time.Second).(*packets.DataPacket); !ok || d.BlockNumber != block {
+		p.t.Fatalf("got %+v, want DATA %d", d, block)
+	}
+}
+
+// sendTo starts sending 3.5 blocks to a scripted peer, without a
+// handshake, so DATA 1 goes out at once.
+func sendTo(t *testing.T, policy transfer.AckPolicy) (*scriptedPeer, <-chan error) {
+	n := tftptest.NewNetwork(1)
+	a, err := n.ListenPacket("udp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := n.ListenPacket("udp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		a.Close()
+		b.Close()
+	})
+	// The timeout is long enough that nothing is retransmitted.
+	sender := transfer.NewSession(a, b.LocalAddr(), transfer.Config{Timeout: 5 * time.Second, AckPolicy: policy})
+	done := make(chan error, 1)
+	go func() {
+		_, err := sender.Send(bytes.NewReader(randomData(3*512+256)), nil)
+		done <- err
+	}()
+	return &scriptedPeer{t: t, conn: b, to: a.LocalAddr()}, done
+}
+
+func TestIgnoreFarAck(t *testing.T) {
+	peer, done := sendTo(t, transfer.IgnoreUnexpectedAcks)
+	peer.expectData(1)
+	peer.ack(1)
+	peer.expectData(2)
+	peer.ack(9999)
+	if p := peer.read(100 * time.Millisecond); p != nil {
+		t.Fatalf("ACK 9999 answered with %+v", p)
+	}
+	for block := uint16(2); block <= 3; block++ {
+		peer.ack(block)
+		peer.expectData(block + 1)
+	}
+	peer.ack(4)
+	if err := <-done; err != nil {
+		t.Errorf("Send: %v", err)
+	}
+}
+
+func TestRejectFarAck(t *testing.T) {
+	peer, done := sendTo(t, transfer.RejectUnexpectedAcks)
+	peer.expectData(1)
+	peer.ack(1)
+	peer.expectData(2)
+	peer.ack(9999)
+	if e, ok := peer.read(time.Second).(*packets.ErrorPacket); !ok || e.ErrorCode != packets.ErrCodeIllegalOperation {
+		t.Errorf("ACK 9999 answered with %+v, want ERROR 4", e)
+	}
+	if err := <-done; !isIllegalOperation(err) {
+		t.Errorf("Send: %#v, want ErrorIllegalOperation", err)
+	}
+}
+
+func isIllegalOperation(err error) bool {
+	_, ok := err.(errors.ErrorIllegalOperation)
+	return ok
+}
@@ -0,0 +1,29 @@
+package transfer_test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/doodles526/go-tftp/transfer"
+)
+
+func TestSameAddr(t *testing.T) {
+	v4 := &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1).To4(), Port: 69}
+	for _, c := range []struct {
+		a, b *net.UDPAddr
+		same bool
+	}{
+		// The IPv4-mapped IPv6 form of an address is the same address.
+		{v4, &net.UDPAddr{IP: net.ParseIP("::ffff:192.0.2.1"), Port: 69}, true},
+		{v4, &net.UDPAddr{IP: v4.IP, Port: 70}, false},
+		{&net.UDPAddr{IP: net.ParseIP("fe80::1"), Port: 69, Zone: "eth0"}, &net.UDPAddr{IP: net.ParseIP("fe80::1"), Port: 69, Zone: "eth0"}, true},
+		{&net.UDPAddr{IP: net.ParseIP("fe80::1"), Port: 69, Zone: "eth0"}, &net.UDPAddr{IP: net.ParseIP("fe80::1"), Port: 69, Zone: "eth1"}, false},
+		// A zone missing on one side does not make a mismatch.
+		{&net.UDPAddr{IP: net.ParseIP("fe80::1"), Port: 69, Zone: "eth0"}, &net.UDPAddr{IP: net.ParseIP("fe80::1"), Port: 69}, true},
+		{&net.UDPAddr{IP: net.IPv6loopback, Port: 69}, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 69}, false},
+	} {
+		if got := transfer.SameAddr(c.a, c.b); got != c.same {
+			t.Errorf("SameAddr(%v, %v) = %v, want %v", c.a, c.b, got, c.same)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package transfer
+
+import "time"
+
+// Backoff chooses how long a session waits for a reply after each
+// retransmission. The first wait is always Config.Timeout, and a transfer
+// still fails once Config.Retries retransmissions have gone unanswered.
+type Backoff interface {
+	// NextTimeout returns the timeout to use after retransmission number
+	// attempt, counting from 1, given the timeout that just expired.
+	NextTimeout(attempt int, last time.Duration) time.Duration
+}
+
+// ConstantBackoff waits Config.Timeout after every retransmission. It is
+// the behavior of a Config without a Backoff.
+type ConstantBackoff struct{}
+
+func (ConstantBackoff) NextTimeout(attempt int, last time.Duration) time.Duration {
+	return last
+}
+
+// ExponentialBackoff doubles the timeout after every retransmission, up
+// to Max. A zero Max is MaxTimeout seconds, the largest timeout a peer
+// can negotiate.
+type ExponentialBackoff struct {
+	Max time.Duration
+}
+
+func (b ExponentialBackoff) NextTimeout(attempt int, last time.Duration) time.Duration {
+	max := b.Max
+	if max == 0 {
+		max = MaxTimeout * time.Second
+	}
+	if last >= max/2 {
+		return max
+	}
+	return 2 * last
+}
+
+// nextTimeout applies c.Backoff, if any, to the timeout last.
+func (c Config) nextTimeout(attempt int, last time.Duration) time.Duration {
+	if c.Backoff == nil {
+		return last
+	}
+	return c.Backoff.NextTimeout(attempt, last)
+}
@@ -0,0 +1,57 @@
+package transfer_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/doodles526/go-tftp/tftptest"
+	"github.com/doodles526/go-tftp/transfer"
+)
+
+func TestExponentialBackoff(t *testing.T) {
+	b := transfer.ExponentialBackoff{Max: 5 * time.Second}
+	want := []time.Duration{2, 4, 5, 5}
+	last := time.Second
+	for i, w := range want {
+		last = b.NextTimeout(i+1, last)
+		if last != w*time.Second {
+			t.Errorf("after retransmission %d: %v, want %v", i+1, last, w*time.Second)
+		}
+	}
+	if got := (transfer.ExponentialBackoff{}).NextTimeout(1, 200*time.Second); got != transfer.MaxTimeout*time.Second {
+		t.Errorf("default ceiling %v, want %v", got, transfer.MaxTimeout*time.Second)
+	}
+}
+
+func TestConstantBackoff(t *testing.T) {
+	for attempt := 1; attempt <= 5; attempt++ {
+		if got := (transfer.ConstantBackoff{}).NextTimeout(attempt, time.Second); got != time.Second {
+			t.Errorf("after retransmission %d: %v, want 1s", attempt, got)
+		}
+	}
+}
+
+func TestBackoffRetriesCap(t *testing.T) {
+	// Nobody answers the sender.
+	sender, _ := pair(t, tftptest.NewNetwork(1), transfer.Config{
+		Timeout: 10 * time.Millisecond,
+		Retries: 3,
+		Backoff: transfer.ExponentialBackoff{Max: time.Second},
+	})
+	var m transfer.Metrics
+	sender.Metrics = &m
+	start := time.Now()
+	_, err := sender.Send(bytes.NewReader([]byte("data")), nil)
+	d := time.Since(start)
+	if err != transfer.ErrTimeout {
+		t.Fatalf("Send: %v, want %v", err, transfer.ErrTimeout)
+	}
+	if r := m.Retransmissions.Load(); r != 3 {
+		t.Errorf("%d retransmissions, want 3", r)
+	}
+	// 10ms, then 20, 40 and 80ms after each retransmission.
+	if d < 150*time.Millisecond || d > time.Second {
+		t.Errorf("gave up after %v, want about 150ms", d)
+	}
+}
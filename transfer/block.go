@@ -0,0 +1,41 @@
+// Package transfer implements the TFTP transfer state machines shared by
+// the client and server: block numbering, option negotiation and the
+// send/receive loops.
+package transfer
+
+// Block numbers are 16 bits wide and wrap after 65535, which with the
+// default 512-byte block size limits a transfer to about 32 MiB unless
+// both ends agree to keep counting past the wrap. RFC 1350 does not say
+// what follows 65535; most implementations continue with 0, some with 1
+// (block 0 otherwise only appears in the ACK of a WRQ or OACK).
+
+// RolloverMode selects the block number that follows 65535.
+type RolloverMode int
+
+const (
+	// RolloverToZero continues with block 0 after 65535.
+	RolloverToZero RolloverMode = iota
+	// RolloverToOne continues with block 1 after 65535.
+	RolloverToOne
+)
+
+// NextBlock returns the block number following n, wrapping to 0.
+func NextBlock(n uint16) uint16 {
+	return n + 1
+}
+
+// Next returns the block number following n under rollover mode m.
+func (m RolloverMode) Next(n uint16) uint16 {
+	if n == 65535 && m == RolloverToOne {
+		return 1
+	}
+	return NextBlock(n)
+}
+
+// BlockBefore reports whether block a was sent before block b, treating
+// the block counter as a serial number (RFC 1982) so that comparisons
+// stay correct across a wrap. It is only meaningful for blocks less than
+// 32768 apart, which always holds within a window.
+func BlockBefore(a, b uint16) bool {
+	return a != b && int16(a-b) < 0
+}
@@ -0,0 +1,47 @@
+package transfer_test
+
+import (
+	"testing"
+
+	"github.com/doodles526/go-tftp/transfer"
+)
+
+func TestNextBlock(t *testing.T) {
+	for _, c := range []struct {
+		n    uint16
+		mode transfer.RolloverMode
+		want uint16
+	}{
+		{1, transfer.RolloverToZero, 2},
+		{65534, transfer.RolloverToZero, 65535},
+		{65535, transfer.RolloverToZero, 0},
+		{0, transfer.RolloverToZero, 1},
+		{65535, transfer.RolloverToOne, 1},
+		{0, transfer.RolloverToOne, 1},
+	} {
+		if got := c.mode.Next(c.n); got != c.want {
+			t.Errorf("mode %d: Next(%d) = %d, want %d", c.mode, c.n, got, c.want)
+		}
+	}
+	if got := transfer.NextBlock(65535); got != 0 {
+		t.Errorf("NextBlock(65535) = %d, want 0", got)
+	}
+}
+
+func TestBlockBefore(t *testing.T) {
+	for _, c := range []struct {
+		a, b uint16
+		want bool
+	}{
+		{1, 2, true},
+		{2, 1, false},
+		{5, 5, false},
+		{65535, 0, true},
+		{65530, 3, true},
+		{3, 65530, false},
+	} {
+		if got := transfer.BlockBefore(c.a, c.b); got != c.want {
+			t.Errorf("BlockBefore(%d, %d) = %v, want %v", c.a, c.b, got, c.want)
+		}
+	}
+}
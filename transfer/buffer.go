@@ -0,0 +1,40 @@
+package transfer
+
+import (
+	"sync"
+)
+
+// BufferSize returns the size of a buffer that holds a DATA packet with a
+// blockSize-byte payload: the payload plus the opcode and block number.
+func BufferSize(blockSize int) int {
+	return blockSize + 4
+}
+
+// AllocBuffer returns a new receive buffer for blockSize-byte blocks.
+func AllocBuffer(blockSize int) []byte {
+	return make([]byte, BufferSize(blockSize))
+}
+
+var bufferPool sync.Pool // of *[]byte
+
+// GetBuffer returns a receive buffer for blockSize-byte blocks from a
+// shared pool, allocating one if the pool has none large enough. The
+// buffer's length is exactly BufferSize(blockSize). Return it with
+// PutBuffer once it is no longer referenced, including by packets decoded
+// from it.
+func GetBuffer(blockSize int) []byte {
+	size := BufferSize(blockSize)
+	if bp, ok := bufferPool.Get().(*[]byte); ok {
+		if cap(*bp) >= size {
+			return (*bp)[:size]
+		}
+		bufferPool.Put(bp)
+	}
+	return make([]byte, size)
+}
+
+// PutBuffer returns a buffer obtained from GetBuffer to the pool.
+func PutBuffer(b []byte) {
+	b = b[:cap(b)]
+	bufferPool.Put(&b)
+}
@@ -0,0 +1,48 @@
+package transfer_test
+
+import (
+	"testing"
+
+	"github.com/doodles526/go-tftp/packets"
+	"github.com/doodles526/go-tftp/transfer"
+)
+
+func TestGetBufferMaxBlockSize(t *testing.T) {
+	// A small buffer in the pool must not be handed out for a large
+	// block.
+	transfer.PutBuffer(transfer.GetBuffer(512))
+	b := transfer.GetBuffer(packets.MaxBlockSize)
+	if len(b) != packets.MaxBlockSize+4 {
+		t.Errorf("GetBuffer(%d) has length %d, want %d", packets.MaxBlockSize, len(b), packets.MaxBlockSize+4)
+	}
+	transfer.PutBuffer(b)
+	// A large buffer from the pool is cut to the requested size.
+	if b := transfer.GetBuffer(512); len(b) != 516 {
+		t.Errorf("GetBuffer(512) has length %d, want 516", len(b))
+	}
+	if b := transfer.AllocBuffer(packets.MaxBlockSize); len(b) != packets.MaxBlockSize+4 {
+		t.Errorf("AllocBuffer(%d) has length %d", packets.MaxBlockSize, len(b))
+	}
+}
+
+func BenchmarkBuffer(b *testing.B) {
+	b.Run("AllocBuffer", func(b *testing.B) {
+		b.ReportAllocs()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				buf := transfer.AllocBuffer(1468)
+				buf[0] = 1
+			}
+		})
+	})
+	b.Run("GetBuffer", func(b *testing.B) {
+		b.ReportAllocs()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				buf := transfer.GetBuffer(1468)
+				buf[0] = 1
+				transfer.PutBuffer(buf)
+			}
+		})
+	})
+}
@@ -0,0 +1,89 @@
+package transfer
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// BlockCache keeps the encoded DATA packets of recently sent files, so a
+// file read by many clients is read from its source and encoded only once.
+// Entries are keyed by filename, block size and block number, and are
+// stamped with the file's modification time: a lookup with a different
+// time misses and drops the stale entry. The least recently used packets
+// are evicted once the cache holds its maximum number of blocks. A
+// BlockCache is safe for concurrent use by several sessions.
+type BlockCache struct {
+	max int
+
+	mu    sync.Mutex
+	lru   *list.List // of *cacheEntry, most recently used first
+	items map[cacheKey]*list.Element
+}
+
+type cacheKey struct {
+	name      string
+	blockSize int
+	block     uint16
+}
+
+type cacheEntry struct {
+	key     cacheKey
+	modTime time.Time
+	packet  []byte
+}
+
+// NewBlockCache returns a cache holding up to maxBlocks packets.
+func NewBlockCache(maxBlocks int) *BlockCache {
+	return &BlockCache{max: maxBlocks, lru: list.New(), items: make(map[cacheKey]*list.Element)}
+}
+
+// Get returns the encoded DATA packet for block of file name, sent in
+// blockSize-byte blocks, if it is cached for the given modification time.
+// The packet must not be modified.
+func (c *BlockCache) Get(name string, modTime time.Time, blockSize int, block uint16) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[cacheKey{name, blockSize, block}]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*cacheEntry)
+	if !e.modTime.Equal(modTime) {
+		c.lru.Remove(el)
+		delete(c.items, e.key)
+		return nil, false
+	}
+	c.lru.MoveToFront(el)
+	return e.packet, true
+}
+
+// Put adds the encoded DATA packet for block of file name to the cache,
+// replacing any previous entry. The cache keeps packet, which must not be
+// modified afterwards.
+func (c *BlockCache) Put(name string, modTime time.Time, blockSize int, block uint16, packet []byte) {
+	if c.max <= 0 {
+		return
+	}
+	key := cacheKey{name, blockSize, block}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		e := el.Value.(*cacheEntry)
+		e.modTime, e.packet = modTime, packet
+		c.lru.MoveToFront(el)
+		return
+	}
+	c.items[key] = c.lru.PushFront(&cacheEntry{key, modTime, packet})
+	if c.lru.Len() > c.max {
+		e := c.lru.Remove(c.lru.Back()).(*cacheEntry)
+		delete(c.items, e.key)
+	}
+}
+
+// Len returns the number of packets in the cache.
+func (c *BlockCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
@@ -0,0 +1,39 @@
+package transfer_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/doodles526/go-tftp/transfer"
+)
+
+func TestBlockCache(t *testing.T) {
+	c := transfer.NewBlockCache(2)
+	mod := time.Unix(1000, 0)
+	c.Put("f", mod, 512, 1, []byte("one"))
+	if p, ok := c.Get("f", mod, 512, 1); !ok || !bytes.Equal(p, []byte("one")) {
+		t.Errorf("Get = %q, %v; want the packet put", p, ok)
+	}
+	if _, ok := c.Get("f", mod, 1024, 1); ok {
+		t.Error("hit for another block size")
+	}
+	// A newer file misses, and the stale entry is dropped.
+	if _, ok := c.Get("f", mod.Add(time.Second), 512, 1); ok {
+		t.Error("hit for a modified file")
+	}
+	if _, ok := c.Get("f", mod, 512, 1); ok || c.Len() != 0 {
+		t.Errorf("stale entry kept, Len = %d", c.Len())
+	}
+	// The least recently used block is evicted.
+	c.Put("f", mod, 512, 1, []byte("one"))
+	c.Put("f", mod, 512, 2, []byte("two"))
+	c.Get("f", mod, 512, 1)
+	c.Put("f", mod, 512, 3, []byte("three"))
+	if _, ok := c.Get("f", mod, 512, 2); ok {
+		t.Error("block 2 not evicted")
+	}
+	if _, ok := c.Get("f", mod, 512, 1); !ok || c.Len() != 2 {
+		t.Errorf("block 1 evicted, Len = %d", c.Len())
+	}
+}
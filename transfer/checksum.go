@@ -0,0 +1,25 @@
+package transfer
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+)
+
+// checksumLen is the size of the CRC appended to payloads when
+// Config.Checksum is set.
+const checksumLen = 4
+
+// appendChecksum appends the CRC-32 of data to it.
+func appendChecksum(data []byte) []byte {
+	return binary.BigEndian.AppendUint32(data, crc32.ChecksumIEEE(data))
+}
+
+// stripChecksum verifies and removes the CRC-32 at the end of payload. It
+// reports false if the payload is too short or the CRC does not match.
+func stripChecksum(payload []byte) ([]byte, bool) {
+	if len(payload) < checksumLen {
+		return nil, false
+	}
+	data, sum := payload[:len(payload)-checksumLen], payload[len(payload)-checksumLen:]
+	return data, crc32.ChecksumIEEE(data) == binary.BigEndian.Uint32(sum)
+}
@@ -0,0 +1,40 @@
+package transfer_test
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/doodles526/go-tftp/packets"
+	"github.com/doodles526/go-tftp/tftptest"
+	"github.com/doodles526/go-tftp/transfer"
+)
+
+func TestChecksumRecoversCorruptBlock(t *testing.T) {
+	n := tftptest.NewNetwork(1)
+	corrupted := 0
+	n.Fault = func(d *tftptest.Datagram) tftptest.Action {
+		// Flip a payload byte of the first copy of block 2.
+		if corrupted == 0 && len(d.Data) > 10 &&
+			packets.Opcode(binary.BigEndian.Uint16(d.Data)) == packets.OpDATA &&
+			binary.BigEndian.Uint16(d.Data[2:]) == 2 {
+			d.Data[10] ^= 0xff
+			corrupted++
+		}
+		return tftptest.Deliver
+	}
+	cfg := transfer.Config{Checksum: true, Timeout: 20 * time.Millisecond}
+	sender, receiver := pair(t, n, cfg)
+	var m transfer.Metrics
+	sender.Metrics = &m
+	data := randomData(3000)
+	got, sent, received := run(sender, receiver, data)
+	checkTransfer(t, got, sent, received, data)
+	if corrupted != 1 {
+		t.Fatalf("corrupted %d blocks, want 1", corrupted)
+	}
+	// The corrupt copy of block 2 was sent again.
+	if b := m.BlocksSent.Load(); b != 7 {
+		t.Errorf("BlocksSent = %d, want 6 blocks and 1 resend", b)
+	}
+}
@@ -0,0 +1,138 @@
+package transfer
+
+import (
+	"time"
+
+	"github.com/doodles526/go-tftp/packets"
+)
+
+// Defaults used for a zero Config field.
+const (
+	DefaultBlockSize  = 512
+	DefaultWindowSize = 1
+	DefaultTimeout    = time.Second
+	DefaultRetries    = 5
+)
+
+// Limits on negotiable option values, as in the packets package.
+const (
+	MinBlockSize  = packets.MinBlockSize
+	MaxBlockSize  = packets.MaxBlockSize
+	MinTimeout    = packets.MinTimeout
+	MaxTimeout    = packets.MaxTimeout
+	MinUTimeout   = packets.MinUTimeout
+	MaxUTimeout   = packets.MaxUTimeout
+	MaxWindowSize = packets.MaxWindowSize
+)
+
+// Config holds the parameters of a single transfer. The zero value is a
+// plain RFC 1350 transfer with the package defaults.
+type Config struct {
+	// BlockSize is the payload size of a full DATA block.
+	BlockSize int
+	// WindowSize is the number of DATA blocks sent before waiting for an
+	// ACK (RFC 7440).
+	WindowSize int
+	// Timeout is how long to wait for a reply before retransmitting.
+	Timeout time.Duration
+	// Retries is how many times a packet is retransmitted before the
+	// transfer fails with ErrTimeout.
+	Retries int
+	// Backoff, if set, lengthens the timeout after each retransmission.
+	// The first wait is Timeout.
+	Backoff Backoff
+	// Rollover selects the block number that follows 65535.
+	Rollover RolloverMode
+	// Checksum appends a CRC-32 to every DATA payload, as negotiated
+	// with packets.OptionChecksum. Blocks that fail the check are
+	// discarded and the previous block acknowledged again.
+	Checksum bool
+	// LenientDecode accepts ACK and ERROR packets padded with NUL bytes
+	// and unterminated ERROR messages, as packets.Decoder does.
+	LenientDecode bool
+	// AckPolicy selects what Send does with an unexpected ACK.
+	AckPolicy AckPolicy
+	// IdleTimeout, if not zero, fails the transfer with ErrTimeout when
+	// no block has been acknowledged or received for that long, even if
+	// retransmissions remain. It bounds the time a peer can keep a
+	// transfer open by sending packets that make no progress.
+	IdleTimeout time.Duration
+	// SendDelay, if not zero, is the least time between the starts of
+	// two DATA sends, for pacing slow receivers. Unlike a Limiter it does
+	// not depend on the block size. The retransmission timeout starts
+	// after the last block of a window is sent, so it is not shortened by
+	// the delay.
+	SendDelay time.Duration
+	// MinThroughput, if not zero, is the lowest average rate in bytes per
+	// second a transfer may run at, once the size of the file is known
+	// from Session.ExpectSize. A transfer still running when the file
+	// would have been done at that rate, plus Timeout, fails with
+	// ErrTooSlow, bounding the time a hopelessly slow transfer takes.
+	MinThroughput int
+	// ConnectTimeout, if not zero, fails a client session with
+	// ErrConnectTimeout when the server has not replied to the request
+	// within that long, even if retransmissions remain.
+	ConnectTimeout time.Duration
+}
+
+// AckPolicy selects what Send does with an ACK that is unexpected: one
+// for a block not yet sent, or for a block acknowledged more than a
+// window ago. ACKs of the blocks in flight and repeats of recent ACKs,
+// which duplication and reordering produce, are always expected.
+type AckPolicy int
+
+const (
+	// IgnoreUnexpectedAcks discards unexpected ACKs.
+	IgnoreUnexpectedAcks AckPolicy = iota
+	// RejectUnexpectedAcks aborts the transfer with
+	// errors.ErrorIllegalOperation, on the grounds that the peer is
+	// broken or hostile.
+	RejectUnexpectedAcks
+)
+
+// withDefaults returns c with zero fields replaced by the defaults.
+func (c Config) withDefaults() Config {
+	if c.BlockSize == 0 {
+		c.BlockSize = DefaultBlockSize
+	}
+	if c.WindowSize == 0 {
+		c.WindowSize = DefaultWindowSize
+	}
+	if c.Timeout == 0 {
+		c.Timeout = DefaultTimeout
+	}
+	if c.Retries == 0 {
+		c.Retries = DefaultRetries
+	}
+	return c
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "tftp: transfer timed out" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// ErrTimeout is returned when the peer stops responding for longer than
+// the configured timeout and retries allow.
+var ErrTimeout error = timeoutError{}
+
+type tooSlowError struct{}
+
+func (tooSlowError) Error() string   { return "tftp: transfer below minimum throughput" }
+func (tooSlowError) Timeout() bool   { return true }
+func (tooSlowError) Temporary() bool { return true }
+
+// ErrTooSlow is returned when a transfer takes longer than
+// Config.MinThroughput allows.
+var ErrTooSlow error = tooSlowError{}
+
+type connectTimeoutError struct{}
+
+func (connectTimeoutError) Error() string   { return "tftp: no reply to request" }
+func (connectTimeoutError) Timeout() bool   { return true }
+func (connectTimeoutError) Temporary() bool { return true }
+
+// ErrConnectTimeout is returned when a server does not reply to a request
+// within Config.ConnectTimeout.
+var ErrConnectTimeout error = connectTimeoutError{}
@@ -0,0 +1,45 @@
+package transfer_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/doodles526/go-tftp/packets"
+	"github.com/doodles526/go-tftp/tftptest"
+	"github.com/doodles526/go-tftp/transfer"
+)
+
+func TestSendDelay(t *testing.T) {
+	// Five blocks, the last short: four gaps of at least 10ms, whether
+	// each block waits for its ACK or the whole window is sent at once.
+	data := randomData(4*512 + 100)
+	for _, window := range []int{1, 5} {
+		n := tftptest.NewNetwork(1)
+		cfg := transfer.Config{SendDelay: 10 * time.Millisecond, WindowSize: window}
+		sender, receiver := pair(t, n, cfg)
+		start := time.Now()
+		got, sent, received := run(sender, receiver, data)
+		d := time.Since(start)
+		checkTransfer(t, got, sent, received, data)
+		if d < 40*time.Millisecond {
+			t.Errorf("window %d: 5 blocks 10ms apart took %v, want at least 40ms", window, d)
+		}
+	}
+}
+
+func TestSendDelayRetransmit(t *testing.T) {
+	// A lost block is sent again once the retransmission timeout, which
+	// the delay does not lengthen, expires.
+	n := tftptest.NewNetwork(1)
+	n.Fault = tftptest.OnBlock(packets.OpDATA, 3, tftptest.Drop)
+	cfg := transfer.Config{SendDelay: 10 * time.Millisecond, Timeout: 50 * time.Millisecond}
+	sender, receiver := pair(t, n, cfg)
+	data := randomData(4*512 + 100)
+	start := time.Now()
+	got, sent, received := run(sender, receiver, data)
+	d := time.Since(start)
+	checkTransfer(t, got, sent, received, data)
+	if d > 500*time.Millisecond {
+		t.Errorf("transfer with one lost block took %v", d)
+	}
+}
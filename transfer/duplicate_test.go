@@ -0,0 +1,28 @@
+package transfer_test
+
+import (
+	"testing"
+
+	"github.com/doodles526/go-tftp/packets"
+	"github.com/doodles526/go-tftp/tftptest"
+	"github.com/doodles526/go-tftp/transfer"
+)
+
+func TestDuplicateDataWrittenOnce(t *testing.T) {
+	n := tftptest.NewNetwork(1)
+	n.Fault = tftptest.OnBlock(packets.OpDATA, 2, tftptest.Duplicate)
+	sender, receiver := pair(t, n, transfer.Config{})
+	var m transfer.Metrics
+	sender.Metrics = &m
+	data := randomData(2000)
+	got, sent, received := run(sender, receiver, data)
+	// A second copy of block 2 written out would make got too long.
+	checkTransfer(t, got, sent, received, data)
+	if s := receiver.Summary(); s.Blocks != 4 {
+		t.Errorf("received %d blocks, want 4", s.Blocks)
+	}
+	// The ACK of the duplicate must not make the sender resend block 3.
+	if b, r := m.BlocksSent.Load(), m.Retransmissions.Load(); b != 4 || r != 0 {
+		t.Errorf("sent %d blocks with %d retransmissions, want 4 and 0", b, r)
+	}
+}
@@ -0,0 +1,35 @@
+package transfer
+
+import (
+	"time"
+)
+
+// EstimateDuration estimates how long a transfer of fileSize bytes takes
+// with the given block size, round-trip time and window size (1 for
+// lockstep transfers). It assumes one round trip per window of blocks and
+// no loss, ignoring the time spent putting bytes on the wire, so it is a
+// lower bound on links where latency dominates. Zero or negative block and
+// window sizes are taken as the defaults.
+func EstimateDuration(fileSize int64, blockSize int, rtt time.Duration, windowSize int) time.Duration {
+	if windowSize <= 0 {
+		windowSize = DefaultWindowSize
+	}
+	blocks := BlockCount(fileSize, blockSize)
+	windows := (blocks + int64(windowSize) - 1) / int64(windowSize)
+	return time.Duration(windows) * rtt
+}
+
+// BlockCount returns the number of DATA blocks in a transfer of size bytes
+// with the given block size. The final block is short, and empty if size
+// is a multiple of the block size, so an empty file takes one block and a
+// file of exactly blockSize bytes two. A zero or negative block size is
+// taken as the default, and a negative size as zero.
+func BlockCount(size int64, blockSize int) int64 {
+	if blockSize <= 0 {
+		blockSize = DefaultBlockSize
+	}
+	if size < 0 {
+		size = 0
+	}
+	return size/int64(blockSize) + 1
+}
@@ -0,0 +1,49 @@
+package transfer_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/doodles526/go-tftp/transfer"
+)
+
+func TestEstimateDuration(t *testing.T) {
+	const rtt = 10 * time.Millisecond
+	// 100 full blocks and the empty final one: 101 round trips in
+	// lockstep, 13 windows of 8.
+	size := int64(100 * 512)
+	lockstep := transfer.EstimateDuration(size, 512, rtt, 1)
+	windowed := transfer.EstimateDuration(size, 512, rtt, 8)
+	if lockstep != 101*rtt {
+		t.Errorf("lockstep: %v, want %v", lockstep, 101*rtt)
+	}
+	if windowed != 13*rtt {
+		t.Errorf("window of 8: %v, want %v", windowed, 13*rtt)
+	}
+	if windowed >= lockstep {
+		t.Errorf("window of 8 (%v) not faster than lockstep (%v)", windowed, lockstep)
+	}
+	if got := transfer.EstimateDuration(size, 0, rtt, 0); got != lockstep {
+		t.Errorf("defaults: %v, want %v", got, lockstep)
+	}
+}
+
+func TestBlockCount(t *testing.T) {
+	for _, c := range []struct {
+		size      int64
+		blockSize int
+		want      int64
+	}{
+		{0, 512, 1},   // one empty block
+		{512, 512, 2}, // a full block and an empty one
+		{513, 512, 2}, // a full block and a short one
+		{1467, 1468, 1},
+		{3 * 1468, 1468, 4},
+		{1024, 0, 3}, // the default block size
+		{-1, 512, 1},
+	} {
+		if got := transfer.BlockCount(c.size, c.blockSize); got != c.want {
+			t.Errorf("BlockCount(%d, %d) = %d, want %d", c.size, c.blockSize, got, c.want)
+		}
+	}
+}
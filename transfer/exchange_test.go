@@ -0,0 +1,129 @@
+package transfer_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/doodles526/go-tftp/errors"
+	"github.com/doodles526/go-tftp/packets"
+	"github.com/doodles526/go-tftp/tftptest"
+	"github.com/doodles526/go-tftp/transfer"
+)
+
+func (p *scriptedPeer) send(pkt packets.Packet) {
+	b, _ := pkt.Encode()
+	p.conn.WriteTo(b, p.to)
+}
+
+// exchange starts an Exchange of a read request with a scripted peer.
+func exchange(t *testing.T, n *tftptest.Network, cfg transfer.Config) (*scriptedPeer, <-chan packets.Packet, <-chan error) {
+	a, err := n.ListenPacket("udp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := n.ListenPacket("udp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		a.Close()
+		b.Close()
+	})
+	s := transfer.NewSession(a, b.LocalAddr(), cfg)
+	reply := make(chan packets.Packet, 1)
+	done := make(chan error, 1)
+	go func() {
+		p, err := s.Exchange(&packets.ReadRequestPacket{Filename: "f", Mode: packets.ModeOctet})
+		if p != nil {
+			// The packet is only valid until the session next reads.
+			p = &packets.DataPacket{BlockNumber: p.(*packets.DataPacket).BlockNumber}
+		}
+		reply <- p
+		done <- err
+	}()
+	return &scriptedPeer{t: t, conn: b, to: a.LocalAddr()}, reply, done
+}
+
+// expectRequest fails unless the next packet is the read request.
+func (p *scriptedPeer) expectRequest(wait time.Duration) {
+	p.t.Helper()
+	if _, ok := p.read(wait).(*packets.ReadRequestPacket); !ok {
+		p.t.Fatal("read request not sent")
+	}
+}
+
+func TestExchange(t *testing.T) {
+	n := tftptest.NewNetwork(1)
+	peer, reply, done := exchange(t, n, transfer.Config{Timeout: 5 * time.Second})
+	peer.expectRequest(time.Second)
+	// A packet from another TID is refused and does not end the wait.
+	stranger, err := n.ListenPacket("udp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stranger.Close()
+	b, _ := (&packets.DataPacket{BlockNumber: 9}).Encode()
+	stranger.WriteTo(b, peer.to)
+	buf := make([]byte, 516)
+	stranger.SetReadDeadline(time.Now().Add(time.Second))
+	m, _, err := stranger.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, _ := packets.Decode(buf[:m])
+	if e, ok := p.(*packets.ErrorPacket); !ok || e.ErrorCode != packets.ErrCodeUnknownTransferID {
+		t.Errorf("stranger answered with %+v, want ERROR 5", p)
+	}
+	peer.send(&packets.DataPacket{BlockNumber: 1})
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if d := (<-reply).(*packets.DataPacket); d.BlockNumber != 1 {
+		t.Errorf("Exchange returned DATA %d, want DATA 1", d.BlockNumber)
+	}
+	if p := peer.read(50 * time.Millisecond); p != nil {
+		t.Errorf("sent %+v after the reply", p)
+	}
+}
+
+func TestExchangeRetransmits(t *testing.T) {
+	peer, reply, done := exchange(t, tftptest.NewNetwork(1), transfer.Config{Timeout: 50 * time.Millisecond, Retries: 3})
+	peer.expectRequest(time.Second)
+	// Unanswered, the request is sent again after the timeout.
+	peer.expectRequest(time.Second)
+	peer.send(&packets.DataPacket{BlockNumber: 1})
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if d := (<-reply).(*packets.DataPacket); d.BlockNumber != 1 {
+		t.Errorf("Exchange returned DATA %d, want DATA 1", d.BlockNumber)
+	}
+
+	peer, _, done = exchange(t, tftptest.NewNetwork(1), transfer.Config{Timeout: 20 * time.Millisecond, Retries: 2})
+	for range 3 {
+		peer.expectRequest(time.Second)
+	}
+	if err := <-done; err != transfer.ErrTimeout {
+		t.Errorf("unanswered Exchange returned %v, want ErrTimeout", err)
+	}
+}
+
+func TestExchangeError(t *testing.T) {
+	peer, reply, done := exchange(t, tftptest.NewNetwork(1), transfer.Config{Timeout: 50 * time.Millisecond, Retries: 3})
+	peer.expectRequest(time.Second)
+	peer.send(&packets.ErrorPacket{ErrorCode: packets.ErrCodeFileNotFound, ErrorMessage: "no f"})
+	select {
+	case err := <-done:
+		if _, ok := err.(errors.ErrorFileNotFound); !ok {
+			t.Errorf("Exchange returned %v, want ErrorFileNotFound", err)
+		}
+	case <-time.After(40 * time.Millisecond):
+		t.Fatal("Exchange did not return before the timeout")
+	}
+	if p := <-reply; p != nil {
+		t.Errorf("Exchange returned %+v with the error", p)
+	}
+	if p := peer.read(100 * time.Millisecond); p != nil {
+		t.Errorf("sent %+v after the ERROR", p)
+	}
+}
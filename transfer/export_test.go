@@ -0,0 +1,14 @@
+package transfer
+
+import (
+	"io"
+	"net"
+)
+
+var SameAddr = sameAddr
+
+// ReceiveGroup runs the receiving end of a multicast transfer whose group
+// has been joined as group.
+func (s *Session) ReceiveGroup(w io.Writer, group net.PacketConn, master bool) (int64, error) {
+	return s.receiveGroup(w, group, master)
+}
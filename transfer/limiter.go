@@ -0,0 +1,41 @@
+package transfer
+
+import (
+	"sync"
+	"time"
+)
+
+// Limiter paces sends to a fixed number of bytes per second with a token
+// bucket that holds no more than the packet being sent, so an idle period
+// does not allow a burst afterwards. A Limiter may be shared by several
+// sessions to cap their combined rate.
+type Limiter struct {
+	rate float64 // bytes per second
+
+	mu     sync.Mutex
+	tokens float64 // negative while in debt
+	last   time.Time
+}
+
+// NewLimiter returns a Limiter allowing bytesPerSecond bytes per second.
+// A rate of zero or less means no limit: Wait returns immediately.
+func NewLimiter(bytesPerSecond int) *Limiter {
+	return &Limiter{rate: float64(bytesPerSecond)}
+}
+
+// Wait takes n bytes from the bucket, sleeping until they are available.
+func (l *Limiter) Wait(n int) {
+	if l.rate <= 0 {
+		return
+	}
+	l.mu.Lock()
+	now := time.Now()
+	if !l.last.IsZero() {
+		l.tokens = min(0, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	delay := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	l.mu.Unlock()
+	time.Sleep(delay)
+}
@@ -0,0 +1,33 @@
+package transfer_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/doodles526/go-tftp/transfer"
+)
+
+func TestLimiterRate(t *testing.T) {
+	// 10000 bytes at 50000 bytes per second take at least 200ms.
+	l := transfer.NewLimiter(50000)
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		l.Wait(1000)
+	}
+	if d := time.Since(start); d < 200*time.Millisecond {
+		t.Errorf("10000 bytes at 50000 B/s took %v, want at least 200ms", d)
+	}
+}
+
+func TestLimiterUnlimited(t *testing.T) {
+	for _, rate := range []int{0, -1} {
+		l := transfer.NewLimiter(rate)
+		start := time.Now()
+		for i := 0; i < 1000; i++ {
+			l.Wait(65464)
+		}
+		if d := time.Since(start); d > 100*time.Millisecond {
+			t.Errorf("NewLimiter(%d) delayed sends for %v", rate, d)
+		}
+	}
+}
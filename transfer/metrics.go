@@ -0,0 +1,30 @@
+package transfer
+
+import (
+	"sync/atomic"
+)
+
+// Metrics counts the activity of any number of transfers. The counters are
+// updated atomically without locking, so they can be read with their Load
+// methods while transfers are running, for example to export them to a
+// monitoring system.
+type Metrics struct {
+	// BytesSent and BytesReceived count DATA payload bytes acknowledged
+	// by the peer and written to the destination respectively.
+	BytesSent     atomic.Int64
+	BytesReceived atomic.Int64
+	// BlocksSent counts DATA packets sent, including retransmissions.
+	BlocksSent atomic.Int64
+	// Retransmissions counts timeouts that caused a packet, or a window
+	// of packets, to be sent again. A rising rate signals packet loss.
+	Retransmissions atomic.Int64
+	// ErrorsSent and ErrorsReceived count ERROR packets by error code.
+	ErrorsSent     [9]atomic.Int64
+	ErrorsReceived [9]atomic.Int64
+}
+
+func (m *Metrics) countError(counters *[9]atomic.Int64, code uint16) {
+	if int(code) < len(counters) {
+		counters[code].Add(1)
+	}
+}
@@ -0,0 +1,30 @@
+package transfer_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/doodles526/go-tftp/packets"
+	"github.com/doodles526/go-tftp/tftptest"
+	"github.com/doodles526/go-tftp/transfer"
+)
+
+func TestMetricsCountRetransmissions(t *testing.T) {
+	n := tftptest.NewNetwork(1)
+	n.Fault = tftptest.OnBlock(packets.OpDATA, 2, tftptest.Drop)
+	sender, receiver := pair(t, n, transfer.Config{Timeout: 20 * time.Millisecond})
+	var m transfer.Metrics
+	sender.Metrics = &m
+	data := randomData(2000)
+	got, sent, received := run(sender, receiver, data)
+	checkTransfer(t, got, sent, received, data)
+	if r := m.Retransmissions.Load(); r != 1 {
+		t.Errorf("Retransmissions = %d, want 1", r)
+	}
+	if b := m.BlocksSent.Load(); b != 5 {
+		t.Errorf("BlocksSent = %d, want 4 blocks and 1 retransmission", b)
+	}
+	if b := m.BytesSent.Load(); b != int64(len(data)) {
+		t.Errorf("BytesSent = %d, want %d", b, len(data))
+	}
+}
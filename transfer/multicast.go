@@ -0,0 +1,260 @@
+package transfer
+
+import (
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/doodles526/go-tftp/errors"
+	"github.com/doodles526/go-tftp/packets"
+)
+
+// maxPendingBlocks bounds the out-of-order blocks a multicast receiver
+// holds while waiting for an earlier one.
+const maxPendingBlocks = 1024
+
+// ReceiveMulticast is Receive for a read request carrying the multicast
+// option of RFC 2090. If the server accepts the option, the session joins
+// the multicast group named in the OACK on interface ifi (nil lets the
+// system choose) and takes DATA blocks from both the group and its own
+// socket. It only acknowledges blocks while the server designates it the
+// master client; the others wait until they become master, when they
+// acknowledge the last block they hold in order so the server resumes
+// after it. If the server ignores the option, the transfer continues as
+// with Receive.
+func (s *Session) ReceiveMulticast(w io.Writer, rrq *packets.ReadRequestPacket, ifi *net.Interface) (int64, error) {
+	n, err := s.receiveMulticast(w, rrq, ifi)
+	s.releaseBuffer()
+	s.summary.Err = err
+	return n, err
+}
+
+func (s *Session) receiveMulticast(w io.Writer, rrq *packets.ReadRequestPacket, ifi *net.Interface) (int64, error) {
+	p, err := s.Exchange(rrq)
+	if err != nil {
+		return 0, err
+	}
+	oack, ok := p.(*packets.OptionAckPacket)
+	if ok {
+		_, ok = oack.Options[packets.OptionMulticast]
+	}
+	if !ok {
+		// Not a multicast transfer: let receive handle the reply.
+		s.pending = p
+		return s.receive(w, rrq)
+	}
+	mc, err := s.acceptMulticast(oack)
+	if err == nil && (mc.Addr == nil || mc.Port == 0) {
+		err = errors.ErrorOptionNegotiation("multicast option without group address")
+	}
+	if err != nil {
+		s.SendError(err)
+		return 0, err
+	}
+	group, err := net.ListenMulticastUDP("udp", ifi, &net.UDPAddr{IP: mc.Addr, Port: mc.Port})
+	if err != nil {
+		s.SendError(errors.ErrorNotDefined("cannot join multicast group"))
+		return 0, err
+	}
+	defer group.Close()
+	return s.receiveGroup(w, group, mc.Master)
+}
+
+// acceptMulticast applies an OACK of a multicast transfer and returns its
+// multicast option.
+func (s *Session) acceptMulticast(oack *packets.OptionAckPacket) (*packets.MulticastOption, error) {
+	if s.OnOptionAck == nil {
+		return nil, errors.ErrorOptionNegotiation("unexpected OACK")
+	}
+	if err := s.OnOptionAck(oack); err != nil {
+		return nil, err
+	}
+	s.summary.Options = oack.Options
+	return packets.ParseMulticastOption(oack.Options[packets.OptionMulticast])
+}
+
+// incoming is a packet read by one of the multicast receiver's readers.
+type incoming struct {
+	p   packets.Packet
+	err error
+}
+
+// receiveGroup runs a multicast transfer once the group has been joined.
+func (s *Session) receiveGroup(w io.Writer, group net.PacketConn, master bool) (int64, error) {
+	done := make(chan struct{})
+	in := make(chan incoming)
+	var wg sync.WaitGroup
+	s.conn.SetReadDeadline(time.Time{})
+	for _, conn := range []net.PacketConn{s.conn, group} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.readPackets(conn, in, done)
+		}()
+	}
+	defer func() {
+		close(done)
+		s.conn.SetReadDeadline(time.Now())
+		group.Close()
+		wg.Wait()
+	}()
+
+	var (
+		n       int64
+		last    uint16 // the last block received in order, acknowledged by the master
+		expect  uint16 = 1
+		pending        = make(map[uint16][]byte) // blocks received ahead of expect
+		retries int
+		timeout = s.Config.Timeout
+	)
+	ack := func() error {
+		return s.send(&packets.AckPacket{BlockNumber: last})
+	}
+	if master {
+		if err := ack(); err != nil {
+			return 0, err
+		}
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		var r incoming
+		select {
+		case r = <-in:
+		case <-timer.C:
+			if retries >= s.Config.Retries {
+				return n, ErrTimeout
+			}
+			retries++
+			if master {
+				p := &packets.AckPacket{BlockNumber: last}
+				s.retransmitted(p, retries)
+				if err := s.send(p); err != nil {
+					return n, err
+				}
+			}
+			timeout = s.Config.nextTimeout(retries, timeout)
+			timer.Reset(timeout)
+			continue
+		}
+		if r.err != nil {
+			return n, r.err
+		}
+		switch p := r.p.(type) {
+		case *packets.OptionAckPacket:
+			// The server passes the master role around with OACKs.
+			mc, err := packets.ParseMulticastOption(p.Options[packets.OptionMulticast])
+			if err != nil {
+				continue
+			}
+			if master = mc.Master; master {
+				if err := ack(); err != nil {
+					return n, err
+				}
+			}
+		case *packets.DataPacket:
+			data := p.Data
+			if s.Config.Checksum {
+				var ok bool
+				if data, ok = stripChecksum(data); !ok {
+					continue
+				}
+			}
+			if p.BlockNumber != expect {
+				if BlockBefore(expect, p.BlockNumber) && len(pending) < maxPendingBlocks {
+					pending[p.BlockNumber] = data
+				}
+				continue
+			}
+			for {
+				final := len(data) < s.Config.BlockSize
+				if err := DetectBlkSizeViolation(&packets.DataPacket{BlockNumber: expect, Data: data}, s.Config.BlockSize, final); err != nil {
+					s.SendError(err)
+					return n, err
+				}
+				m, err := w.Write(data)
+				n += int64(m)
+				if err == nil && m < len(data) {
+					err = io.ErrShortWrite
+				}
+				if err != nil {
+					s.SendError(err)
+					return n, err
+				}
+				s.summary.ack(expect, len(data))
+				if s.Metrics != nil {
+					s.Metrics.BytesReceived.Add(int64(len(data)))
+				}
+				s.progress(n)
+				last, expect = expect, s.Config.Rollover.Next(expect)
+				if final {
+					if master {
+						return n, ack()
+					}
+					return n, nil
+				}
+				var ok bool
+				if data, ok = pending[expect]; !ok {
+					break
+				}
+				delete(pending, expect)
+			}
+			if master {
+				if err := ack(); err != nil {
+					return n, err
+				}
+			}
+		default:
+			continue
+		}
+		retries, timeout = 0, s.Config.Timeout
+		timer.Reset(timeout)
+	}
+}
+
+// readPackets reads packets from the peer on conn and passes them to in,
+// with their payload copied, until reading fails or done is closed.
+func (s *Session) readPackets(conn net.PacketConn, in chan<- incoming, done <-chan struct{}) {
+	buf := AllocBuffer(MaxBlockSize + checksumLen)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			select {
+			case in <- incoming{err: err}:
+			case <-done:
+			}
+			return
+		}
+		if !sameAddr(addr, s.remote) {
+			if conn == s.conn {
+				s.rejectTID(addr, buf[:n])
+			}
+			continue
+		}
+		p, err := packets.Decoder{LenientDecode: s.Config.LenientDecode}.Decode(buf[:n])
+		if err != nil {
+			continue
+		}
+		if d, ok := p.(*packets.DataPacket); ok {
+			p = d.Clone()
+		}
+		if s.Tracer != nil {
+			s.Tracer.OnRecv(p)
+		}
+		if ep, ok := p.(*packets.ErrorPacket); ok {
+			if s.Metrics != nil {
+				s.Metrics.countError(&s.Metrics.ErrorsReceived, ep.ErrorCode)
+			}
+			p, err = nil, packets.PacketToError(ep)
+		}
+		select {
+		case in <- incoming{p: p, err: err}:
+			if err != nil {
+				return
+			}
+		case <-done:
+			return
+		}
+	}
+}
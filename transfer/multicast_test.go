@@ -0,0 +1,86 @@
+package transfer_test
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/doodles526/go-tftp/packets"
+	"github.com/doodles526/go-tftp/tftptest"
+	"github.com/doodles526/go-tftp/transfer"
+)
+
+// TestMulticastRollover has a master client receive a file of more than
+// 65535 blocks from the group, with blocks numbered 65535, 1, 2...
+func TestMulticastRollover(t *testing.T) {
+	n := tftptest.NewNetwork(1)
+	listen := func() net.PacketConn {
+		c, err := n.ListenPacket("udp", ":0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { c.Close() })
+		return c
+	}
+	client, group, server := listen(), listen(), listen()
+
+	const blockSize, blocks = 8, 65540
+	data := randomData((blocks-1)*blockSize + 3)
+	number := func(i int) uint16 {
+		if i > 65535 {
+			return uint16(i - 65535)
+		}
+		return uint16(i)
+	}
+	cfg := transfer.Config{BlockSize: blockSize, Rollover: transfer.RolloverToOne, Timeout: time.Second}
+	s := transfer.NewSession(client, server.LocalAddr(), cfg)
+	var got bytes.Buffer
+	done := make(chan error, 1)
+	go func() {
+		_, err := s.ReceiveGroup(&got, group, true)
+		done <- err
+	}()
+
+	// Keep 16 blocks in flight, sent to the group, and match each ACK
+	// to the next blocks sent.
+	var acked, sent int
+	send := func() {
+		for ; sent < min(acked+16, blocks); sent++ {
+			i := sent + 1
+			end := min(i*blockSize, len(data))
+			b, _ := (&packets.DataPacket{BlockNumber: number(i), Data: data[(i-1)*blockSize : end]}).Encode()
+			server.WriteTo(b, group.LocalAddr())
+		}
+	}
+	buf := make([]byte, 64)
+	for acked < blocks {
+		server.SetReadDeadline(time.Now().Add(time.Second))
+		m, _, err := server.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("after ACK of block %d: %v", acked, err)
+		}
+		p, _ := packets.Decode(buf[:m])
+		ack, ok := p.(*packets.AckPacket)
+		if !ok {
+			t.Fatalf("got %+v, want an ACK", p)
+		}
+		j := acked
+		for j < sent && number(j+1) != ack.BlockNumber {
+			j++
+		}
+		if j == sent && !(acked == 0 && ack.BlockNumber == 0) {
+			t.Fatalf("ACK %d, want one of the blocks sent after %d", ack.BlockNumber, number(acked))
+		}
+		if j < sent {
+			acked = j + 1
+		}
+		send()
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.Bytes(), data) {
+		t.Errorf("received %d bytes differing from the %d sent", got.Len(), len(data))
+	}
+}
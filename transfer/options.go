@@ -0,0 +1,243 @@
+package transfer
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/doodles526/go-tftp/errors"
+	"github.com/doodles526/go-tftp/packets"
+)
+
+// An OptionSpec describes an option that Negotiate accepts.
+type OptionSpec struct {
+	// Name is the lowercase option name.
+	Name string
+	// Min and Max bound the value of a numeric option, for information;
+	// both are zero for other options.
+	Min, Max int
+	// Negotiate validates a requested value, applies it to c and returns
+	// the value to acknowledge, which may be clamped to the bounds. If ok
+	// is false, the option is left out of the OACK. Negotiate is nil for
+	// an option whose value is handled outside Config, such as tsize.
+	Negotiate func(c *Config, value string) (accepted string, ok bool)
+}
+
+// StandardOptions returns the specs of the options Negotiate accepts:
+// blksize, timeout, utimeout, windowsize, rollover and
+// packets.OptionChecksum.
+func StandardOptions() []OptionSpec {
+	return []OptionSpec{
+		BlockSizeOption(MinBlockSize, MaxBlockSize),
+		{Name: packets.OptionTimeout, Min: MinTimeout, Max: MaxTimeout, Negotiate: negotiateTimeout},
+		// After timeout, so that it prevails when both are requested.
+		{Name: packets.OptionUTimeout, Min: MinUTimeout, Max: MaxUTimeout, Negotiate: negotiateUTimeout},
+		{Name: packets.OptionWindowSize, Min: 1, Max: MaxWindowSize, Negotiate: negotiateWindowSize},
+		{Name: packets.OptionRollover, Min: 0, Max: 1, Negotiate: negotiateRollover},
+		{Name: packets.OptionChecksum, Negotiate: negotiateChecksum},
+	}
+}
+
+// Negotiate applies the options a peer requested to c and returns the
+// options to acknowledge in an OACK, or nil if none were accepted. Unknown
+// options, such as vendor extensions, and malformed ones are left out of
+// the reply without failing the request, as RFC 2347 requires.
+// The tsize option is not handled here because its value depends on the
+// file being transferred.
+func (c *Config) Negotiate(requested map[string]string) map[string]string {
+	return c.NegotiateWith(StandardOptions(), requested)
+}
+
+// NegotiateWith is like Negotiate, but accepts the options of specs.
+func (c *Config) NegotiateWith(specs []OptionSpec, requested map[string]string) map[string]string {
+	var accepted map[string]string
+	for _, spec := range specs {
+		value, ok := requested[spec.Name]
+		if !ok || spec.Negotiate == nil {
+			continue
+		}
+		if value, ok = spec.Negotiate(c, value); !ok {
+			continue
+		}
+		if accepted == nil {
+			accepted = make(map[string]string)
+		}
+		accepted[spec.Name] = value
+	}
+	return accepted
+}
+
+// BlockSizeOption returns the spec of a blksize option accepting values
+// in [lo, hi], which must lie within [MinBlockSize, MaxBlockSize].
+// Requests above hi are lowered to it. Requests below lo are left out of
+// the OACK, so the transfer uses the default of 512 bytes: answering
+// with lo would exceed the request, which RFC 2348 lets the client
+// refuse.
+func BlockSizeOption(lo, hi int) OptionSpec {
+	return OptionSpec{
+		Name: packets.OptionBlockSize,
+		Min:  lo,
+		Max:  hi,
+		Negotiate: func(c *Config, value string) (string, bool) {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < lo {
+				return "", false
+			}
+			c.BlockSize = min(n, hi)
+			return strconv.Itoa(c.BlockSize), true
+		},
+	}
+}
+
+func negotiateTimeout(c *Config, value string) (string, bool) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < MinTimeout || n > MaxTimeout {
+		return "", false
+	}
+	c.Timeout = time.Duration(n) * time.Second
+	return strconv.Itoa(n), true
+}
+
+func negotiateUTimeout(c *Config, value string) (string, bool) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < MinUTimeout || n > MaxUTimeout {
+		return "", false
+	}
+	c.Timeout = time.Duration(n) * time.Microsecond
+	return strconv.Itoa(n), true
+}
+
+func negotiateWindowSize(c *Config, value string) (string, bool) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 || n > MaxWindowSize {
+		return "", false
+	}
+	c.WindowSize = n
+	return strconv.Itoa(n), true
+}
+
+func negotiateRollover(c *Config, value string) (string, bool) {
+	mode, ok := parseRollover(value)
+	if !ok {
+		return "", false
+	}
+	c.Rollover = mode
+	return value, true
+}
+
+func negotiateChecksum(c *Config, value string) (string, bool) {
+	if value != "1" {
+		return "", false
+	}
+	c.Checksum = true
+	return value, true
+}
+
+// ApplyOptionAck applies the options acknowledged by a server in an OACK
+// to c. It fails with errors.ErrorOptionNegotiation if the OACK carries an
+// option that was not requested or a value the client cannot use, or one
+// outside what was requested: a server may lower blksize and windowsize
+// but not raise them, and must echo timeout unchanged (RFC 2348, 2349,
+// 7440), as well as utimeout, which prevails over timeout. The caller
+// should then send that error to the server.
+func (c *Config) ApplyOptionAck(requested, acked map[string]string) error {
+	for name, value := range acked {
+		if _, ok := requested[name]; !ok {
+			return errors.ErrorOptionNegotiation("unrequested option " + name)
+		}
+		switch name {
+		case packets.OptionTransferSize:
+			continue
+		case packets.OptionMulticast:
+			if _, err := packets.ParseMulticastOption(value); err != nil {
+				return err
+			}
+			continue
+		case packets.OptionChecksum:
+			if value != "1" {
+				return errors.ErrorOptionNegotiation("invalid " + name)
+			}
+			c.Checksum = true
+			continue
+		case packets.OptionRollover:
+			mode, ok := parseRollover(value)
+			if !ok {
+				return errors.ErrorOptionNegotiation("invalid rollover")
+			}
+			c.Rollover = mode
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return errors.ErrorOptionNegotiation("malformed option " + name)
+		}
+		want, err := strconv.Atoi(requested[name])
+		if err != nil {
+			// Not requested with a number; accept only the bounds.
+			want = -1
+		}
+		switch name {
+		case packets.OptionBlockSize:
+			if n < MinBlockSize || n > MaxBlockSize {
+				return errors.ErrorOptionNegotiation("invalid blksize")
+			}
+			if want >= 0 && n > want {
+				return errors.ErrorOptionNegotiation("blksize larger than requested")
+			}
+			c.BlockSize = n
+		case packets.OptionTimeout:
+			if n < MinTimeout || n > MaxTimeout {
+				return errors.ErrorOptionNegotiation("invalid timeout")
+			}
+			if want >= 0 && n != want {
+				return errors.ErrorOptionNegotiation("timeout differs from requested")
+			}
+			if _, ok := acked[packets.OptionUTimeout]; !ok {
+				c.Timeout = time.Duration(n) * time.Second
+			}
+		case packets.OptionUTimeout:
+			if n < MinUTimeout || n > MaxUTimeout {
+				return errors.ErrorOptionNegotiation("invalid utimeout")
+			}
+			if want >= 0 && n != want {
+				return errors.ErrorOptionNegotiation("utimeout differs from requested")
+			}
+			c.Timeout = time.Duration(n) * time.Microsecond
+		case packets.OptionWindowSize:
+			if n < 1 || n > MaxWindowSize {
+				return errors.ErrorOptionNegotiation("invalid windowsize")
+			}
+			if want >= 0 && n > want {
+				return errors.ErrorOptionNegotiation("windowsize larger than requested")
+			}
+			c.WindowSize = n
+		}
+	}
+	return nil
+}
+
+// parseRollover parses the value of the rollover option, which must be
+// exactly "0" or "1".
+func parseRollover(value string) (RolloverMode, bool) {
+	switch value {
+	case "0":
+		return RolloverToZero, true
+	case "1":
+		return RolloverToOne, true
+	}
+	return 0, false
+}
+
+// DetectBlkSizeViolation checks a DATA block against the negotiated block
+// size. Every block but the last must be exactly negotiated bytes long, and
+// none may be longer; a peer that breaks this has not honoured the blksize
+// option, and the transfer should be aborted with the returned
+// errors.ErrorOptionNegotiation.
+func DetectBlkSizeViolation(d *packets.DataPacket, negotiated int, isFinal bool) error {
+	switch {
+	case len(d.Data) > negotiated:
+		return errors.ErrorOptionNegotiation("DATA block larger than negotiated blksize")
+	case !isFinal && len(d.Data) != negotiated:
+		return errors.ErrorOptionNegotiation("short DATA block before the end of the transfer")
+	}
+	return nil
+}
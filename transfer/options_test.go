@@ -0,0 +1,121 @@
+package transfer_test
+
+import (
+	"maps"
+	"testing"
+	"time"
+
+	"github.com/doodles526/go-tftp/errors"
+	"github.com/doodles526/go-tftp/packets"
+	"github.com/doodles526/go-tftp/transfer"
+)
+
+func TestDetectBlkSizeViolation(t *testing.T) {
+	for _, c := range []struct {
+		name  string
+		size  int
+		final bool
+		ok    bool
+	}{
+		{"full block", 1024, false, true},
+		{"short final block", 10, true, true},
+		{"oversized block", 1025, false, false},
+		{"oversized final block", 1025, true, false},
+		{"short block before the end", 512, false, false},
+	} {
+		err := transfer.DetectBlkSizeViolation(&packets.DataPacket{BlockNumber: 1, Data: make([]byte, c.size)}, 1024, c.final)
+		if c.ok {
+			if err != nil {
+				t.Errorf("%s: %v", c.name, err)
+			}
+		} else if _, ok := err.(errors.ErrorOptionNegotiation); !ok {
+			t.Errorf("%s: error %#v, want ErrorOptionNegotiation", c.name, err)
+		}
+	}
+}
+
+func TestApplyOptionAck(t *testing.T) {
+	requested := map[string]string{
+		packets.OptionBlockSize:  "1024",
+		packets.OptionWindowSize: "8",
+		packets.OptionTimeout:    "2",
+	}
+	for _, c := range []struct {
+		acked map[string]string
+		ok    bool
+	}{
+		{map[string]string{packets.OptionBlockSize: "1024"}, true},
+		{map[string]string{packets.OptionBlockSize: "512", packets.OptionWindowSize: "4"}, true},
+		{map[string]string{packets.OptionBlockSize: "1025"}, false},
+		{map[string]string{packets.OptionBlockSize: "4"}, false},
+		{map[string]string{packets.OptionWindowSize: "9"}, false},
+		{map[string]string{packets.OptionTimeout: "3"}, false},
+		{map[string]string{packets.OptionTransferSize: "100"}, false},
+	} {
+		var cfg transfer.Config
+		err := cfg.ApplyOptionAck(requested, c.acked)
+		if c.ok && err != nil {
+			t.Errorf("OACK %v: %v", c.acked, err)
+		}
+		if _, isNegotiation := err.(errors.ErrorOptionNegotiation); !c.ok && !isNegotiation {
+			t.Errorf("OACK %v: %#v, want ErrorOptionNegotiation", c.acked, err)
+		}
+	}
+	// Accepted values are applied.
+	var cfg transfer.Config
+	if err := cfg.ApplyOptionAck(requested, map[string]string{packets.OptionBlockSize: "512", packets.OptionWindowSize: "4"}); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.BlockSize != 512 || cfg.WindowSize != 4 {
+		t.Errorf("applied %+v", cfg)
+	}
+}
+
+func TestNegotiateUTimeout(t *testing.T) {
+	for _, c := range []struct {
+		requested map[string]string
+		acked     map[string]string
+		timeout   time.Duration
+	}{
+		{map[string]string{packets.OptionUTimeout: "50000"}, map[string]string{packets.OptionUTimeout: "50000"}, 50 * time.Millisecond},
+		{
+			map[string]string{packets.OptionTimeout: "2", packets.OptionUTimeout: "50000"},
+			map[string]string{packets.OptionTimeout: "2", packets.OptionUTimeout: "50000"},
+			50 * time.Millisecond,
+		},
+		// Invalid values are left out, and timeout then applies.
+		{map[string]string{packets.OptionTimeout: "2", packets.OptionUTimeout: "0"}, map[string]string{packets.OptionTimeout: "2"}, 2 * time.Second},
+		{map[string]string{packets.OptionUTimeout: "9999"}, nil, 0},
+		{map[string]string{packets.OptionUTimeout: "256000001"}, nil, 0},
+		{map[string]string{packets.OptionUTimeout: "1e5"}, nil, 0},
+	} {
+		var cfg transfer.Config
+		if acked := cfg.Negotiate(c.requested); !maps.Equal(acked, c.acked) {
+			t.Errorf("%v: acknowledged %v, want %v", c.requested, acked, c.acked)
+		}
+		if cfg.Timeout != c.timeout {
+			t.Errorf("%v: timeout %v, want %v", c.requested, cfg.Timeout, c.timeout)
+		}
+	}
+}
+
+func TestApplyUTimeout(t *testing.T) {
+	requested := map[string]string{packets.OptionTimeout: "2", packets.OptionUTimeout: "50000"}
+	// Whatever the order of the map, utimeout prevails.
+	for range 10 {
+		var cfg transfer.Config
+		if err := cfg.ApplyOptionAck(requested, requested); err != nil {
+			t.Fatal(err)
+		}
+		if cfg.Timeout != 50*time.Millisecond {
+			t.Fatalf("timeout %v, want 50ms", cfg.Timeout)
+		}
+	}
+	for _, value := range []string{"0", "9999", "60000"} {
+		var cfg transfer.Config
+		err := cfg.ApplyOptionAck(requested, map[string]string{packets.OptionUTimeout: value})
+		if _, ok := err.(errors.ErrorOptionNegotiation); !ok {
+			t.Errorf("utimeout %s: %#v, want ErrorOptionNegotiation", value, err)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package transfer_test
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/doodles526/go-tftp/packets"
+	"github.com/doodles526/go-tftp/tftptest"
+	"github.com/doodles526/go-tftp/transfer"
+)
+
+func TestRolloverModes(t *testing.T) {
+	for _, c := range []struct {
+		mode   transfer.RolloverMode
+		block0 int // DATA packets numbered 0
+	}{
+		{transfer.RolloverToZero, 1},
+		{transfer.RolloverToOne, 0},
+	} {
+		n := tftptest.NewNetwork(1)
+		block0 := 0
+		n.Fault = func(d *tftptest.Datagram) tftptest.Action {
+			if packets.Opcode(binary.BigEndian.Uint16(d.Data)) == packets.OpDATA && binary.BigEndian.Uint16(d.Data[2:]) == 0 {
+				block0++
+			}
+			return tftptest.Deliver
+		}
+		// 8-byte blocks cross the wrap in half a megabyte.
+		cfg := transfer.Config{BlockSize: 8, WindowSize: 16, Rollover: c.mode}
+		sender, receiver := pair(t, n, cfg)
+		data := randomData(8*65540 + 3)
+		got, sent, received := run(sender, receiver, data)
+		checkTransfer(t, got, sent, received, data)
+		if block0 != c.block0 {
+			t.Errorf("mode %d: %d DATA packets numbered 0, want %d", c.mode, block0, c.block0)
+		}
+		// 65535 blocks, then 0 to 5 or 1 to 6.
+		if s := receiver.Summary(); s.Blocks != 65541 || s.LastBlock != uint16(6-c.block0) {
+			t.Errorf("mode %d: received %d blocks, the last %d", c.mode, s.Blocks, s.LastBlock)
+		}
+	}
+}
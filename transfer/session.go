@@ -0,0 +1,768 @@
+package transfer
+
+import (
+	"io"
+	"log/slog"
+	"net"
+	"time"
+
+	"github.com/doodles526/go-tftp/errors"
+	"github.com/doodles526/go-tftp/packets"
+)
+
+// Session is one end of a transfer: a socket, and the address of the
+// peer, which doubles as its transfer ID (TID).
+type Session struct {
+	// Config holds the transfer parameters. It may be changed until the
+	// first DATA block is sent or received.
+	Config Config
+
+	// OnOptionAck is called when an OACK arrives in reply to the request
+	// that started a client session. It should validate the acknowledged
+	// options and apply them to Config; an error is sent to the server and
+	// aborts the transfer. If OnOptionAck is nil, an OACK is rejected.
+	OnOptionAck func(*packets.OptionAckPacket) error
+
+	// Logger, if set, receives a debug event for every retransmission
+	// and every packet rejected for coming from an unknown TID, and an
+	// event for every ERROR packet sent to the peer. Events do not
+	// identify the transfer, so Logger should carry that context.
+	Logger *slog.Logger
+
+	// Metrics, if set, is updated as the transfer progresses.
+	Metrics *Metrics
+
+	// OnProgress, if set, is called with the number of bytes transferred
+	// so far each time a block is acknowledged by the peer (Send) or
+	// written (Receive). It runs on the transfer's goroutine, so it must
+	// return quickly to avoid stalling the transfer.
+	OnProgress func(n int64)
+
+	// Tracer, if set, is told of every packet sent to and received from
+	// the peer.
+	Tracer Tracer
+
+	// Limiter, if set, paces the DATA blocks Send transmits for the first
+	// time. Retransmissions are not delayed, so a timeout is never made
+	// worse by the limit.
+	Limiter *Limiter
+
+	conn         net.PacketConn
+	remote       net.Addr
+	tidKnown     bool
+	ignore       net.Addr
+	buf          []byte
+	pending      packets.Packet // returned by the next read, if set
+	lastProgress time.Time
+	lastData     time.Time // when the last DATA packet was sent
+	began        time.Time // when the session first waited for a packet
+	size         int64     // size of the file, if known, else -1
+	requested    time.Time // when a client session first waited for a reply
+	summary      TransferSummary
+
+	cache    *BlockCache
+	cacheKey string
+	cacheMod time.Time
+}
+
+// NewSession returns a Session exchanging packets with remote, whose TID
+// is already known. This is the server side of a transfer.
+func NewSession(conn net.PacketConn, remote net.Addr, cfg Config) *Session {
+	return &Session{Config: cfg.withDefaults(), conn: conn, remote: remote, tidKnown: true, size: -1}
+}
+
+// NewRequestSession returns a Session that sends its request to server and
+// takes the peer's TID from the first reply, which RFC 1350 requires to
+// come from a newly chosen port. This is the client side of a transfer.
+func NewRequestSession(conn net.PacketConn, server net.Addr, cfg Config) *Session {
+	return &Session{Config: cfg.withDefaults(), conn: conn, remote: server, size: -1}
+}
+
+// Ignore makes a session that has not yet learned its peer's TID discard
+// packets from addr. A client reusing one socket for several transfers
+// uses it to avoid mistaking a late packet from the previous transfer for
+// the first reply to the next request.
+func (s *Session) Ignore(addr net.Addr) {
+	s.ignore = addr
+}
+
+// ExpectSize tells the session the size of the file being transferred,
+// as known from the tsize option or otherwise, for Config.MinThroughput.
+func (s *Session) ExpectSize(size int64) {
+	s.size = size
+}
+
+// UseCache makes Send take DATA packets from c, and add those it encodes
+// to c, for the file name last modified at modTime. Cached blocks are
+// skipped in the reader passed to Send by seeking, so the cache is only
+// used if that reader implements io.Seeker. Blocks past a block number
+// wrap and transfers with checksums are not cached.
+func (s *Session) UseCache(c *BlockCache, name string, modTime time.Time) {
+	s.cache, s.cacheKey, s.cacheMod = c, name, modTime
+}
+
+// Summary returns what the session has recorded about its transfer so far,
+// including the error that ended it once Send or Receive has returned.
+func (s *Session) Summary() TransferSummary {
+	return s.summary
+}
+
+// RemoteAddr returns the peer's address: its TID once known, otherwise the
+// address the request is sent to.
+func (s *Session) RemoteAddr() net.Addr {
+	return s.remote
+}
+
+// Receive solicits DATA blocks by sending out, then writes each block's
+// payload to w until a short block ends the transfer; an empty block 1 is
+// an empty file. out is the RRQ for
+// a client read, or the ACK 0 or OACK accepting a write on the server. It
+// returns the number of bytes written to w.
+//
+// A duplicate or out-of-order block is never written; it is answered by
+// acknowledging the last block received in order, at most once until the
+// transfer makes progress. Together with Send only retransmitting on
+// timeout, this keeps duplicated packets from multiplying (the Sorcerer's
+// Apprentice Syndrome).
+//
+// An OACK in reply to a read request is answered with ACK 0, and so is
+// every repeat of it until DATA 1 arrives, as a repeat means the ACK was
+// lost. DATA 1 is accepted whether it follows the ACK or was sent with
+// the OACK by a server that did not wait for it.
+func (s *Session) Receive(w io.Writer, out packets.Packet) (int64, error) {
+	n, err := s.receive(w, out)
+	s.releaseBuffer()
+	s.summary.Err = err
+	return n, err
+}
+
+func (s *Session) receive(w io.Writer, out packets.Packet) (int64, error) {
+	if oack, ok := out.(*packets.OptionAckPacket); ok {
+		s.summary.Options = oack.Options
+	}
+	var (
+		n        int64
+		expect   uint16 = 1 // next block wanted
+		last     uint16     // last block received in order
+		started  bool       // whether any block has been received
+		unacked  int        // blocks received since the last ACK
+		nakSent  bool       // whether the current gap has been reported
+		oackSeen bool
+		retries  int
+		timeout  = s.Config.Timeout
+	)
+	// A pending packet is the reply to out, which was sent already.
+	if s.pending == nil {
+		if err := s.send(out); err != nil {
+			return 0, err
+		}
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		p, err := s.read(deadline)
+		if err == errReadTimeout {
+			if retries >= s.Config.Retries {
+				return n, ErrTimeout
+			}
+			retries++
+			if unacked > 0 {
+				out, unacked = &packets.AckPacket{BlockNumber: last}, 0
+			}
+			s.retransmitted(out, retries)
+			if err := s.send(out); err != nil {
+				return n, err
+			}
+			timeout = s.Config.nextTimeout(retries, timeout)
+			deadline = time.Now().Add(timeout)
+			continue
+		}
+		if err != nil {
+			return n, err
+		}
+		switch p := p.(type) {
+		case *packets.OptionAckPacket:
+			if started {
+				continue
+			}
+			if oackSeen {
+				// The peer retransmitted the OACK, so it has not seen
+				// ACK 0: send it again, but without counting the OACK
+				// as progress.
+				if err := s.send(out); err != nil {
+					return 0, err
+				}
+				continue
+			}
+			if s.OnOptionAck == nil {
+				err := errors.ErrorOptionNegotiation("unexpected OACK")
+				s.SendError(err)
+				return 0, err
+			}
+			if err := s.OnOptionAck(p); err != nil {
+				s.SendError(err)
+				return 0, err
+			}
+			oackSeen = true
+			s.summary.Options = p.Options
+			out = &packets.AckPacket{BlockNumber: 0}
+			if err := s.send(out); err != nil {
+				return 0, err
+			}
+			retries, timeout = 0, s.Config.Timeout
+			deadline = time.Now().Add(timeout)
+		case *packets.DataPacket:
+			if p.BlockNumber == 0 && s.Config.Rollover == RolloverToOne {
+				// Only a peer wrapping to 0 sends block 0; going on would
+				// silently drop it and misplace every block after it.
+				err := errors.ErrorIllegalOperation("DATA block 0 when rolling over to 1")
+				s.SendError(err)
+				return n, err
+			}
+			ok := p.BlockNumber == expect
+			if ok && s.Config.Checksum {
+				p.Data, ok = stripChecksum(p.Data)
+			}
+			if !ok {
+				// Out of order, duplicate or corrupt: acknowledge the last
+				// good block, once per gap, so the sender resumes after it.
+				// A duplicate of a block received since the last ACK only
+				// shows the sender has not yet seen it, so it is dropped
+				// rather than answered with a repeat of that ACK.
+				dup := BlockBefore(p.BlockNumber, expect)
+				if _, ok := out.(*packets.AckPacket); ok && !nakSent && !(dup && unacked > 0) {
+					nakSent = true
+					out, unacked = &packets.AckPacket{BlockNumber: last}, 0
+					if err := s.send(out); err != nil {
+						return n, err
+					}
+				}
+				continue
+			}
+			final := p.IsFinal(s.Config.BlockSize)
+			if err := DetectBlkSizeViolation(p, s.Config.BlockSize, final); err != nil {
+				s.SendError(err)
+				return n, err
+			}
+			m, err := w.Write(p.Data)
+			n += int64(m)
+			if err == nil && m < len(p.Data) {
+				err = io.ErrShortWrite
+			}
+			if err != nil {
+				s.SendError(err)
+				return n, err
+			}
+			started, nakSent = true, false
+			last, expect = expect, s.Config.Rollover.Next(expect)
+			unacked++
+			s.summary.ack(last, len(p.Data))
+			if s.Metrics != nil {
+				s.Metrics.BytesReceived.Add(int64(len(p.Data)))
+			}
+			s.progress(n)
+			if final || unacked >= s.Config.WindowSize {
+				out, unacked = &packets.AckPacket{BlockNumber: last}, 0
+				if err := s.send(out); err != nil {
+					return n, err
+				}
+			}
+			if final {
+				return n, nil
+			}
+			retries, timeout = 0, s.Config.Timeout
+			deadline = time.Now().Add(timeout)
+		}
+	}
+}
+
+// block is a DATA block that has been sent but not yet acknowledged.
+type block struct {
+	num    uint16
+	data   []byte // nil once released by its source
+	wire   []byte // payload as sent: data, followed by its CRC if enabled
+	packet []byte // encoded DATA packet, if taken from or added to the cache
+	off    int64  // offset of data in the source
+	size   int    // length of data
+}
+
+// Send reads r in BlockSize chunks and sends them as DATA blocks until the
+// final, short block has been acknowledged. The final block is empty when
+// the length of r is a multiple of BlockSize, including when r is empty,
+// in which case it is the only block. If out is not nil it is sent
+// first and block 1 follows once the peer acknowledges it with ACK 0 (or,
+// when out is a WRQ, with an OACK). It returns the number of bytes
+// acknowledged by the peer.
+//
+// ACK 0 acknowledges out, and only during the handshake: a WRQ's ACK 0
+// starts the transfer with block 1 and an OACK's confirms the options.
+// Once DATA flows, an ACK 0 acknowledges block 0 after a rollover or is
+// stale, like any ACK outside the blocks in flight, and handled as
+// Config.AckPolicy says; a transfer without a handshake has no ACK 0 to
+// repeat, so every ACK 0 before block 1 is acknowledged is unexpected.
+//
+// Blocks are retransmitted only when the retransmission timeout expires,
+// never in response to a duplicate ACK, which avoids the Sorcerer's
+// Apprentice Syndrome described in RFC 1123 section 4.2.3.1.
+func (s *Session) Send(r io.Reader, out packets.Packet) (int64, error) {
+	n, err := s.sendAll(r, out)
+	s.releaseBuffer()
+	s.summary.Err = err
+	return n, err
+}
+
+func (s *Session) sendAll(r io.Reader, out packets.Packet) (int64, error) {
+	if oack, ok := out.(*packets.OptionAckPacket); ok {
+		s.summary.Options = oack.Options
+	}
+	if out != nil {
+		if err := s.handshake(out); err != nil {
+			return 0, err
+		}
+	}
+	var (
+		n        int64
+		window   []block      // sent or about to be sent, not yet acknowledged
+		sent     int          // number of blocks in window already sent
+		fresh    int          // number of blocks at the end of window never sent
+		resent   bool         // whether a repeated ACK of acked has been acted on
+		next     uint16       = 1
+		acked    uint16       // last block acknowledged, 0 for the handshake
+		ackedAny = out != nil // whether acked is meaningful
+		eof      bool         // whether the final block has been read
+		wrapped  bool         // whether block numbers have wrapped
+		retries  int
+		timeout  = s.Config.Timeout
+	)
+	src := newSource(r)
+	_, seekable := r.(io.Seeker)
+	cache := s.cache != nil && seekable && !s.Config.Checksum
+	for {
+		for len(window) < s.Config.WindowSize && !eof {
+			var (
+				b   block
+				err error
+			)
+			b, eof, err = s.readBlock(src, next, cache && !wrapped)
+			if err != nil {
+				s.SendError(err)
+				return n, err
+			}
+			window = append(window, b)
+			fresh++
+			if next = s.Config.Rollover.Next(next); next < b.num {
+				wrapped = true
+			}
+		}
+		for i := sent; i < len(window); i++ {
+			b := &window[i]
+			if b.data == nil && b.packet == nil {
+				if err := s.reload(src, b); err != nil {
+					s.SendError(err)
+					return n, err
+				}
+			}
+			if s.Limiter != nil && i >= len(window)-fresh {
+				s.Limiter.Wait(len(b.wire))
+			}
+			if err := s.sendBlock(*b); err != nil {
+				return n, err
+			}
+			src.release(b)
+		}
+		sent, fresh = len(window), 0
+		deadline := time.Now().Add(timeout)
+	wait:
+		for {
+			p, err := s.read(deadline)
+			if err == errReadTimeout {
+				if retries >= s.Config.Retries {
+					return n, ErrTimeout
+				}
+				retries++
+				s.retransmitted(&packets.DataPacket{BlockNumber: window[0].num}, retries)
+				timeout = s.Config.nextTimeout(retries, timeout)
+				sent = 0
+				break
+			}
+			if err != nil {
+				return n, err
+			}
+			ack, ok := p.(*packets.AckPacket)
+			if !ok {
+				continue
+			}
+			i := -1
+			for j, b := range window {
+				if b.num == ack.BlockNumber {
+					i = j
+					break
+				}
+			}
+			if i < 0 {
+				// A repeated ACK of the last acknowledged block means
+				// the peer lost part of a window; resend the rest of it,
+				// but only once, as it may also be a delayed duplicate.
+				// In lockstep mode it is always a duplicate.
+				if ackedAny && ack.BlockNumber == acked && s.Config.WindowSize > 1 && sent > 0 && !resent {
+					sent, resent = 0, true
+					break
+				}
+				if s.Config.AckPolicy == RejectUnexpectedAcks && (!ackedAny || int(acked-ack.BlockNumber) > s.Config.WindowSize) {
+					err := errors.ErrorIllegalOperation("unexpected ACK")
+					s.SendError(err)
+					return n, err
+				}
+				continue
+			}
+			for _, b := range window[:i+1] {
+				n += int64(b.size)
+				s.summary.ack(b.num, b.size)
+				if s.Metrics != nil {
+					s.Metrics.BytesSent.Add(int64(b.size))
+				}
+				s.progress(n)
+			}
+			final := eof && i == len(window)-1
+			acked, ackedAny = ack.BlockNumber, true
+			window = append(window[:0], window[i+1:]...)
+			sent, retries, resent, timeout = 0, 0, false, s.Config.Timeout
+			if final {
+				return n, nil
+			}
+			break wait
+		}
+	}
+}
+
+// readBlock returns block num, read from r or, if cached is set, taken
+// from the cache, and reports whether it is the final block.
+func (s *Session) readBlock(src *source, num uint16, cached bool) (block, bool, error) {
+	bs := s.Config.BlockSize
+	off := src.off
+	if cached {
+		if p, ok := s.cache.Get(s.cacheKey, s.cacheMod, bs, num); ok {
+			data := p[4:]
+			if _, err := src.r.(io.Seeker).Seek(int64(len(data)), io.SeekCurrent); err != nil {
+				return block{}, false, err
+			}
+			src.off += int64(len(data))
+			return block{num: num, data: data, wire: data, packet: p, off: off, size: len(data)}, len(data) < bs, nil
+		}
+	}
+	data := make([]byte, bs, bs+checksumLen)
+	m, err := io.ReadFull(src.r, data)
+	eof := err == io.EOF || err == io.ErrUnexpectedEOF
+	if err != nil && !eof {
+		return block{}, false, err
+	}
+	src.off += int64(m)
+	b := block{num: num, data: data[:m], wire: data[:m], off: off, size: m}
+	if s.Config.Checksum {
+		b.wire = appendChecksum(b.data)
+	}
+	if cached {
+		b.packet, _ = (&packets.DataPacket{BlockNumber: num, Data: b.wire}).Encode()
+		s.cache.Put(s.cacheKey, s.cacheMod, bs, num, b.packet)
+	}
+	return b, eof, nil
+}
+
+// sendBlock sends b, reusing its encoded packet if it has one.
+func (s *Session) sendBlock(b block) error {
+	if s.Config.SendDelay > 0 {
+		if !s.lastData.IsZero() {
+			time.Sleep(time.Until(s.lastData.Add(s.Config.SendDelay)))
+		}
+		s.lastData = time.Now()
+	}
+	if b.packet == nil {
+		return s.send(&packets.DataPacket{BlockNumber: b.num, Data: b.wire})
+	}
+	if s.Metrics != nil {
+		s.Metrics.BlocksSent.Add(1)
+	}
+	if s.Tracer != nil {
+		s.Tracer.OnSend(&packets.DataPacket{BlockNumber: b.num, Data: b.wire})
+	}
+	_, err := s.conn.WriteTo(b.packet, s.remote)
+	return err
+}
+
+// Exchange sends out, retransmitting it on timeout, and returns the first
+// packet the peer sends in reply. An ERROR reply is returned as the
+// corresponding error. The packet may refer to the session's receive
+// buffer, so it is only valid until the session next reads.
+func (s *Session) Exchange(out packets.Packet) (packets.Packet, error) {
+	return s.awaitPacket(out, nil)
+}
+
+// handshake sends out and waits for it to be acknowledged with ACK 0, or
+// with an OACK if out is a write request.
+func (s *Session) handshake(out packets.Packet) error {
+	_, isRequest := out.(*packets.WriteRequestPacket)
+	p, err := s.awaitPacket(out, func(p packets.Packet) bool {
+		switch p := p.(type) {
+		case *packets.AckPacket:
+			return p.BlockNumber == 0
+		case *packets.OptionAckPacket:
+			return isRequest
+		}
+		return false
+	})
+	if err != nil {
+		return err
+	}
+	oack, ok := p.(*packets.OptionAckPacket)
+	if !ok {
+		return nil
+	}
+	if s.OnOptionAck == nil {
+		err := errors.ErrorOptionNegotiation("unexpected OACK")
+		s.SendError(err)
+		return err
+	}
+	if err := s.OnOptionAck(oack); err != nil {
+		s.SendError(err)
+		return err
+	}
+	s.summary.Options = oack.Options
+	return nil
+}
+
+// awaitPacket sends out and waits for a reply from the peer that accept
+// reports as the one expected, or for any reply if accept is nil. Other
+// packets are discarded. out is retransmitted each time Config.Timeout,
+// lengthened by Config.Backoff, passes without a reply, up to
+// Config.Retries times before it fails with ErrTimeout. As with read,
+// packets from other TIDs are rejected, and an ERROR from the peer ends
+// the wait at once with the error it carries.
+func (s *Session) awaitPacket(out packets.Packet, accept func(packets.Packet) bool) (packets.Packet, error) {
+	if err := s.send(out); err != nil {
+		return nil, err
+	}
+	timeout := s.Config.Timeout
+	deadline := time.Now().Add(timeout)
+	for retries := 0; ; {
+		p, err := s.read(deadline)
+		if err == errReadTimeout {
+			if retries >= s.Config.Retries {
+				return nil, ErrTimeout
+			}
+			retries++
+			s.retransmitted(out, retries)
+			if err := s.send(out); err != nil {
+				return nil, err
+			}
+			timeout = s.Config.nextTimeout(retries, timeout)
+			deadline = time.Now().Add(timeout)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if accept == nil || accept(p) {
+			return p, nil
+		}
+	}
+}
+
+type readTimeoutError struct{}
+
+func (readTimeoutError) Error() string { return "read timeout" }
+
+// errReadTimeout is returned by read when the deadline passes.
+var errReadTimeout error = readTimeoutError{}
+
+// read returns the next packet from the peer, or errReadTimeout once
+// deadline passes. Packets from other addresses are discarded. An ERROR
+// packet from the peer is returned as the matching error; an undecodable
+// packet is answered with an ERROR and aborts the transfer.
+func (s *Session) read(deadline time.Time) (packets.Packet, error) {
+	// Room for one byte more than the largest valid DATA payload, so
+	// that an oversized block is not silently truncated to a full one,
+	// and never less than a standard 512-byte block needs.
+	size := s.Config.BlockSize + 1
+	if s.Config.Checksum {
+		size += checksumLen
+	}
+	if size < DefaultBlockSize+1 {
+		size = DefaultBlockSize + 1
+	}
+	if len(s.buf) < BufferSize(size) {
+		s.releaseBuffer()
+		s.buf = GetBuffer(size)
+	}
+	if p := s.pending; p != nil {
+		s.pending = nil
+		return p, nil
+	}
+	// reason is the error for the deadline that is nearest, and so the
+	// one that passes first.
+	reason := errReadTimeout
+	if s.Config.IdleTimeout > 0 {
+		if s.lastProgress.IsZero() {
+			s.lastProgress = time.Now()
+		}
+		if d := s.lastProgress.Add(s.Config.IdleTimeout); d.Before(deadline) {
+			deadline, reason = d, ErrTimeout
+		}
+	}
+	if s.Config.MinThroughput > 0 && s.size >= 0 {
+		if s.began.IsZero() {
+			s.began = time.Now()
+		}
+		d := s.began.Add(s.Config.Timeout + time.Duration(float64(s.size)/float64(s.Config.MinThroughput)*float64(time.Second)))
+		if d.Before(deadline) {
+			deadline, reason = d, ErrTooSlow
+		}
+	}
+	if s.Config.ConnectTimeout > 0 && !s.tidKnown {
+		if s.requested.IsZero() {
+			s.requested = time.Now()
+		}
+		if d := s.requested.Add(s.Config.ConnectTimeout); d.Before(deadline) {
+			deadline, reason = d, ErrConnectTimeout
+		}
+	}
+	if err := s.conn.SetReadDeadline(deadline); err != nil {
+		return nil, err
+	}
+	for {
+		n, addr, err := s.conn.ReadFrom(s.buf)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				if reason == ErrTooSlow {
+					s.SendError(errors.ErrorNotDefined("transfer too slow"))
+				}
+				return nil, reason
+			}
+			return nil, err
+		}
+		if s.tidKnown && !sameAddr(addr, s.remote) {
+			s.rejectTID(addr, s.buf[:n])
+			continue
+		}
+		if !s.tidKnown && s.ignore != nil && sameAddr(addr, s.ignore) {
+			continue
+		}
+		p, err := packets.Decoder{LenientDecode: s.Config.LenientDecode}.Decode(s.buf[:n])
+		if err != nil {
+			b, _ := packets.DecodeFailureResponse(err)
+			s.conn.WriteTo(b, addr)
+			return nil, err
+		}
+		if !s.tidKnown {
+			s.remote, s.tidKnown = addr, true
+		}
+		if s.Tracer != nil {
+			s.Tracer.OnRecv(p)
+		}
+		if ep, ok := p.(*packets.ErrorPacket); ok {
+			if s.Metrics != nil {
+				s.Metrics.countError(&s.Metrics.ErrorsReceived, ep.ErrorCode)
+			}
+			return nil, packets.PacketToError(ep)
+		}
+		return p, nil
+	}
+}
+
+// releaseBuffer returns the receive buffer to the pool.
+func (s *Session) releaseBuffer() {
+	if s.buf != nil {
+		PutBuffer(s.buf)
+		s.buf = nil
+	}
+}
+
+func (s *Session) send(p packets.Packet) error {
+	if s.Metrics != nil && p.Opcode() == packets.OpDATA {
+		s.Metrics.BlocksSent.Add(1)
+	}
+	b, err := p.Encode()
+	if err != nil {
+		return err
+	}
+	if s.Tracer != nil {
+		s.Tracer.OnSend(p)
+	}
+	_, err = s.conn.WriteTo(b, s.remote)
+	return err
+}
+
+// SendError tells the peer the transfer is being aborted because of err.
+// Failures are ignored since the transfer is over either way.
+func (s *Session) SendError(err error) {
+	p := packets.ErrorToPacket(err)
+	if s.Metrics != nil {
+		s.Metrics.countError(&s.Metrics.ErrorsSent, p.ErrorCode)
+	}
+	if s.Logger != nil {
+		s.Logger.Info("error sent", "code", p.ErrorCode, "message", p.ErrorMessage)
+	}
+	s.send(p)
+}
+
+// rejectTID answers a packet from a source other than the peer with an
+// Unknown Transfer ID error, as RFC 1350 requires, without disturbing the
+// transfer. ERROR packets are not answered.
+func (s *Session) rejectTID(addr net.Addr, b []byte) {
+	if op, err := packets.Validate(b); err == nil && op == packets.OpERROR {
+		return
+	}
+	p := packets.ErrorToPacket(errors.ErrorUnknownTransferID(""))
+	if s.Metrics != nil {
+		s.Metrics.countError(&s.Metrics.ErrorsSent, p.ErrorCode)
+	}
+	if s.Logger != nil {
+		s.Logger.Debug("packet from unknown TID", "from", addr)
+	}
+	b, _ = p.Encode()
+	s.conn.WriteTo(b, addr)
+}
+
+// progress records that a block has been transferred and reports the n
+// bytes transferred so far to OnProgress, if set.
+func (s *Session) progress(n int64) {
+	if s.Config.IdleTimeout > 0 {
+		s.lastProgress = time.Now()
+	}
+	if s.OnProgress != nil {
+		s.OnProgress(n)
+	}
+}
+
+// retransmitted records that p is being sent again after a timeout, for
+// the attempt'th time.
+func (s *Session) retransmitted(p packets.Packet, attempt int) {
+	if s.Metrics != nil {
+		s.Metrics.Retransmissions.Add(1)
+	}
+	if s.Logger == nil {
+		return
+	}
+	args := []any{"opcode", p.Opcode(), "attempt", attempt}
+	switch p := p.(type) {
+	case *packets.DataPacket:
+		args = append(args, "block", p.BlockNumber)
+	case *packets.AckPacket:
+		args = append(args, "block", p.BlockNumber)
+	}
+	s.Logger.Debug("retransmit", args...)
+}
+
+// sameAddr reports whether a and b are the same transfer ID. An IPv4
+// address equals its IPv4-mapped IPv6 form, as a dual-stack socket may
+// report either. Zones of scoped addresses are compared when both are
+// known, since the same link-local address may exist on several links.
+func sameAddr(a, b net.Addr) bool {
+	ua, ok1 := a.(*net.UDPAddr)
+	ub, ok2 := b.(*net.UDPAddr)
+	if ok1 && ok2 {
+		if ua.Zone != "" && ub.Zone != "" && ua.Zone != ub.Zone {
+			return false
+		}
+		return ua.Port == ub.Port && ua.IP.Equal(ub.IP)
+	}
+	return a.String() == b.String()
+}
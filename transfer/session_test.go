@@ -0,0 +1,84 @@
+package transfer_test
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/doodles526/go-tftp/packets"
+	"github.com/doodles526/go-tftp/tftptest"
+	"github.com/doodles526/go-tftp/transfer"
+)
+
+// pair returns two sessions on n talking to each other, one to send a
+// file with Send and one to receive it with Receive.
+func pair(t *testing.T, n *tftptest.Network, cfg transfer.Config) (sender, receiver *transfer.Session) {
+	t.Helper()
+	a, err := n.ListenPacket("udp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := n.ListenPacket("udp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		a.Close()
+		b.Close()
+	})
+	return transfer.NewSession(a, b.LocalAddr(), cfg), transfer.NewSession(b, a.LocalAddr(), cfg)
+}
+
+// result is what a Send or Receive run in the background returned.
+type result struct {
+	n   int64
+	err error
+}
+
+// run sends data from sender to receiver, with receiver opening the
+// transfer with ACK 0 as a server accepting a write does, and returns
+// what was received along with what Send and Receive returned.
+func run(sender, receiver *transfer.Session, data []byte) (got []byte, sent, received result) {
+	done := make(chan result, 1)
+	go func() {
+		n, err := sender.Send(bytes.NewReader(data), nil)
+		done <- result{n, err}
+	}()
+	var buf bytes.Buffer
+	n, err := receiver.Receive(&buf, &packets.AckPacket{BlockNumber: 0})
+	return buf.Bytes(), <-done, result{n, err}
+}
+
+// randomData returns size reproducible pseudo-random bytes.
+func randomData(size int) []byte {
+	b := make([]byte, size)
+	rand.New(rand.NewSource(int64(size))).Read(b)
+	return b
+}
+
+func checkTransfer(t *testing.T, got []byte, sent, received result, want []byte) {
+	t.Helper()
+	if sent.err != nil || received.err != nil {
+		t.Fatalf("Send: %v, Receive: %v", sent.err, received.err)
+	}
+	if sent.n != int64(len(want)) || received.n != int64(len(want)) {
+		t.Errorf("Send = %d, Receive = %d bytes, want %d", sent.n, received.n, len(want))
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("received %d bytes differing from the %d sent", len(got), len(want))
+	}
+}
+
+func TestTransferPastBlockWrap(t *testing.T) {
+	if testing.Short() {
+		t.Skip("transfers more than 32 MiB")
+	}
+	// Over 65535 blocks of 512 bytes, so block numbers wrap to 0.
+	data := randomData(33<<20 + 100)
+	sender, receiver := pair(t, tftptest.NewNetwork(1), transfer.Config{})
+	got, sent, received := run(sender, receiver, data)
+	checkTransfer(t, got, sent, received, data)
+	if s := receiver.Summary(); s.Blocks != len(data)/512+1 {
+		t.Errorf("received %d blocks, want %d", s.Blocks, len(data)/512+1)
+	}
+}
@@ -0,0 +1,54 @@
+package transfer
+
+import "io"
+
+// source is the reader Send takes DATA blocks from. If the reader is also
+// an io.ReaderAt and an io.Seeker, as files are, a block's payload is
+// dropped once it has been sent and read again by offset should the block
+// have to be retransmitted, so that memory use does not grow with the
+// window size. Other readers keep the payload of every unacknowledged
+// block.
+type source struct {
+	r   io.Reader
+	ra  io.ReaderAt // nil if blocks cannot be read again
+	off int64       // offset in ra of the next block
+}
+
+func newSource(r io.Reader) *source {
+	src := &source{r: r}
+	ra, ok := r.(io.ReaderAt)
+	seeker, seekable := r.(io.Seeker)
+	if ok && seekable {
+		// Blocks start at the reader's current position, not at 0.
+		if off, err := seeker.Seek(0, io.SeekCurrent); err == nil {
+			src.ra, src.off = ra, off
+		}
+	}
+	return src
+}
+
+// release drops the payload of b, which has been sent, if it can be read
+// again. Blocks with an encoded packet are kept, as the packet is shared
+// with the cache anyway.
+func (src *source) release(b *block) {
+	if src.ra != nil && b.packet == nil {
+		b.data, b.wire = nil, nil
+	}
+}
+
+// reload reads the payload of b again after release.
+func (s *Session) reload(src *source, b *block) error {
+	data := make([]byte, b.size, b.size+checksumLen)
+	m, err := src.ra.ReadAt(data, b.off)
+	if m < b.size {
+		if err == nil || err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	b.data, b.wire = data, data
+	if s.Config.Checksum {
+		b.wire = appendChecksum(data)
+	}
+	return nil
+}
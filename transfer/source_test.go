@@ -0,0 +1,84 @@
+package transfer_test
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/doodles526/go-tftp/packets"
+	"github.com/doodles526/go-tftp/tftptest"
+	"github.com/doodles526/go-tftp/transfer"
+)
+
+// countingFile counts the blocks read again by offset.
+type countingFile struct {
+	*os.File
+	readAts atomic.Int32
+}
+
+func (f *countingFile) ReadAt(b []byte, off int64) (int, error) {
+	f.readAts.Add(1)
+	return f.File.ReadAt(b, off)
+}
+
+// rewind sends r to a receiver over a network that loses the first copy
+// of block 3 of a window of 4, so the window is sent again from block 3.
+func rewind(t *testing.T, r io.Reader) []byte {
+	t.Helper()
+	n := tftptest.NewNetwork(1)
+	n.Fault = tftptest.OnBlock(packets.OpDATA, 3, tftptest.Drop)
+	sender, receiver := pair(t, n, transfer.Config{WindowSize: 4, Timeout: 20 * time.Millisecond})
+	done := make(chan result, 1)
+	go func() {
+		n, err := sender.Send(r, nil)
+		done <- result{n, err}
+	}()
+	var buf bytes.Buffer
+	if _, err := receiver.Receive(&buf, &packets.AckPacket{BlockNumber: 0}); err != nil {
+		t.Fatalf("Receive: %v", err)
+	}
+	if res := <-done; res.err != nil {
+		t.Fatalf("Send: %v", res.err)
+	}
+	return buf.Bytes()
+}
+
+func TestRewindFile(t *testing.T) {
+	data := randomData(5000)
+	path := filepath.Join(t.TempDir(), "f")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	// Blocks are read again relative to where the transfer started.
+	if _, err := f.Seek(100, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	cf := &countingFile{File: f}
+	if got := rewind(t, cf); !bytes.Equal(got, data[100:]) {
+		t.Errorf("received %d bytes differing from the %d sent", len(got), len(data)-100)
+	}
+	if cf.readAts.Load() == 0 {
+		t.Error("no block read again from the file")
+	}
+}
+
+func TestRewindPipe(t *testing.T) {
+	data := randomData(5000)
+	pr, pw := io.Pipe()
+	go func() {
+		pw.Write(data)
+		pw.Close()
+	}()
+	if got := rewind(t, pr); !bytes.Equal(got, data) {
+		t.Errorf("received %d bytes differing from the %d sent", len(got), len(data))
+	}
+}
@@ -0,0 +1,61 @@
+package transfer
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// TransferSummary collects what is known about a transfer, chiefly to
+// explain one that failed. A Session accumulates it as the transfer runs.
+type TransferSummary struct {
+	// Options are the negotiated options, or nil if none were.
+	Options map[string]string
+	// Blocks is the number of DATA blocks acknowledged.
+	Blocks int
+	// LastBlock is the number of the last DATA block acknowledged. It
+	// is only meaningful if Blocks is not zero.
+	LastBlock uint16
+	// Bytes is the number of payload bytes acknowledged.
+	Bytes int64
+	// Err is the error that ended the transfer, if any.
+	Err error
+}
+
+// ack records the acknowledgment of a DATA block of size bytes.
+func (t *TransferSummary) ack(block uint16, size int) {
+	t.Blocks++
+	t.LastBlock = block
+	t.Bytes += int64(size)
+}
+
+// String renders the summary on one line.
+func (t TransferSummary) String() string {
+	var b strings.Builder
+	if t.Err != nil {
+		b.WriteString("transfer failed")
+	} else {
+		b.WriteString("transfer completed")
+	}
+	fmt.Fprintf(&b, ": %d bytes in %d blocks", t.Bytes, t.Blocks)
+	if t.Blocks > 0 {
+		fmt.Fprintf(&b, ", last block acknowledged %d", t.LastBlock)
+	} else {
+		b.WriteString(", no block acknowledged")
+	}
+	if len(t.Options) > 0 {
+		names := make([]string, 0, len(t.Options))
+		for name := range t.Options {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		b.WriteString(", options")
+		for _, name := range names {
+			fmt.Fprintf(&b, " %s=%s", name, t.Options[name])
+		}
+	}
+	if t.Err != nil {
+		fmt.Fprintf(&b, ": %v", t.Err)
+	}
+	return b.String()
+}
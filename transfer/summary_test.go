@@ -0,0 +1,59 @@
+package transfer_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/doodles526/go-tftp/packets"
+	"github.com/doodles526/go-tftp/tftptest"
+	"github.com/doodles526/go-tftp/transfer"
+)
+
+func TestSummaryString(t *testing.T) {
+	s := transfer.TransferSummary{
+		Options:   map[string]string{"tsize": "4096", "blksize": "1024"},
+		Blocks:    3,
+		LastBlock: 3,
+		Bytes:     3072,
+		Err:       errors.New("disk on fire"),
+	}
+	want := "transfer failed: 3072 bytes in 3 blocks, last block acknowledged 3, options blksize=1024 tsize=4096: disk on fire"
+	if got := s.String(); got != want {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+	if got := (transfer.TransferSummary{}).String(); got != "transfer completed: 0 bytes in 0 blocks, no block acknowledged" {
+		t.Errorf("empty summary: %q", got)
+	}
+}
+
+func TestSummaryOfAbortedTransfer(t *testing.T) {
+	errRead := errors.New("read failed")
+	sender, receiver := pair(t, tftptest.NewNetwork(1), transfer.Config{})
+	done := make(chan error, 1)
+	go func() {
+		// Two full blocks, then the file fails.
+		r := io.MultiReader(bytes.NewReader(make([]byte, 1024)), &failingReader{errRead})
+		_, err := sender.Send(r, nil)
+		done <- err
+	}()
+	if _, err := receiver.Receive(io.Discard, &packets.AckPacket{BlockNumber: 0}); err == nil {
+		t.Error("Receive succeeded")
+	}
+	if err := <-done; err != errRead {
+		t.Fatalf("Send: %v, want %v", err, errRead)
+	}
+	s := sender.Summary()
+	if s.Blocks != 2 || s.LastBlock != 2 || s.Bytes != 1024 || s.Err != errRead {
+		t.Errorf("Summary = %+v, want 2 blocks, 1024 bytes and the read error", s)
+	}
+	if str := s.String(); !strings.HasPrefix(str, "transfer failed: 1024 bytes in 2 blocks, last block acknowledged 2") {
+		t.Errorf("String = %q", str)
+	}
+}
+
+type failingReader struct{ err error }
+
+func (r *failingReader) Read([]byte) (int, error) { return 0, r.err }
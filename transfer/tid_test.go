@@ -0,0 +1,57 @@
+package transfer_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/doodles526/go-tftp/packets"
+	"github.com/doodles526/go-tftp/tftptest"
+	"github.com/doodles526/go-tftp/transfer"
+)
+
+func TestUnknownTransferID(t *testing.T) {
+	n := tftptest.NewNetwork(1)
+	block2 := make(chan struct{}, 1)
+	// Losing block 3 leaves the receiver waiting for it while the
+	// impostor strikes.
+	drop3 := tftptest.OnBlock(packets.OpDATA, 3, tftptest.Drop)
+	n.Fault = func(d *tftptest.Datagram) tftptest.Action {
+		if p, err := packets.Decode(d.Data); err == nil && packets.Equal(p, &packets.AckPacket{BlockNumber: 2}) {
+			select {
+			case block2 <- struct{}{}:
+			default:
+			}
+		}
+		return drop3(d)
+	}
+	sender, receiver := pair(t, n, transfer.Config{Timeout: 200 * time.Millisecond})
+	impostor, err := n.ListenPacket("udp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer impostor.Close()
+	reply := make(chan packets.Packet, 1)
+	go func() {
+		<-block2
+		// A forged block from the wrong port. It is numbered 4 so that
+		// drop3 cannot mistake it for block 3.
+		b, _ := (&packets.DataPacket{BlockNumber: 4, Data: make([]byte, 512)}).Encode()
+		impostor.WriteTo(b, sender.RemoteAddr())
+		buf := make([]byte, 1024)
+		impostor.SetReadDeadline(time.Now().Add(time.Second))
+		m, _, err := impostor.ReadFrom(buf)
+		if err != nil {
+			reply <- nil
+			return
+		}
+		p, _ := packets.Decode(buf[:m])
+		reply <- p
+	}()
+	data := randomData(3000)
+	got, sent, received := run(sender, receiver, data)
+	checkTransfer(t, got, sent, received, data)
+	p := <-reply
+	if e, ok := p.(*packets.ErrorPacket); !ok || e.ErrorCode != packets.ErrCodeUnknownTransferID {
+		t.Errorf("impostor got %+v, want an ERROR with code 5", p)
+	}
+}
@@ -0,0 +1,20 @@
+package transfer
+
+import (
+	"github.com/doodles526/go-tftp/packets"
+)
+
+// Tracer observes every packet a session exchanges with its peer, for
+// building a timeline of a transfer. OnSend is called just before a packet
+// is written and OnRecv just after one from the peer is decoded, so the
+// time of the call is the time of the event. Packets from other addresses
+// and packets that fail to decode are not traced.
+//
+// Both methods run on the transfer's goroutine, except that OnRecv is
+// called from a reading goroutine in ReceiveMulticast. The packets are
+// only valid for the duration of the call: the Data of a DataPacket
+// aliases the session's buffers.
+type Tracer interface {
+	OnSend(p packets.Packet)
+	OnRecv(p packets.Packet)
+}
@@ -0,0 +1,67 @@
+package tftp_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"testing/iotest"
+
+	tftp "github.com/doodles526/go-tftp"
+	"github.com/doodles526/go-tftp/tftptest"
+)
+
+func TestTransferBuffers(t *testing.T) {
+	n := tftptest.NewNetwork(1)
+	h := newMemHandler(map[string][]byte{"down": file(1300)})
+	c := &tftp.Client{Addr: serve(t, n, &tftp.Server{Handler: h}), Transport: n}
+
+	var got bytes.Buffer
+	if m, err := c.Transfer("down").WriteTo(&got); err != nil || m != 1300 {
+		t.Fatalf("download: %d bytes, %v", m, err)
+	}
+	if !bytes.Equal(got.Bytes(), file(1300)) {
+		t.Error("download: wrong contents")
+	}
+
+	// A multiple of the block size, read a byte at a time: the final
+	// block is the empty one after the second full block.
+	up := bytes.NewBuffer(file(1024))
+	if m, err := c.Transfer("up").ReadFrom(iotest.OneByteReader(up)); err != nil || m != 1024 {
+		t.Fatalf("upload: %d bytes, %v", m, err)
+	}
+	if b, _ := h.file("up"); !bytes.Equal(b, file(1024)) {
+		t.Errorf("upload: server has %d bytes, want 1024", len(b))
+	}
+}
+
+func TestTransferWriteError(t *testing.T) {
+	n := tftptest.NewNetwork(1)
+	done := make(chan tftp.TransferInfo, 1)
+	c := &tftp.Client{Addr: serve(t, n, &tftp.Server{
+		Handler:            newMemHandler(map[string][]byte{"f": file(5000)}),
+		OnTransferComplete: func(info tftp.TransferInfo) { done <- info },
+	}), Transport: n}
+	w := &failingWriter{n: 1000}
+	if _, err := c.Transfer("f").WriteTo(w); err != errWriteFailed {
+		t.Fatalf("WriteTo: %v, want %v", err, errWriteFailed)
+	}
+	// The client stops acknowledging and tells the server.
+	if info := <-done; info.Err == nil || info.Bytes >= 5000 {
+		t.Errorf("server: %d bytes, error %v", info.Bytes, info.Err)
+	}
+}
+
+var errWriteFailed = io.ErrShortWrite
+
+// failingWriter fails once n bytes have been written.
+type failingWriter struct {
+	n int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if len(p) > w.n {
+		return 0, errWriteFailed
+	}
+	w.n -= len(p)
+	return len(p), nil
+}
@@ -0,0 +1,56 @@
+package tftp
+
+import "net"
+
+// Transport opens the UDP sockets a Client or Server uses. The default,
+// used when a Transport field is nil, is the net package's.
+// tftptest.Network is an in-memory Transport for tests.
+type Transport interface {
+	ListenPacket(network, address string) (net.PacketConn, error)
+}
+
+type netTransport struct{}
+
+func (netTransport) ListenPacket(network, address string) (net.PacketConn, error) {
+	return net.ListenPacket(network, address)
+}
+
+// transportOr returns t, or the net package's Transport if t is nil.
+func transportOr(t Transport) Transport {
+	if t == nil {
+		return netTransport{}
+	}
+	return t
+}
+
+// listen opens a UDP socket on address with t and sets its buffer sizes,
+// where not zero, if it supports that as *net.UDPConn does.
+func listen(t Transport, address string, readBuffer, writeBuffer int) (net.PacketConn, error) {
+	conn, err := transportOr(t).ListenPacket("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	if err := setBuffers(conn, readBuffer, writeBuffer); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+func setBuffers(conn net.PacketConn, readBuffer, writeBuffer int) error {
+	if readBuffer > 0 {
+		if c, ok := conn.(interface{ SetReadBuffer(int) error }); ok {
+			if err := c.SetReadBuffer(readBuffer); err != nil {
+				return err
+			}
+		}
+	}
+	if writeBuffer > 0 {
+		if c, ok := conn.(interface{ SetWriteBuffer(int) error }); ok {
+			if err := c.SetWriteBuffer(writeBuffer); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}